@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// arrival returns how many requests arrive together and the step to the
+// next arrival, measured in arrivals at the target rate, so 1 is one mean
+// gap. The run turns steps into wall time.
+type arrival func() (step float64, n int)
+
+func newArrival(name string, burst int) (arrival, error) {
+	switch name {
+	case "constant":
+		return func() (float64, int) { return 1, 1 }, nil
+	case "poisson":
+		// Exponentially distributed gaps make a Poisson process.
+		return func() (float64, int) { return rand.ExpFloat64(), 1 }, nil
+	case "bursty":
+		if burst < 1 {
+			return nil, fmt.Errorf("-burst must be positive, got %d", burst)
+		}
+		// Bursts are spaced so the average rate matches the target.
+		return func() (float64, int) { return float64(burst), burst }, nil
+	default:
+		return nil, fmt.Errorf("unknown arrival distribution %q", name)
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// weighted picks values at random in proportion to their weights.
+type weighted[T any] struct {
+	values  []T
+	weights []int
+	total   int
+}
+
+// parseWeighted parses "a=3,b=1"; a value without a weight has weight 1.
+func parseWeighted[T any](s string, parse func(string) (T, error)) (weighted[T], error) {
+	var w weighted[T]
+	for _, part := range strings.Split(s, ",") {
+		name, weight, hasWeight := strings.Cut(strings.TrimSpace(part), "=")
+		v, err := parse(name)
+		if err != nil {
+			return w, err
+		}
+		n := 1
+		if hasWeight {
+			if n, err = strconv.Atoi(weight); err != nil || n < 0 {
+				return w, fmt.Errorf("bad weight %q of %s", weight, name)
+			}
+		}
+		w.values = append(w.values, v)
+		w.weights = append(w.weights, n)
+		w.total += n
+	}
+	if w.total == 0 {
+		return w, fmt.Errorf("no positive weight in %q", s)
+	}
+	return w, nil
+}
+
+func (w weighted[T]) pick() T {
+	n := rand.IntN(w.total)
+	for i, weight := range w.weights {
+		if n < weight {
+			return w.values[i]
+		}
+		n -= weight
+	}
+	panic("unreachable")
+}
+
+func parseSize(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n, nil
+}
@@ -1,109 +1,251 @@
+// Command client is a load generator for the notification API. It sends
+// notifications at a target rate with a chosen arrival pattern and reports
+// latency percentiles, throughput, errors by gRPC code and how many of the
+// accepted notifications were rate limited.
+//
+//	go run ./client -users 50 -rate 200 -arrival poisson -ramp-up 10s -duration 1m \
+//		-channels email=3,sms=1,push=1 -sizes 200=4,20000=1
+//
+// Rate limiting happens after the API accepted a notification, so it is
+// counted from the WatchEvents stream, which needs the read-status scope.
+// The API key is read from $NOTIFICATION_API_KEY.
 package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/lazypanda2004/notification-system/internal/auth"
 	pb "github.com/lazypanda2004/notification-system/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-const (
-	numUsers     = 5
-	requestRate  = 200 * time.Millisecond // ~3 requests per second
-	testDuration = 10 * time.Second        // run for 5 seconds
-)
+type config struct {
+	users      int
+	userPrefix string
 
-const html = `
-<table align="center" width="100%" cellpadding="0" cellspacing="0" style="padding: 20px;">
-  <tr>
-    <td>
-      <table align="center" width="600" cellpadding="0" cellspacing="0" style="background-color: #ffffff; border-radius: 10px; overflow: hidden; box-shadow: 0 0 10px rgba(0,0,0,0.1);">
-        <tr>
-          <td style="background-color: #fcc70; padding: 30px; text-align: center;">
-            <h1 style="margin: 0; color: #333;">🎉 Happy Birthday ra PUKA! 🎉</h1>
-          </td>
-        </tr>
-        <tr>
-          <td style="padding: 30px; text-align: center;">
-            <img src="https://media1.tenor.com/m/WOqAMSYnCGoAAAAd/telugu-brahmanandam.gif" alt="Birthday Cake" width="300" height = "300" style="border-radius: 10px; margin-bottom: 20px;" />
-            <p style="font-size: 18px; color: #555;">
-              Wishing you a day filled with happiness and a year filled with joy.
-            </p>
-            <p style="font-size: 16px; color: #777;">
-              Bokka le kani PARTY ekkada!
-            </p>
-          </td>
-        </tr>
-        <tr>
-          <td style="background-color: #fcc70; padding: 20px; text-align: center;">
-            <p style="margin: 0; font-size: 14px; color: #444;">
-              With love,<br>Your BABE 💌
-            </p>
-          </td>
-        </tr>
-      </table>
-    </td>
-  </tr>
-</table>
-`
-
-func simulateUser(userID string, client pb.NotificationServiceClient, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	ticker := time.NewTicker(requestRate)
-	defer ticker.Stop()
-
-	end := time.After(testDuration)
-
-	for {
-		select {
-		case <-end:
-			return
-		case <-ticker.C:
-			reqType := "email"
-			req := &pb.NotificationRequest{
-				UserId:    userID,
-				Type:      reqType,
-				Recipient: "g.prashams@iitg.ac.in",
-				
-				Message:   html,
-			}
+	rate     float64 // requests per second after the ramp-up
+	rampUp   time.Duration
+	duration time.Duration
+	arrival  arrival
 
-			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-			res, err := client.SendNotification(ctx, req)
-			cancel()
+	channels weighted[string]
+	sizes    weighted[int]
+	emailTo  string
+	smsTo    string
 
-			if err != nil {
-				log.Printf("%s error: %v", userID, err)
-				continue
-			}
+	timeout     time.Duration
+	maxInFlight int
+	watch       bool
+	settle      time.Duration
+}
 
-			log.Printf("%s => %v | %s", userID, res.Success, res.Message)
-		}
+// offset returns how far into the run the u'th arrival is due, with u
+// counting arrivals at the target rate. It inverts the expected number of
+// arrivals by time t, which is quadratic during the ramp-up as the rate
+// grows linearly from zero, and linear after it.
+func (cfg *config) offset(u float64) time.Duration {
+	ramp := cfg.rampUp.Seconds()
+	if rampArrivals := cfg.rate * ramp / 2; u < rampArrivals {
+		return seconds(math.Sqrt(2 * ramp * u / cfg.rate))
 	}
+	return seconds(ramp + (u-cfg.rate*ramp/2)/cfg.rate)
 }
 
 func main() {
-	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	var cfg config
+	addr := flag.String("addr", "localhost:50051", "gRPC API address")
+	caFile := flag.String("ca", "", "CA certificate of the server, enables TLS")
+	certFile := flag.String("cert", "", "client certificate for mutual TLS")
+	keyFile := flag.String("key", "", "client key for mutual TLS")
+	flag.IntVar(&cfg.users, "users", 5, "number of distinct users to send for")
+	flag.StringVar(&cfg.userPrefix, "user-prefix", "user_", "prefix of the generated user ids")
+	flag.Float64Var(&cfg.rate, "rate", 25, "target requests per second")
+	flag.DurationVar(&cfg.rampUp, "ramp-up", 0, "grow the rate linearly to -rate over this long")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to send, including the ramp-up")
+	arrivalName := flag.String("arrival", "constant", `arrival distribution: "constant", "poisson" or "bursty"`)
+	burst := flag.Int("burst", 10, "requests per burst of the bursty distribution")
+	channels := flag.String("channels", "email", "channel mix as channel=weight pairs, e.g. email=3,sms=1")
+	sizes := flag.String("sizes", "1000", "message sizes in bytes as size=weight pairs, e.g. 200=4,20000=1")
+	flag.StringVar(&cfg.emailTo, "email-to", "loadtest@example.com", "recipient of email notifications")
+	flag.StringVar(&cfg.smsTo, "sms-to", "+15555550100", "recipient of sms notifications")
+	flag.DurationVar(&cfg.timeout, "timeout", 3*time.Second, "timeout of each request")
+	flag.IntVar(&cfg.maxInFlight, "max-in-flight", 1000, "requests in flight before arrivals are skipped")
+	flag.BoolVar(&cfg.watch, "watch", true, "count rate limited and delivered notifications from WatchEvents")
+	flag.DurationVar(&cfg.settle, "settle", 5*time.Second, "keep watching this long after the last request")
+	jsonReport := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	var err error
+	if cfg.users < 1 || cfg.rate <= 0 || cfg.duration <= 0 || cfg.maxInFlight < 1 {
+		log.Fatalf("-users, -rate, -duration and -max-in-flight must be positive")
+	}
+	if cfg.arrival, err = newArrival(*arrivalName, *burst); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.channels, err = parseWeighted(*channels, func(s string) (string, error) { return s, nil }); err != nil {
+		log.Fatalf("-channels: %v", err)
+	}
+	if cfg.sizes, err = parseWeighted(*sizes, parseSize); err != nil {
+		log.Fatalf("-sizes: %v", err)
+	}
+
+	secure := *caFile != "" || *certFile != ""
+	var creds credentials.TransportCredentials = insecure.NewCredentials()
+	if secure {
+		creds, err = auth.ClientTLS(*caFile, *certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if token := os.Getenv("NOTIFICATION_API_KEY"); token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.TokenCredentials{Token: token, Insecure: !secure}))
+	}
+
+	conn, err := grpc.NewClient(*addr, opts...)
 	if err != nil {
 		log.Fatalf("Failed to connect to server: %v", err)
 	}
 	defer conn.Close()
-
 	client := pb.NewNotificationServiceClient(conn)
 
-	var wg sync.WaitGroup
+	// Interrupting stops sending early but still prints the report.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Notification ids carry a per-run prefix so the watcher can tell this
+	// run's events from other traffic of the tenant.
+	runID := fmt.Sprintf("load-%d", time.Now().UnixNano())
+	st := newStats(runID)
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	var watching sync.WaitGroup
+	if cfg.watch {
+		watching.Add(1)
+		go func() {
+			defer watching.Done()
+			st.watch(watchCtx, client)
+		}()
+	}
+
+	log.Printf("Sending to %s for %s at %.1f req/s (%s arrivals) from %d users", *addr, cfg.duration, cfg.rate, *arrivalName, cfg.users)
+	elapsed := generate(ctx, &cfg, client, st)
 
-	for i := 1; i <= numUsers; i++ {
-		wg.Add(1)
-		go simulateUser(fmt.Sprintf("user_%d", i), client, &wg)
+	if cfg.watch && ctx.Err() == nil {
+		log.Printf("Waiting %s for status events", cfg.settle)
+		select {
+		case <-ctx.Done():
+		case <-time.After(cfg.settle):
+		}
 	}
+	stopWatch()
+	watching.Wait()
+
+	r := st.report(elapsed, cfg.watch)
+	if *jsonReport {
+		err = r.writeJSON(os.Stdout)
+	} else {
+		err = r.writeText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
+// generate sends requests as the arrival process dictates until the
+// duration is up or ctx is done, waits for the requests in flight and
+// returns how long that took.
+func generate(ctx context.Context, cfg *config, client pb.NotificationServiceClient, st *stats) time.Duration {
+	inFlight := make(chan struct{}, cfg.maxInFlight)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	// Arrival times are derived from the run's start rather than from the
+	// end of the previous sleep, so the rate holds even when sleeps
+	// overshoot.
+	seq := 0
+	for u := 0.0; cfg.offset(u) < cfg.duration; {
+		if wait := time.Until(start.Add(cfg.offset(u))); wait > 0 {
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				return time.Since(start)
+			case <-time.After(wait):
+			}
+		}
+
+		step, n := cfg.arrival()
+		for range n {
+			seq++
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				st.skip()
+				continue
+			}
+			req := cfg.request(st.runID, seq)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-inFlight }()
+				st.observe(req.Type, send(cfg, client, req))
+			}()
+		}
+		u += step
+	}
 	wg.Wait()
-	log.Println("Load simulation completed.")
+	return time.Since(start)
+}
+
+// request builds the seq'th notification of the run.
+func (cfg *config) request(runID string, seq int) *pb.NotificationRequest {
+	channel := cfg.channels.pick()
+	req := &pb.NotificationRequest{
+		NotificationId: fmt.Sprintf("%s-%d", runID, seq),
+		UserId:         fmt.Sprintf("%s%d", cfg.userPrefix, seq%cfg.users+1),
+		Type:           channel,
+		Message:        payload(cfg.sizes.pick()),
+	}
+	switch channel {
+	case "email":
+		req.Recipient = cfg.emailTo
+		req.Subject = "Load test " + req.NotificationId
+	case "sms":
+		req.Recipient = cfg.smsTo
+	case "push":
+		req.Title = "Load test"
+	}
+	return req
+}
+
+// result is the outcome of one SendNotification call.
+type result struct {
+	latency time.Duration
+	res     *pb.NotificationResponse
+	err     error
+}
+
+func send(cfg *config, client pb.NotificationServiceClient, req *pb.NotificationRequest) result {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	start := time.Now()
+	res, err := client.SendNotification(ctx, req)
+	return result{latency: time.Since(start), res: res, err: err}
+}
+
+// payload returns a message of n bytes.
+func payload(n int) string {
+	const text = "The quick brown fox jumps over the lazy dog. "
+	return strings.Repeat(text, n/len(text)+1)[:n]
 }
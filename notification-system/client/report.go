@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"google.golang.org/grpc/status"
+)
+
+// stats collects the results of a run.
+type stats struct {
+	runID string
+
+	mu        sync.Mutex
+	latencies []time.Duration // of every call that got a reply
+	channels  map[string]int
+	accepted  int
+	rejected  map[string]int // responses with success false, by message
+	errors    map[string]int // by gRPC code
+	skipped   int
+
+	// From WatchEvents.
+	watchErr    error
+	rateLimited map[string]bool
+	states      map[string]string // latest state by notification id
+}
+
+func newStats(runID string) *stats {
+	return &stats{
+		runID:       runID,
+		channels:    make(map[string]int),
+		rejected:    make(map[string]int),
+		errors:      make(map[string]int),
+		rateLimited: make(map[string]bool),
+		states:      make(map[string]string),
+	}
+}
+
+func (s *stats) observe(channel string, r result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[channel]++
+	switch {
+	case r.err != nil:
+		s.errors[status.Code(r.err).String()]++
+		return
+	case r.res.Success:
+		s.accepted++
+	default:
+		s.rejected[r.res.Message]++
+	}
+	s.latencies = append(s.latencies, r.latency)
+}
+
+// skip counts an arrival dropped because too many requests were in flight.
+func (s *stats) skip() {
+	s.mu.Lock()
+	s.skipped++
+	s.mu.Unlock()
+}
+
+// watch records the status events of this run's notifications until ctx is
+// done.
+func (s *stats) watch(ctx context.Context, client pb.NotificationServiceClient) {
+	stream, err := client.WatchEvents(ctx, &pb.WatchEventsRequest{})
+	for err == nil {
+		var ev *pb.NotificationStatus
+		if ev, err = stream.Recv(); err != nil {
+			break
+		}
+		if !strings.HasPrefix(ev.NotificationId, s.runID+"-") {
+			continue
+		}
+		s.mu.Lock()
+		if ev.State == "rate_limited" {
+			s.rateLimited[ev.NotificationId] = true
+		}
+		s.states[ev.NotificationId] = ev.State
+		s.mu.Unlock()
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	log.Printf("Watching status events failed, rate limiting is not counted: %v", err)
+	s.mu.Lock()
+	s.watchErr = err
+	s.mu.Unlock()
+}
+
+type report struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	Sent            int     `json:"sent"`
+	Skipped         int     `json:"skipped"`
+	Completed       int     `json:"completed"`  // calls that got a reply
+	Throughput      float64 `json:"throughput"` // completed calls per second
+
+	Latency map[string]float64 `json:"latency_ms"`
+
+	Accepted int            `json:"accepted"`
+	Rejected map[string]int `json:"rejected"`
+	Errors   map[string]int `json:"errors"`
+	Channels map[string]int `json:"channels"`
+
+	// Only set when status events were watched.
+	RateLimited *int           `json:"rate_limited,omitempty"`
+	States      map[string]int `json:"states,omitempty"`
+}
+
+var percentiles = []float64{50, 90, 95, 99, 100}
+
+func (s *stats) report(elapsed time.Duration, watched bool) *report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &report{
+		DurationSeconds: elapsed.Seconds(),
+		Skipped:         s.skipped,
+		Completed:       len(s.latencies),
+		Throughput:      float64(len(s.latencies)) / elapsed.Seconds(),
+		Latency:         make(map[string]float64),
+		Accepted:        s.accepted,
+		Rejected:        s.rejected,
+		Errors:          s.errors,
+		Channels:        s.channels,
+	}
+	for _, n := range s.channels {
+		r.Sent += n
+	}
+
+	slices.Sort(s.latencies)
+	for _, p := range percentiles {
+		r.Latency[percentileName(p)] = ms(percentile(s.latencies, p))
+	}
+
+	if watched && s.watchErr == nil {
+		n := len(s.rateLimited)
+		r.RateLimited = &n
+		r.States = make(map[string]int)
+		for _, state := range s.states {
+			r.States[state]++
+		}
+	}
+	return r
+}
+
+// percentile returns the p'th percentile of sorted durations, by the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func percentileName(p float64) string {
+	if p == 100 {
+		return "max"
+	}
+	return fmt.Sprintf("p%g", p)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (r *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *report) writeText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sent %d requests in %.1fs, skipped %d over -max-in-flight\n",
+		r.Sent, r.DurationSeconds, r.Skipped)
+	fmt.Fprintf(&b, "Completed %d (%.1f req/s): %d accepted, %d rejected; %d errors\n",
+		r.Completed, r.Throughput, r.Accepted, sum(r.Rejected), sum(r.Errors))
+
+	b.WriteString("Latency:")
+	for _, p := range percentiles {
+		name := percentileName(p)
+		fmt.Fprintf(&b, " %s %.1fms", name, r.Latency[name])
+	}
+	b.WriteString("\n")
+
+	writeCounts(&b, "Channels", r.Channels)
+	writeCounts(&b, "Rejected", r.Rejected)
+	writeCounts(&b, "Errors by gRPC code", r.Errors)
+
+	if r.RateLimited == nil {
+		b.WriteString("Rate limited: unknown, status events were not watched\n")
+	} else {
+		fmt.Fprintf(&b, "Rate limited: %d of %d accepted\n", *r.RateLimited, r.Accepted)
+		writeCounts(&b, "Latest states", r.States)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeCounts writes counts as indented lines, largest first.
+func writeCounts(b *strings.Builder, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	for _, k := range keys {
+		fmt.Fprintf(b, "  %-40s %d\n", k, counts[k])
+	}
+}
+
+func sum(counts map[string]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
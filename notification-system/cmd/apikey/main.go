@@ -0,0 +1,67 @@
+// Command apikey generates an API key for the gRPC API. The key is printed
+// once; only the api_keys.json entry with its hash is kept by the server.
+// With -jwt-secret it issues a signed JWT instead.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/auth"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
+
+func main() {
+	id := flag.String("id", "", "key id, or the JWT subject")
+	tenantID := flag.String("tenant", tenant.Default, "tenant the key acts for")
+	scopes := flag.String("scopes", auth.ScopeSend, "comma separated scopes: send, read-status, admin")
+	jwtSecret := flag.String("jwt-secret", "", "issue a JWT signed with this secret instead of an API key")
+	issuer := flag.String("issuer", "notification-system", "JWT issuer")
+	ttl := flag.Duration("ttl", 24*time.Hour, "JWT lifetime")
+	flag.Parse()
+
+	if *id == "" {
+		log.Fatal("-id is required")
+	}
+	if err := tenant.Validate(*tenantID); err != nil {
+		log.Fatal(err)
+	}
+	list := strings.Split(*scopes, ",")
+	for _, s := range list {
+		switch s {
+		case auth.ScopeSend, auth.ScopeReadStatus, auth.ScopeAdmin:
+		default:
+			log.Fatalf("unknown scope %q", s)
+		}
+	}
+
+	if *jwtSecret != "" {
+		now := time.Now()
+		token, err := auth.SignJWT(&auth.Claims{
+			Subject:   *id,
+			Issuer:    *issuer,
+			Tenant:    *tenantID,
+			Scope:     strings.Join(list, " "),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(*ttl).Unix(),
+		}, []byte(*jwtSecret))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(token)
+		return
+	}
+
+	key := auth.NewKey()
+	entry, err := json.MarshalIndent(auth.APIKey{ID: *id, Tenant: *tenantID, Scopes: list, Hash: auth.HashKey(key)}, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "API key (shown only once): %s\n\nAdd this entry to api_keys.json:\n", key)
+	fmt.Println(string(entry))
+}
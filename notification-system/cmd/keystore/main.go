@@ -0,0 +1,73 @@
+// Command keystore edits the encrypted keystore that "keystore:<name>"
+// secret references are resolved from. The passphrase is read from
+// $NOTIFICATION_KEYSTORE_PASSPHRASE and values from stdin, so neither ends
+// up in the shell history. A running server picks up changes on its next
+// secrets reload.
+//
+//	keystore set smtp-password < password.txt
+//	keystore delete smtp-password
+//	keystore list
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+)
+
+func main() {
+	path := flag.String("file", "keystore.json", "keystore file")
+	flag.Parse()
+
+	passphrase := secrets.New(os.Getenv("NOTIFICATION_KEYSTORE_PASSPHRASE"))
+	ks, err := secrets.OpenKeystore(*path, passphrase)
+	if err != nil {
+		log.Fatalf("Failed to open keystore: %v", err)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		log.Fatal("usage: keystore [-file path] set <name> | delete <name> | list")
+	}
+
+	switch {
+	case args[0] == "list":
+		names := ks.Names()
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return
+
+	case args[0] == "set" && len(args) == 2:
+		// Entries written with another passphrase could not be read back.
+		for _, name := range ks.Names() {
+			if _, err := ks.Get(name); err != nil {
+				log.Fatalf("Refusing to write: %v", err)
+			}
+		}
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			log.Fatalf("Failed to read the value from stdin: %v", err)
+		}
+		ks.Set(args[1], secrets.New(strings.TrimRight(value, "\r\n")))
+
+	case args[0] == "delete" && len(args) == 2:
+		if !ks.Delete(args[1]) {
+			log.Fatalf("No entry %q", args[1])
+		}
+
+	default:
+		log.Fatal("usage: keystore [-file path] set <name> | delete <name> | list")
+	}
+
+	if err := ks.Save(); err != nil {
+		log.Fatalf("Failed to save keystore: %v", err)
+	}
+}
@@ -4,62 +4,420 @@ package loadbalancer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/segmentio/kafka-go"
+	"github.com/lazypanda2004/notification-system/internal/contacts"
+	"github.com/lazypanda2004/notification-system/internal/history"
+	"github.com/lazypanda2004/notification-system/internal/mail"
+	"github.com/lazypanda2004/notification-system/internal/preferences"
+	"github.com/lazypanda2004/notification-system/internal/priority"
+	"github.com/lazypanda2004/notification-system/internal/queue"
 	"github.com/lazypanda2004/notification-system/internal/redis"
+	"github.com/lazypanda2004/notification-system/internal/status"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
 	"github.com/lazypanda2004/notification-system/internal/workerpool"
+	"github.com/lazypanda2004/notification-system/notifier"
+)
+
+// How often the overflow queues are checked for tasks that fit in the
+// users' rate limit again, and how many tasks per user are moved at most on
+// each check.
+const (
+	drainInterval = time.Second
+	drainRounds   = 100
 )
 
 type NotificationTask struct {
-	UserID    string
-	Type      string 
-	Recipient string 
-	Message   string 
+	ID              string                  `json:"notification_id"`
+	TenantID        string                  `json:"tenant_id"`
+	UserID          string                  `json:"user_id"`
+	Type            string                  `json:"type"`
+	Recipient       string                  `json:"recipient"`
+	Message         string                  `json:"message"`
+	TemplateID      string                  `json:"template_id"`
+	TemplateVersion int32                   `json:"template_version"`
+	Variables       map[string]string       `json:"variables"`
+	Subject         string                  `json:"subject"`
+	From            string                  `json:"from"`
+	ReplyTo         string                  `json:"reply_to"`
+	Cc              []string                `json:"cc"`
+	Bcc             []string                `json:"bcc"`
+	Attachments     []mail.Attachment       `json:"attachments"`
+	TextMessage     string                  `json:"text_message"`
+	Title           string                  `json:"title"`
+	Badge           int32                   `json:"badge"`
+	Data            map[string]string       `json:"data"`
+	CollapseKey     string                  `json:"collapse_key"`
+	PushTTLSeconds  int64                   `json:"push_ttl_seconds"`
+	Category        string                  `json:"category"`
+	Fallback        []notifier.FallbackStep `json:"fallback"`
+	TimeoutSeconds  int64                   `json:"timeout_seconds"`
+	Priority        string                  `json:"priority"`
+	ExpiresAt       int64                   `json:"expires_at"`
+}
+
+// nextStep makes the first fallback step the requested channel.
+func (t *NotificationTask) nextStep() {
+	step := t.Fallback[0]
+	t.Type, t.Recipient, t.TimeoutSeconds = step.Channel, step.Recipient, step.TimeoutSeconds
+	t.Fallback = t.Fallback[1:]
 }
 
-func Start(kafkaBrokers []string, kafkaTopic string, limiter *redis.Limiter, pools []*workerpool.WorkerPool) error {
-	ctx := context.Background()
+// Config wires the load balancer to the queue, the limiter and the pools it
+// dispatches to. Preferences, Status, Contacts and History are optional.
+type Config struct {
+	Queue       queue.Queue
+	Topic       string
+	Limiter     *redis.Limiter
+	Pools       []*workerpool.WorkerPool
+	Preferences *preferences.Store
+	Status      *status.Store
+	Contacts    *contacts.Store
+	History     *history.Store
+}
 
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  kafkaBrokers,
-		Topic:    kafkaTopic,
-		GroupID:  "load-balancer-group",
-		MinBytes: 1,
-		MaxBytes: 10e6,
-	})
+// Start consumes the topic of every priority class and dispatches the tasks
+// to the pools until ctx is done. Each priority has its own reader so a
+// backlog of low priority messages never delays a critical one.
+func Start(ctx context.Context, cfg Config) error {
+	var (
+		selector atomic.Uint64
+		wg       sync.WaitGroup
+	)
+	for _, p := range priority.Levels {
+		topic := priority.Topic(cfg.Topic, p)
+		reader := cfg.Queue.Reader(topic, "load-balancer-group")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer reader.Close()
+			consume(ctx, cfg, reader, &selector)
+		}()
+		log.Printf("Load balancer consuming %s", topic)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		drainQueues(ctx, cfg, &selector)
+	}()
 	log.Println("Load balancer started")
 
-	workerSelector := 0
+	wg.Wait()
+	return nil
+}
+
+// consume acknowledges each message once its task was handed on, so a task
+// the load balancer was working on when it stopped is read again.
+func consume(ctx context.Context, cfg Config, reader queue.Reader, selector *atomic.Uint64) {
+	for {
+		m, err := reader.Read(ctx)
+		if ctx.Err() != nil || errors.Is(err, queue.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("Queue read error: %v", err)
+			continue
+		}
+
+		handle(ctx, cfg, m, selector)
+		if err := reader.Ack(ctx, m); err != nil {
+			log.Printf("Failed to acknowledge message: %v", err)
+		}
+	}
+}
+
+func handle(ctx context.Context, cfg Config, m queue.Message, selector *atomic.Uint64) {
+	var task NotificationTask
+	if err := json.Unmarshal(m.Value, &task); err != nil {
+		log.Printf("Invalid message format: %v", err)
+		return
+	}
+
+	if p, err := priority.Parse(task.Priority); err == nil {
+		task.Priority = p
+	}
+	// Everything below reads and writes the task's tenant's keys.
+	ctx = tenant.WithTenant(ctx, task.TenantID)
+	tenant.Count(ctx, "received")
+	log.Printf("Received %s task for user %s of tenant %s", task.Priority, task.UserID, tenant.FromContext(ctx))
+
+	if !checkPreferences(ctx, cfg, &task) {
+		return
+	}
+	if !resolveRecipients(ctx, cfg, &task) {
+		return
+	}
+	admit(ctx, cfg, selector, task)
+}
+
+// admit checks task against the rate limit and dispatches it, or leaves it
+// in the user's overflow queue.
+func admit(ctx context.Context, cfg Config, selector *atomic.Uint64, task NotificationTask) {
+	allowed, err := cfg.Limiter.AllowOrQueue(ctx, redis.QueuedTask(task))
+	if errors.Is(err, redis.ErrExpired) {
+		log.Printf("Notification %s for user %s expired before dispatch", task.ID, task.UserID)
+		record(ctx, cfg, task, status.Expired, "expired before dispatch")
+		return
+	} else if err != nil {
+		log.Printf("Rate limit check failed: %v", err)
+		return
+	}
+
+	if allowed {
+		dispatch(ctx, cfg, selector, task)
+	} else {
+		record(ctx, cfg, task, status.RateLimited, "")
+		log.Printf("Rate limit exceeded for user %s. Task queued.", task.UserID)
+	}
+}
+
+// drainQueues periodically moves tasks from the overflow queues to the
+// pools as the users' rate limit windows free up, dropping expired ones. It
+// takes one task per user and tenant in turn so no tenant monopolizes the
+// pools.
+func drainQueues(ctx context.Context, cfg Config, selector *atomic.Uint64) {
+	type userQueue struct {
+		ctx    context.Context
+		userID string
+	}
+
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
 
 	for {
-		m, err := reader.ReadMessage(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		unpark(ctx, cfg, selector)
+
+		tenants, err := cfg.Limiter.QueuedTenants(ctx)
 		if err != nil {
-			log.Printf("Kafka read error: %v", err)
+			log.Printf("Failed to list tenants with queued tasks: %v", err)
 			continue
 		}
+		var queues []userQueue
+		for _, id := range tenants {
+			tctx := tenant.WithTenant(ctx, id)
+			users, err := cfg.Limiter.QueuedUsers(tctx)
+			if err != nil {
+				log.Printf("Failed to list queued users of tenant %s: %v", id, err)
+				continue
+			}
+			for _, userID := range users {
+				queues = append(queues, userQueue{tctx, userID})
+			}
+		}
+
+		for round := 0; round < drainRounds && len(queues) > 0; round++ {
+			var next []userQueue
+			for _, q := range queues {
+				queued, err := cfg.Limiter.NextQueuedTask(q.ctx, q.userID)
+				if queued == nil {
+					if err != nil {
+						log.Printf("Failed to pop queued task for user %s: %v", q.userID, err)
+					}
+					continue
+				}
+
+				task := NotificationTask(*queued)
+				if errors.Is(err, redis.ErrExpired) {
+					log.Printf("Queued notification %s for user %s expired", task.ID, task.UserID)
+					record(q.ctx, cfg, task, status.Expired, "expired in rate limit queue")
+				} else if !dispatch(q.ctx, cfg, selector, task) {
+					continue // the tenant's pool queues are full
+				}
+				next = append(next, q)
+			}
+			queues = next
+		}
+	}
+}
 
-		var task NotificationTask
-		if err := json.Unmarshal(m.Value, &task); err != nil {
-			log.Printf("Invalid message format: %v", err)
+// unpark admits the tasks parked for channels that were resumed.
+func unpark(ctx context.Context, cfg Config, selector *atomic.Uint64) {
+	parked, err := cfg.Limiter.ParkedChannels(ctx)
+	if err != nil {
+		log.Printf("Failed to list parked channels: %v", err)
+		return
+	}
+	for channel := range parked {
+		if paused, err := cfg.Limiter.Paused(ctx, channel); err != nil || paused {
 			continue
 		}
+		for range drainRounds {
+			queued, err := cfg.Limiter.Unpark(ctx, channel)
+			if queued == nil {
+				if err != nil {
+					log.Printf("Failed to unpark %s task: %v", channel, err)
+				}
+				break
+			}
+			task := NotificationTask(*queued)
+			admit(tenant.WithTenant(ctx, task.TenantID), cfg, selector, task)
+		}
+	}
+}
 
-		log.Printf("Received task for user %s", task.UserID)
+// dispatch hands task to the pools in round robin. Critical tasks wait for
+// room. Anything else goes back to the user's overflow queue when the
+// tenant's queues in all pools are full, so one tenant's backlog never
+// blocks the consumers for the others. It reports whether task was handed
+// to a pool. Tasks of a paused channel are parked instead and count as
+// handed over.
+func dispatch(ctx context.Context, cfg Config, selector *atomic.Uint64, task NotificationTask) bool {
+	if paused, err := cfg.Limiter.Paused(ctx, task.Type); err != nil {
+		log.Printf("Failed to check whether %s is paused: %v", task.Type, err)
+	} else if paused {
+		err := cfg.Limiter.Park(ctx, redis.QueuedTask(task))
+		if err == nil {
+			log.Printf("Channel %s is paused, notification %s parked", task.Type, task.ID)
+			return true
+		}
+		log.Printf("Failed to park notification %s, dispatching it: %v", task.ID, err)
+	}
 
-		allowed, err := limiter.AllowOrQueue(ctx, redis.QueuedTask(task))
+	n := int((selector.Add(1) - 1) % uint64(len(cfg.Pools)))
+
+	if task.Priority != priority.Critical {
+		for i := range cfg.Pools {
+			idx := (n + i) % len(cfg.Pools)
+			if cfg.Pools[idx].TrySubmit(workerpool.Task(task)) {
+				log.Printf("Task for user %s assigned to pool %d", task.UserID, idx)
+				return true
+			}
+		}
+
+		err := cfg.Limiter.Defer(ctx, redis.QueuedTask(task))
+		if err == nil {
+			log.Printf("Pools are full for tenant %s, task for user %s deferred", tenant.FromContext(ctx), task.UserID)
+			return false
+		}
+		log.Printf("Failed to defer task for user %s, waiting for a pool: %v", task.UserID, err)
+	}
+
+	cfg.Pools[n].Submit(workerpool.Task(task))
+	log.Printf("Task for user %s assigned to pool %d", task.UserID, n)
+	return true
+}
+
+// resolveRecipients fills in empty email and sms recipients from the contact
+// directory. Fallback steps without a verified contact are dropped, and when
+// the requested channel has none the next step takes its place.
+func resolveRecipients(ctx context.Context, cfg Config, task *NotificationTask) bool {
+	if cfg.Contacts == nil {
+		return true
+	}
+
+	var steps []notifier.FallbackStep
+	for _, step := range task.Fallback {
+		addr, err := resolveRecipient(ctx, cfg, task.UserID, step.Channel, step.Recipient)
 		if err != nil {
-			log.Printf("Rate limit check failed: %v", err)
+			log.Printf("Skipping %s fallback of notification %s: %v", step.Channel, task.ID, err)
 			continue
 		}
+		step.Recipient = addr
+		steps = append(steps, step)
+	}
+	task.Fallback = steps
 
-		if allowed {
-			assignedPool := pools[workerSelector%len(pools)]
-			assignedPool.Submit(workerpool.Task(task))
-			log.Printf("Task for user %s assigned to pool %d", task.UserID, workerSelector%len(pools))
-			workerSelector++
-		} else {
-			log.Printf("Rate limit exceeded for user %s. Task queued in Redis.", task.UserID)
+	addr, err := resolveRecipient(ctx, cfg, task.UserID, task.Type, task.Recipient)
+	if err == nil {
+		task.Recipient = addr
+		return true
+	}
+	if len(task.Fallback) > 0 {
+		log.Printf("Notification %s cannot use %s, falling back to %s: %v", task.ID, task.Type, task.Fallback[0].Channel, err)
+		task.nextStep()
+		return true
+	}
+
+	log.Printf("Notification %s for user %s has no recipient: %v", task.ID, task.UserID, err)
+	record(ctx, cfg, *task, status.Failed, err.Error())
+	return false
+}
+
+func resolveRecipient(ctx context.Context, cfg Config, userID, channel, recipient string) (string, error) {
+	if recipient != "" || (channel != contacts.ChannelEmail && channel != contacts.ChannelSMS) {
+		return recipient, nil
+	}
+	return cfg.Contacts.Resolve(ctx, userID, channel)
+}
+
+func record(ctx context.Context, cfg Config, task NotificationTask, state, reason string) {
+	if cfg.History != nil && history.Final(state) {
+		err := cfg.History.Record(ctx, history.Entry{
+			NotificationID: task.ID,
+			UserID:         task.UserID,
+			Channel:        task.Type,
+			Recipient:      task.Recipient,
+			Status:         state,
+			Reason:         reason,
+			TemplateID:     task.TemplateID,
+		})
+		if err != nil {
+			log.Printf("Failed to record history of %s: %v", task.ID, err)
+		}
+	}
+	if cfg.Status == nil {
+		tenant.Count(ctx, state) // Record counts it otherwise
+		return
+	}
+	err := cfg.Status.Record(ctx, status.Status{
+		NotificationID: task.ID,
+		UserID:         task.UserID,
+		State:          state,
+		Channel:        task.Type,
+		Reason:         reason,
+	})
+	if err != nil {
+		log.Printf("Failed to record status of %s: %v", task.ID, err)
+	}
+}
+
+// checkPreferences applies the user's preferences to task, filling in the
+// channel when the request left it to the user. Suppressed tasks are
+// recorded with the reason and dropped.
+func checkPreferences(ctx context.Context, cfg Config, task *NotificationTask) bool {
+	if cfg.Preferences == nil {
+		return true
+	}
+
+	prefs, err := cfg.Preferences.Get(ctx, task.UserID)
+	if err != nil {
+		// Fail open: a preferences outage should not stop all delivery.
+		log.Printf("Preference lookup failed for user %s: %v", task.UserID, err)
+		return true
+	}
+
+	task.Type = prefs.Channel(task.Type)
+	var steps []notifier.FallbackStep
+	for _, step := range task.Fallback {
+		if !slices.Contains(prefs.OptedOutChannels, step.Channel) {
+			steps = append(steps, step)
 		}
 	}
+	task.Fallback = steps
+
+	critical := task.Priority == priority.Critical
+	ok, reason := prefs.Check(task.Type, task.Category, critical, time.Now())
+	// An opted-out channel is skipped in favour of the next fallback.
+	if !ok && reason == preferences.ReasonChannelOptOut && len(task.Fallback) > 0 {
+		task.nextStep()
+		ok, reason = prefs.Check(task.Type, task.Category, critical, time.Now())
+	}
+	if ok {
+		return true
+	}
+
+	log.Printf("Notification %s for user %s suppressed: %s", task.ID, task.UserID, reason)
+	record(ctx, cfg, *task, status.Suppressed, reason)
+	return false
 }
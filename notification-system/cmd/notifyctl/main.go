@@ -0,0 +1,138 @@
+// Command notifyctl sends and inspects notifications through the gRPC API.
+//
+//	notifyctl [flags] <command> [command flags]
+//
+// The API key is taken from -token or $NOTIFICATION_API_KEY. Run a command
+// with -h for its flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/auth"
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"github.com/lazypanda2004/notification-system/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+type command struct {
+	run     func(c *cli, args []string) error
+	summary string
+}
+
+var commands = map[string]command{
+	"send":      {runSend, "send one notification from flags or a JSON file"},
+	"batch":     {runBatch, "send every notification of a CSV or JSONL file"},
+	"status":    {runStatus, "show the status of notifications"},
+	"watch":     {runWatch, "stream status changes as they happen"},
+	"queues":    {runQueues, "list or inspect the rate limit overflow queues"},
+	"templates": {runTemplates, "list, show, create or delete templates"},
+}
+
+// cli is the state shared by the commands.
+type cli struct {
+	output   string // "table" or "json"
+	timeout  time.Duration
+	tenantID string
+
+	api   pb.NotificationServiceClient
+	admin pb.AdminServiceClient
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:50051", "gRPC API address")
+	useTLS := flag.Bool("tls", false, "connect over TLS, trusting the system roots unless -ca is set")
+	caFile := flag.String("ca", "", "CA certificate of the server, implies -tls")
+	certFile := flag.String("cert", "", "client certificate for mutual TLS, implies -tls")
+	keyFile := flag.String("key", "", "client key for mutual TLS")
+	token := flag.String("token", os.Getenv("NOTIFICATION_API_KEY"), "API key or JWT")
+	tenantID := flag.String("tenant", "", "act for this tenant, needs an admin key of the default tenant")
+	output := flag.String("o", "table", `output format, "table" or "json"`)
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each call")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "notifyctl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fatal(fmt.Errorf(`-o must be "table" or "json", got %q`, *output))
+	}
+
+	secure := *useTLS || *caFile != "" || *certFile != ""
+	var creds credentials.TransportCredentials = insecure.NewCredentials()
+	if secure {
+		var err error
+		creds, err = auth.ClientTLS(*caFile, *certFile, *keyFile)
+		if err != nil {
+			fatal(err)
+		}
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if *token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.TokenCredentials{Token: *token, Insecure: !secure}))
+	}
+	conn, err := grpc.NewClient(*addr, opts...)
+	if err != nil {
+		fatal(err)
+	}
+	defer conn.Close()
+
+	c := &cli{
+		output:   *output,
+		timeout:  *timeout,
+		tenantID: *tenantID,
+		api:      pb.NewNotificationServiceClient(conn),
+		admin:    pb.NewAdminServiceClient(conn),
+	}
+	if err := cmd.run(c, flag.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+// context bounds a call by the timeout and names the tenant, if any.
+func (c *cli) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	return c.withTenant(ctx), cancel
+}
+
+func (c *cli) withTenant(ctx context.Context) context.Context {
+	if c.tenantID == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, server.TenantHeader, c.tenantID)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: notifyctl [flags] <command> [command flags]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "notifyctl: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+func runQueues(c *cli, args []string) error {
+	if len(args) > 0 && args[0] == "inspect" {
+		return inspectQueue(c, args[1:])
+	}
+
+	fs := flag.NewFlagSet("queues", flag.ExitOnError)
+	all := fs.Bool("all", false, "queues of every tenant, needs an operator key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: notifyctl queues [-all]\n       notifyctl queues inspect -user id [-limit n]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.admin.ListQueues(ctx, &pb.ListQueuesRequest{AllTenants: *all})
+	if err != nil {
+		return err
+	}
+	return c.print(res, func(w io.Writer) {
+		row(w, "TENANT", "USER", "DEPTH")
+		for _, q := range res.Queues {
+			row(w, q.TenantId, q.UserId, q.Depth)
+		}
+	})
+}
+
+func inspectQueue(c *cli, args []string) error {
+	fs := flag.NewFlagSet("queues inspect", flag.ExitOnError)
+	userID := fs.String("user", "", "user whose queue to show")
+	limit := fs.Int("limit", 0, "show at most this many notifications, 0 for the server default")
+	fs.Parse(args)
+	if *userID == "" {
+		return errors.New("queues inspect: -user is required")
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.admin.InspectQueue(ctx, &pb.UserQueueRequest{UserId: *userID, Limit: int32(*limit)})
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return errors.New(res.Message)
+	}
+	return c.print(res, func(w io.Writer) {
+		row(w, "NOTIFICATION", "TYPE", "RECIPIENT", "PRIORITY", "CATEGORY", "EXPIRES")
+		for _, n := range res.Notifications {
+			row(w, n.NotificationId, n.Type, orDash(n.Recipient), orDash(n.Priority), orDash(n.Category), unixTime(n.ExpiresAt))
+		}
+		if int64(len(res.Notifications)) < res.Depth {
+			row(w, "...", res.Depth-int64(len(res.Notifications)), "more")
+		}
+	})
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// varsFlag collects repeated -var name=value flags.
+type varsFlag map[string]string
+
+func (v varsFlag) String() string {
+	return fmt.Sprint(map[string]string(v))
+}
+
+func (v varsFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=value, got %q", s)
+	}
+	v[name] = value
+	return nil
+}
+
+func runSend(c *cli, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	file := fs.String("f", "", "JSON file with a NotificationRequest; flags override its fields")
+	userID := fs.String("user", "", "user id")
+	typ := fs.String("type", "", "channel: email, sms, push, webhook, slack, discord or teams")
+	to := fs.String("to", "", "recipient, empty for the user's verified contact")
+	message := fs.String("message", "", "message body, or @file to read it from a file")
+	subject := fs.String("subject", "", "email subject")
+	templateID := fs.String("template", "", "template id")
+	vars := varsFlag{}
+	fs.Var(vars, "var", "template variable name=value, repeatable")
+	prio := fs.String("priority", "", "critical, high, normal or low")
+	category := fs.String("category", "", "category checked against the user's subscriptions")
+	delay := fs.Int64("delay", 0, "send after this many seconds")
+	ttl := fs.Int64("ttl", 0, "drop the notification if undelivered after this many seconds")
+	id := fs.String("id", "", "notification id, assigned by the server when empty")
+	fs.Parse(args)
+
+	req := &pb.NotificationRequest{}
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		if err := protojson.Unmarshal(data, req); err != nil {
+			return fmt.Errorf("%s: %w", *file, err)
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "user":
+			req.UserId = *userID
+		case "type":
+			req.Type = *typ
+		case "to":
+			req.Recipient = *to
+		case "message":
+			req.Message, err = readArg(*message)
+		case "subject":
+			req.Subject = *subject
+		case "template":
+			req.TemplateId = *templateID
+		case "var":
+			if req.Variables == nil {
+				req.Variables = make(map[string]string)
+			}
+			for k, v := range vars {
+				req.Variables[k] = v
+			}
+		case "priority":
+			req.Priority = *prio
+		case "category":
+			req.Category = *category
+		case "delay":
+			req.DelaySeconds = *delay
+		case "ttl":
+			req.TtlSeconds = *ttl
+		case "id":
+			req.NotificationId = *id
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if req.UserId == "" {
+		return errors.New("send: -user is required")
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.api.SendNotification(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := c.print(res, func(w io.Writer) {
+		row(w, "NOTIFICATION", "RESULT")
+		row(w, orDash(res.NotificationId), res.Message)
+	}); err != nil {
+		return err
+	}
+	if !res.Success {
+		return errors.New(res.Message)
+	}
+	return nil
+}
+
+// readArg returns s, or the contents of the file when s is "@path".
+func readArg(s string) (string, error) {
+	path, ok := strings.CutPrefix(s, "@")
+	if !ok {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+// batchResult is one line of batch output.
+type batchResult struct {
+	Line           int    `json:"line"`
+	NotificationID string `json:"notification_id,omitempty"`
+	Success        bool   `json:"success"`
+	Message        string `json:"message"`
+}
+
+func runBatch(c *cli, args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	file := fs.String("f", "", "CSV or JSONL file, one notification per row or line")
+	format := fs.String("format", "", `"csv" or "jsonl", guessed from the file extension when empty`)
+	parallel := fs.Int("parallel", 4, "requests in flight")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: notifyctl batch -f file [-format csv|jsonl] [-parallel n]\n\n"+
+			"CSV files need a header row naming NotificationRequest fields, e.g.\n"+
+			"user_id,type,recipient,message; columns named var.<name> become template\n"+
+			"variables. JSONL files hold one NotificationRequest object per line.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *file == "" {
+		return errors.New("batch: -f is required")
+	}
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(*file)) {
+		case ".csv":
+			*format = "csv"
+		case ".jsonl", ".ndjson":
+			*format = "jsonl"
+		default:
+			return errors.New("batch: cannot tell the format from the file name, set -format")
+		}
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	type job struct {
+		line int
+		req  *pb.NotificationRequest
+	}
+	jobs := make(chan job)
+	results := make(chan batchResult)
+
+	var wg sync.WaitGroup
+	for range max(*parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				ctx, cancel := c.context()
+				res, err := c.api.SendNotification(ctx, j.req)
+				cancel()
+				r := batchResult{Line: j.line}
+				if err != nil {
+					r.Message = err.Error()
+				} else {
+					r.NotificationID, r.Success, r.Message = res.NotificationId, res.Success, res.Message
+				}
+				results <- r
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		emit := func(line int, req *pb.NotificationRequest) {
+			jobs <- job{line, req}
+		}
+		if *format == "csv" {
+			readErr = readCSV(f, emit)
+		} else {
+			readErr = readJSONL(f, emit)
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var sent, failed int
+	table := c.output == "table"
+	if table {
+		fmt.Printf("%-6s %-34s %s\n", "LINE", "NOTIFICATION", "RESULT")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for r := range results {
+		if r.Success {
+			sent++
+		} else {
+			failed++
+		}
+		if table {
+			fmt.Printf("%-6d %-34s %s\n", r.Line, orDash(r.NotificationID), r.Message)
+		} else {
+			enc.Encode(r)
+		}
+	}
+	if readErr != nil {
+		return readErr
+	}
+	fmt.Fprintf(os.Stderr, "%d sent, %d failed\n", sent, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d notifications failed", failed)
+	}
+	return nil
+}
+
+// csvColumns sets the NotificationRequest field of each known CSV column.
+var csvColumns = map[string]func(req *pb.NotificationRequest, v string) error{
+	"user_id":         func(r *pb.NotificationRequest, v string) error { r.UserId = v; return nil },
+	"type":            func(r *pb.NotificationRequest, v string) error { r.Type = v; return nil },
+	"recipient":       func(r *pb.NotificationRequest, v string) error { r.Recipient = v; return nil },
+	"message":         func(r *pb.NotificationRequest, v string) error { r.Message = v; return nil },
+	"subject":         func(r *pb.NotificationRequest, v string) error { r.Subject = v; return nil },
+	"template_id":     func(r *pb.NotificationRequest, v string) error { r.TemplateId = v; return nil },
+	"priority":        func(r *pb.NotificationRequest, v string) error { r.Priority = v; return nil },
+	"category":        func(r *pb.NotificationRequest, v string) error { r.Category = v; return nil },
+	"notification_id": func(r *pb.NotificationRequest, v string) error { r.NotificationId = v; return nil },
+	"delay_seconds":   func(r *pb.NotificationRequest, v string) error { return parseInt(v, &r.DelaySeconds) },
+	"ttl_seconds":     func(r *pb.NotificationRequest, v string) error { return parseInt(v, &r.TtlSeconds) },
+}
+
+func parseInt(s string, dst *int64) error {
+	if s == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	*dst = n
+	return err
+}
+
+func readCSV(r io.Reader, emit func(int, *pb.NotificationRequest)) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("csv header: %w", err)
+	}
+	for _, col := range header {
+		if _, ok := csvColumns[col]; !ok && !strings.HasPrefix(col, "var.") {
+			return fmt.Errorf("csv: unknown column %q", col)
+		}
+	}
+
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		req := &pb.NotificationRequest{}
+		for i, col := range header {
+			if name, ok := strings.CutPrefix(col, "var."); ok {
+				if req.Variables == nil {
+					req.Variables = make(map[string]string)
+				}
+				req.Variables[name] = rec[i]
+				continue
+			}
+			if err := csvColumns[col](req, rec[i]); err != nil {
+				return fmt.Errorf("csv line %d, column %s: %w", line, col, err)
+			}
+		}
+		emit(line, req)
+	}
+}
+
+func readJSONL(r io.Reader, emit func(int, *pb.NotificationRequest)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 10<<20) // HTML bodies can be long
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		req := &pb.NotificationRequest{}
+		if err := protojson.Unmarshal([]byte(text), req); err != nil {
+			return fmt.Errorf("jsonl line %d: %w", line, err)
+		}
+		emit(line, req)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+func runStatus(c *cli, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: notifyctl status <notification id>...")
+	}
+
+	var statuses []*pb.NotificationStatus
+	for _, id := range fs.Args() {
+		ctx, cancel := c.context()
+		res, err := c.api.GetNotificationStatus(ctx, &pb.NotificationStatusRequest{NotificationId: id})
+		cancel()
+		if err != nil {
+			return err
+		}
+		if !res.Success {
+			return fmt.Errorf("%s: %s", id, res.Message)
+		}
+		statuses = append(statuses, res.Status)
+	}
+
+	if c.output == "json" {
+		for _, st := range statuses {
+			if err := c.print(st, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.print(nil, func(w io.Writer) {
+		row(w, statusColumns...)
+		for _, st := range statuses {
+			row(w, statusFields(st)...)
+		}
+	})
+}
+
+func runWatch(c *cli, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	userID := fs.String("user", "", "only changes of this user's notifications")
+	id := fs.String("id", "", "only changes of this notification")
+	fs.Parse(args)
+
+	// The stream runs until interrupted, so it is not bounded by -timeout.
+	stream, err := c.api.WatchEvents(c.withTenant(context.Background()), &pb.WatchEventsRequest{
+		UserId:         *userID,
+		NotificationId: *id,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Rows are printed as they arrive, so the table has fixed column widths
+	// instead of being aligned by a tabwriter.
+	const format = "%-34s %-16s %-10s %-8s %-19s %s\n"
+	if c.output == "table" {
+		fmt.Printf(format, statusColumns...)
+	}
+	for {
+		st, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if c.output == "json" {
+			err = c.print(st, nil)
+		} else {
+			_, err = fmt.Printf(format, statusFields(st)...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var statusColumns = []any{"NOTIFICATION", "USER", "STATE", "CHANNEL", "UPDATED", "REASON"}
+
+func statusFields(st *pb.NotificationStatus) []any {
+	return []any{st.NotificationId, orDash(st.UserId), st.State, orDash(st.Channel), unixTime(st.UpdatedAt), orDash(st.Reason)}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+func runTemplates(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: notifyctl templates list|get|create|delete")
+	}
+	switch args[0] {
+	case "list":
+		return listTemplates(c)
+	case "get":
+		return getTemplate(c, args[1:])
+	case "create":
+		return createTemplate(c, args[1:])
+	case "delete":
+		return deleteTemplate(c, args[1:])
+	default:
+		return fmt.Errorf("templates: unknown subcommand %q", args[0])
+	}
+}
+
+func listTemplates(c *cli) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.api.ListTemplates(ctx, &pb.ListTemplatesRequest{})
+	if err != nil {
+		return err
+	}
+	return c.print(res, func(w io.Writer) {
+		row(w, "TEMPLATE", "VERSION", "CREATED", "SUBJECT")
+		for _, t := range res.Templates {
+			row(w, t.TemplateId, t.Version, unixTime(t.CreatedAt), orDash(t.EmailSubject))
+		}
+	})
+}
+
+// templateID parses "<id> [-version n]" of get and delete.
+func templateID(name string, args []string) (*pb.TemplateIdRequest, error) {
+	fs := flag.NewFlagSet("templates "+name, flag.ExitOnError)
+	version := fs.Int("version", 0, "template version, 0 for the latest")
+	if name == "delete" {
+		fs.Lookup("version").Usage = "template version, 0 for every version"
+	}
+	// Accept the id before or after the flags.
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		args = append(args[1:], args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("usage: notifyctl templates %s <id> [-version n]", name)
+	}
+	return &pb.TemplateIdRequest{TemplateId: fs.Arg(0), Version: int32(*version)}, nil
+}
+
+func getTemplate(c *cli, args []string) error {
+	req, err := templateID("get", args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.api.GetTemplate(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return errors.New(res.Message)
+	}
+	t := res.Template
+	return c.print(t, func(w io.Writer) {
+		row(w, "TEMPLATE", t.TemplateId)
+		row(w, "VERSION", t.Version)
+		row(w, "CREATED", unixTime(t.CreatedAt))
+		row(w, "SUBJECT", orDash(t.EmailSubject))
+		fmt.Fprintf(w, "\nEMAIL HTML:\n%s\n\nEMAIL TEXT:\n%s\n\nSMS TEXT:\n%s\n", t.EmailHtml, t.EmailText, t.SmsText)
+	})
+}
+
+func createTemplate(c *cli, args []string) error {
+	fs := flag.NewFlagSet("templates create", flag.ExitOnError)
+	id := fs.String("id", "", "template id, a new version is added when it exists")
+	subject := fs.String("subject", "", "email subject template")
+	html := fs.String("email-html", "", "file with the HTML email body")
+	text := fs.String("email-text", "", "file with the plain-text email body")
+	sms := fs.String("sms-text", "", "file with the SMS body")
+	fs.Parse(args)
+	if *id == "" {
+		return errors.New("templates create: -id is required")
+	}
+
+	t := &pb.Template{TemplateId: *id, EmailSubject: *subject}
+	for _, f := range []struct {
+		path string
+		dst  *string
+	}{{*html, &t.EmailHtml}, {*text, &t.EmailText}, {*sms, &t.SmsText}} {
+		if f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		*f.dst = string(data)
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.api.CreateTemplate(ctx, t)
+	if err != nil {
+		return err
+	}
+	return c.templateResult(res)
+}
+
+func deleteTemplate(c *cli, args []string) error {
+	req, err := templateID("delete", args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := c.api.DeleteTemplate(ctx, req)
+	if err != nil {
+		return err
+	}
+	return c.templateResult(res)
+}
+
+func (c *cli) templateResult(res *pb.TemplateResponse) error {
+	if err := c.print(res, func(w io.Writer) {
+		row(w, "RESULT", res.Message)
+		if res.Template != nil && res.Template.Version > 0 {
+			row(w, "VERSION", res.Template.Version)
+		}
+	}); err != nil {
+		return err
+	}
+	if !res.Success {
+		return errors.New(res.Message)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Command smsgateway runs the mock SMS gateway so the SMS path can be
+// exercised without a real provider account.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/lazypanda2004/notification-system/internal/sms"
+)
+
+func main() {
+	addr := flag.String("addr", ":8089", "listen address")
+	accountSID := flag.String("account-sid", "AC_local", "account SID clients must authenticate with")
+	authToken := flag.String("auth-token", "local-token", "auth token clients must authenticate with")
+	flag.Parse()
+
+	gateway := sms.NewMockGateway(*accountSID, *authToken)
+
+	log.Printf("Mock SMS gateway listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, logRequests(gateway)); err != nil {
+		log.Fatalf("Mock SMS gateway error: %v", err)
+	}
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
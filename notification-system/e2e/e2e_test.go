@@ -0,0 +1,172 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+func TestDelivery(t *testing.T) {
+	h := Start(t, Options{})
+
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "email", Recipient: "alice@example.com", Subject: "Hello", Message: "hi by email"})
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: "hi by sms"})
+
+	got := h.WaitDeliveries(t, 2, 5*time.Second)
+	byChannel := map[string]Delivery{}
+	for _, d := range got {
+		byChannel[d.Channel] = d
+	}
+	if d := byChannel["email"]; d.To != "alice@example.com" || d.Subject != "Hello" || d.Body != "hi by email" {
+		t.Errorf("Email delivery = %+v", d)
+	}
+	if d := byChannel["sms"]; d.To != "+15551234567" || d.Body != "hi by sms" {
+		t.Errorf("SMS delivery = %+v", d)
+	}
+	if n := h.RateLimited(); n != 0 {
+		t.Errorf("RateLimited = %d, want 0", n)
+	}
+}
+
+func TestRateLimitQueuesAndDrainsInOrder(t *testing.T) {
+	h := Start(t, Options{RateLimit: 2, Window: 2 * time.Second})
+
+	var want []string
+	for i := range 5 {
+		body := fmt.Sprintf("message %d", i)
+		want = append(want, body)
+		h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: body})
+	}
+
+	// The first two fit the limit, the rest wait for the next windows.
+	AssertOrder(t, h.WaitDeliveries(t, 2, 5*time.Second), want[:2]...)
+	h.AssertDeliveryCount(t, 2, 500*time.Millisecond)
+	if n := h.RateLimited(); n != 3 {
+		t.Errorf("RateLimited = %d, want 3", n)
+	}
+	if n := h.QueueDepth(t, "alice"); n != 3 {
+		t.Errorf("QueueDepth = %d, want 3", n)
+	}
+
+	// Other users have their own budget.
+	h.Send(t, &pb.NotificationRequest{UserId: "bob", Type: "sms", Recipient: "+15557654321", Message: "for bob"})
+	h.WaitDeliveries(t, 3, 5*time.Second)
+
+	got := h.WaitDeliveries(t, 6, 10*time.Second)
+	var alice []Delivery
+	for _, d := range got {
+		if d.To == "+15551234567" {
+			alice = append(alice, d)
+		}
+	}
+	AssertOrder(t, alice, want...)
+	if n := h.QueueDepth(t, "alice"); n != 0 {
+		t.Errorf("QueueDepth after drain = %d, want 0", n)
+	}
+}
+
+func TestCriticalBypassesRateLimit(t *testing.T) {
+	h := Start(t, Options{RateLimit: 1})
+
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: "normal"})
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: "queued"})
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: "critical", Priority: "critical"})
+
+	got := h.AssertDeliveryCount(t, 2, time.Second)
+	AssertOrder(t, got, "normal", "critical")
+	if n := h.RateLimited(); n != 1 {
+		t.Errorf("RateLimited = %d, want 1", n)
+	}
+}
+
+func TestPausedChannelIsHeldUntilResumed(t *testing.T) {
+	h := Start(t, Options{})
+	ctx := context.Background()
+
+	res, err := h.Admin.PauseChannel(ctx, &pb.ChannelRequest{Channel: "sms"})
+	if err != nil || !res.Success {
+		t.Fatalf("PauseChannel = %v, %v", res, err)
+	}
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: "held"})
+	h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "email", Recipient: "alice@example.com", Message: "not held"})
+
+	got := h.WaitDeliveries(t, 1, 5*time.Second)
+	AssertOrder(t, got, "not held")
+	h.AssertDeliveryCount(t, 1, 500*time.Millisecond)
+
+	res, err = h.Admin.ResumeChannel(ctx, &pb.ChannelRequest{Channel: "sms"})
+	if err != nil || !res.Success {
+		t.Fatalf("ResumeChannel = %v, %v", res, err)
+	}
+	got = h.WaitDeliveries(t, 2, 5*time.Second)
+	AssertOrder(t, got, "not held", "held")
+}
+
+func TestEmailFallsBackToSMS(t *testing.T) {
+	h := Start(t, Options{})
+	h.SMTP.Reject("bounce@example.com")
+
+	h.Send(t, &pb.NotificationRequest{
+		UserId:    "alice",
+		Type:      "email",
+		Recipient: "bounce@example.com",
+		Message:   "fallback",
+		Fallback:  []*pb.FallbackStep{{Channel: "sms", Recipient: "+15551234567"}},
+	})
+
+	got := h.WaitDeliveries(t, 1, 30*time.Second)
+	if got[0].Channel != "sms" || got[0].Body != "fallback" {
+		t.Errorf("Delivery = %+v, want the sms fallback", got[0])
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := Start(t, Options{})
+	h.SMTP.Reject("bounce@example.com")
+
+	delivered := h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "sms", Recipient: "+15551234567", Message: "hello"})
+	failed := h.Send(t, &pb.NotificationRequest{UserId: "alice", Type: "email", Recipient: "bounce@example.com", Message: "bounced"})
+	h.Send(t, &pb.NotificationRequest{UserId: "bob", Type: "sms", Recipient: "+15557654321", Message: "other user"})
+	h.WaitDeliveries(t, 2, 5*time.Second)
+
+	var entries []*pb.HistoryEntry
+	deadline := time.Now().Add(5 * time.Second)
+	for len(entries) < 2 && time.Now().Before(deadline) {
+		time.Sleep(pollInterval)
+		res, err := h.API.ListHistory(context.Background(), &pb.ListHistoryRequest{UserId: "alice"})
+		if err != nil {
+			t.Fatalf("ListHistory: %v", err)
+		}
+		entries = res.Entries
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Got %d history entries, want 2: %v", len(entries), entries)
+	}
+	byID := map[string]*pb.HistoryEntry{}
+	for _, e := range entries {
+		byID[e.NotificationId] = e
+	}
+	if e := byID[delivered]; e == nil || e.Status != "delivered" || e.Channel != "sms" || e.ProviderResponse == "" || e.ContentHash == "" {
+		t.Errorf("Delivered entry = %v", e)
+	}
+	if e := byID[failed]; e == nil || e.Status != "failed" || e.Reason == "" {
+		t.Errorf("Failed entry = %v", e)
+	}
+
+	// One entry per page.
+	res, err := h.API.ListHistory(context.Background(), &pb.ListHistoryRequest{UserId: "alice", PageSize: 1})
+	if err != nil || len(res.Entries) != 1 || res.NextPageToken == "" {
+		t.Fatalf("First page = %v, %v", res, err)
+	}
+	res, err = h.API.ListHistory(context.Background(), &pb.ListHistoryRequest{UserId: "alice", PageSize: 1, PageToken: res.NextPageToken})
+	if err != nil || len(res.Entries) != 1 || res.NextPageToken != "" {
+		t.Fatalf("Second page = %v, %v", res, err)
+	}
+	res, err = h.API.ListHistory(context.Background(), &pb.ListHistoryRequest{Status: "failed"})
+	if err != nil || len(res.Entries) != 1 || res.Entries[0].NotificationId != failed {
+		t.Fatalf("Failed entries = %v, %v", res, err)
+	}
+}
@@ -0,0 +1,309 @@
+// Package e2e runs the whole notification pipeline in process for
+// integration tests: the gRPC API, the load balancer and the worker pools
+// with the in-memory queue and limiter, a SQLite notification history, a
+// fake SMTP server and the mock SMS gateway. Tests send through the API and assert on what the fake
+// providers received.
+package e2e
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/cmd/loadbalancer"
+	"github.com/lazypanda2004/notification-system/internal/history"
+	"github.com/lazypanda2004/notification-system/internal/queue"
+	"github.com/lazypanda2004/notification-system/internal/redis"
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+	"github.com/lazypanda2004/notification-system/internal/sms"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/lazypanda2004/notification-system/internal/workerpool"
+	"github.com/lazypanda2004/notification-system/notifier"
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"github.com/lazypanda2004/notification-system/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "modernc.org/sqlite"
+)
+
+// Sender addresses of the pipeline under test.
+const (
+	EmailFrom = "notifications@example.com"
+	SMSFrom   = "+15550000000"
+)
+
+const (
+	topic           = "notifications"
+	smsAccountSID   = "AC_test"
+	smsAuthToken    = "test-token"
+	pollInterval    = 20 * time.Millisecond
+	rpcTimeout      = 5 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+// Options configure the pipeline. The zero value is a single pool with a
+// single worker, so notifications are delivered in the order they are
+// dispatched, and a limit of 100 per user and minute.
+type Options struct {
+	RateLimit int
+	Window    time.Duration
+	Pools     int
+	Workers   int              // per pool
+	Tenants   *tenant.Registry // nil for only the default tenant
+}
+
+type Harness struct {
+	API   pb.NotificationServiceClient
+	Admin pb.AdminServiceClient
+
+	SMTP    *SMTPServer
+	SMS     *sms.MockGateway
+	Limiter *redis.Limiter
+	History *history.Store
+
+	store *countingStore
+}
+
+// Start runs the pipeline until the test ends.
+func Start(t testing.TB, opts Options) *Harness {
+	t.Helper()
+	if opts.RateLimit == 0 {
+		opts.RateLimit = 100
+	}
+	if opts.Window == 0 {
+		opts.Window = time.Minute
+	}
+	opts.Pools = max(opts.Pools, 1)
+	opts.Workers = max(opts.Workers, 1)
+	tenants := opts.Tenants
+	if tenants == nil {
+		tenants, _ = tenant.LoadRegistry("")
+	}
+
+	smtpServer, err := NewSMTPServer()
+	if err != nil {
+		t.Fatalf("Failed to start fake SMTP server: %v", err)
+	}
+	t.Cleanup(func() { smtpServer.Close() })
+	smtpHost, smtpPort := smtpServer.Addr()
+
+	gateway := sms.NewMockGateway(smsAccountSID, smsAuthToken)
+	gatewayServer := httptest.NewServer(gateway)
+	t.Cleanup(gatewayServer.Close)
+
+	// Plain references are literal secrets, no keystore needed.
+	secretStore := secrets.NewStore("", secrets.Secret{})
+
+	q := queue.NewMemory()
+	t.Cleanup(func() { q.Close() })
+	store := &countingStore{MemoryStore: redis.NewMemoryStore()}
+	limiter := redis.NewLimiterWithStore(store, opts.RateLimit, opts.Window)
+	limiter.UseTenants(tenants)
+
+	historyStore, err := history.Open("sqlite", filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	t.Cleanup(func() { historyStore.Close() })
+
+	notifications := server.NewNotificationServer(q, topic)
+	notifications.SetHistoryStore(historyStore)
+
+	smsNotifier := &notifier.SMSNotifier{
+		Provider: sms.NewHTTPProvider(gatewayServer.URL, smsAccountSID, secrets.Literal(smsAuthToken)),
+		From:     SMSFrom,
+	}
+	smtpAccount := &tenant.SMTPAccount{Host: smtpHost, Port: smtpPort, Username: EmailFrom, Password: "test"}
+	var pools []*workerpool.WorkerPool
+	for range opts.Pools {
+		pool := workerpool.NewWorkerPool(opts.Workers)
+		pool.UseTenants(tenants)
+		pool.UseSMTP(smtpAccount, secretStore)
+		pool.UseHistory(historyStore)
+		pool.Register("sms", smsNotifier)
+		pool.Start()
+		t.Cleanup(pool.Stop)
+		pools = append(pools, pool)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		err := loadbalancer.Start(ctx, loadbalancer.Config{
+			Queue:   q,
+			Topic:   topic,
+			Limiter: limiter,
+			Pools:   pools,
+			History: historyStore,
+		})
+		if err != nil {
+			t.Errorf("Load balancer error: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			t.Errorf("Load balancer did not stop")
+		}
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	unary, stream := server.TenantInterceptors(tenants)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+	pb.RegisterNotificationServiceServer(grpcServer, notifications)
+	pb.RegisterAdminServiceServer(grpcServer, server.NewAdminServer(notifications, limiter, pools, nil, ""))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &Harness{
+		API:     pb.NewNotificationServiceClient(conn),
+		Admin:   pb.NewAdminServiceClient(conn),
+		SMTP:    smtpServer,
+		SMS:     gateway,
+		Limiter: limiter,
+		History: historyStore,
+		store:   store,
+	}
+}
+
+// Send sends req through the API and returns the notification id. The
+// test fails if the API does not accept it.
+func (h *Harness) Send(t testing.TB, req *pb.NotificationRequest) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	res, err := h.API.SendNotification(ctx, req)
+	if err != nil {
+		t.Fatalf("SendNotification: %v", err)
+	}
+	if !res.Success {
+		t.Fatalf("SendNotification rejected: %s", res.Message)
+	}
+	return res.NotificationId
+}
+
+// RateLimited is the number of notifications queued because their user
+// was over the rate limit or the tenant over its quota.
+func (h *Harness) RateLimited() int {
+	return int(h.store.rateLimited.Load())
+}
+
+// QueueDepth is the number of the user's notifications waiting for rate
+// limit budget, in the default tenant.
+func (h *Harness) QueueDepth(t testing.TB, userID string) int {
+	t.Helper()
+	n, err := h.Limiter.QueueDepth(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("QueueDepth: %v", err)
+	}
+	return int(n)
+}
+
+// Delivery is a message received by one of the fake providers.
+type Delivery struct {
+	Channel string // "email" or "sms"
+	To      string
+	Subject string // email only
+	Body    string // the text body of emails
+	At      time.Time
+}
+
+// Deliveries returns everything delivered so far on any channel, in the
+// order the providers received it.
+func (h *Harness) Deliveries() []Delivery {
+	var out []Delivery
+	for _, m := range h.SMTP.Messages() {
+		out = append(out, Delivery{
+			Channel: "email",
+			To:      strings.Join(m.To, ","),
+			Subject: m.Header("Subject"),
+			Body:    strings.TrimSpace(m.Text()),
+			At:      m.ReceivedAt,
+		})
+	}
+	for _, m := range h.SMS.Messages() {
+		out = append(out, Delivery{Channel: "sms", To: m.To, Body: m.Body, At: m.ReceivedAt})
+	}
+	slices.SortStableFunc(out, func(a, b Delivery) int { return a.At.Compare(b.At) })
+	return out
+}
+
+// WaitDeliveries waits until at least n messages were delivered and
+// returns them. The test fails after timeout.
+func (h *Harness) WaitDeliveries(t testing.TB, n int, timeout time.Duration) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		got := h.Deliveries()
+		if len(got) >= n {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Got %d deliveries after %s, want %d: %v", len(got), timeout, n, Bodies(got))
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// AssertDeliveryCount waits for settle and fails the test unless exactly n
+// messages were delivered by then. Use it to check nothing more arrives.
+func (h *Harness) AssertDeliveryCount(t testing.TB, n int, settle time.Duration) []Delivery {
+	t.Helper()
+	time.Sleep(settle)
+	got := h.Deliveries()
+	if len(got) != n {
+		t.Fatalf("Got %d deliveries, want %d: %v", len(got), n, Bodies(got))
+	}
+	return got
+}
+
+// Bodies returns the bodies of deliveries, in order.
+func Bodies(deliveries []Delivery) []string {
+	out := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		out[i] = d.Body
+	}
+	return out
+}
+
+// AssertOrder fails the test unless the bodies of deliveries are want, in
+// that order.
+func AssertOrder(t testing.TB, deliveries []Delivery, want ...string) {
+	t.Helper()
+	if got := Bodies(deliveries); !slices.Equal(got, want) {
+		t.Fatalf("Delivered %q, want %q", got, want)
+	}
+}
+
+// countingStore counts the tasks the limiter queues over the limit. Tasks
+// put back at the front of a queue, e.g. when the pools are full, were
+// counted when first queued.
+type countingStore struct {
+	*redis.MemoryStore
+	rateLimited atomic.Int64
+}
+
+func (s *countingStore) Push(ctx context.Context, task redis.QueuedTask, front bool) error {
+	if !front {
+		s.rateLimited.Add(1)
+	}
+	return s.MemoryStore.Push(ctx, task, front)
+}
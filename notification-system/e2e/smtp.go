@@ -0,0 +1,239 @@
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a message accepted by the fake SMTP server.
+type Email struct {
+	From       string
+	To         []string // envelope recipients, including Bcc
+	Data       []byte   // the message as sent, headers and body
+	ReceivedAt time.Time
+}
+
+// Header returns the named header of the message, decoded, or "" if the
+// message is unreadable.
+func (e Email) Header(name string) string {
+	msg, err := mail.ReadMessage(bytes.NewReader(e.Data))
+	if err != nil {
+		return ""
+	}
+	v := msg.Header.Get(name)
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(v); err == nil {
+		return decoded
+	}
+	return v
+}
+
+// Text returns the decoded text/plain body, which the pipeline derives from
+// the HTML body when there is no text one, or "" if there is none.
+func (e Email) Text() string {
+	msg, err := mail.ReadMessage(bytes.NewReader(e.Data))
+	if err != nil {
+		return ""
+	}
+	return textPart(textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+func textPart(header textproto.MIMEHeader, body io.Reader) string {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	if mediaType == "text/plain" {
+		if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		data, _ := io.ReadAll(body)
+		return string(data)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return ""
+	}
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		// Raw parts keep their transfer encoding, which textPart undoes.
+		part, err := mr.NextRawPart()
+		if err != nil {
+			return ""
+		}
+		if text := textPart(part.Header, part); text != "" {
+			return text
+		}
+	}
+}
+
+// SMTPServer is a fake mail relay that accepts any credentials and records
+// every message. It speaks just enough SMTP for net/smtp.SendMail.
+type SMTPServer struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Email
+	rejected map[string]bool
+}
+
+// NewSMTPServer listens on a free port of 127.0.0.1, where net/smtp allows
+// plain authentication without TLS.
+func NewSMTPServer() (*SMTPServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SMTPServer{ln: ln, rejected: make(map[string]bool)}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host and port the server listens on.
+func (s *SMTPServer) Addr() (host, port string) {
+	host, port, _ = net.SplitHostPort(s.ln.Addr().String())
+	return host, port
+}
+
+// Reject makes the server refuse mail for addr with a permanent error.
+func (s *SMTPServer) Reject(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[strings.ToLower(addr)] = true
+}
+
+// Messages returns a copy of everything accepted so far, oldest first.
+func (s *SMTPServer) Messages() []Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Email(nil), s.messages...)
+}
+
+func (s *SMTPServer) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			if err := s.session(conn); err != nil && err != io.EOF {
+				log.Printf("Fake SMTP session error: %v", err)
+			}
+		}()
+	}
+}
+
+func (s *SMTPServer) session(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) error {
+		_, err := fmt.Fprintf(conn, format+"\r\n", args...)
+		return err
+	}
+
+	if err := reply("220 localhost fake ESMTP"); err != nil {
+		return err
+	}
+	var msg Email
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			err = reply("250-localhost\r\n250-8BITMIME\r\n250 AUTH PLAIN")
+		case "HELO":
+			err = reply("250 localhost")
+		case "AUTH":
+			err = reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			msg = Email{From: address(arg)}
+			err = reply("250 2.1.0 OK")
+		case "RCPT":
+			to := address(arg)
+			s.mu.Lock()
+			rejected := s.rejected[strings.ToLower(to)]
+			s.mu.Unlock()
+			if rejected {
+				err = reply("550 5.1.1 No such user %s", to)
+				break
+			}
+			msg.To = append(msg.To, to)
+			err = reply("250 2.1.5 OK")
+		case "DATA":
+			if err = reply("354 End data with <CR><LF>.<CR><LF>"); err != nil {
+				return err
+			}
+			if msg.Data, err = readData(r); err != nil {
+				return err
+			}
+			msg.ReceivedAt = time.Now()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			err = reply("250 2.0.0 OK")
+		case "RSET":
+			msg = Email{}
+			err = reply("250 2.0.0 OK")
+		case "NOOP":
+			err = reply("250 2.0.0 OK")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return nil
+		default:
+			err = reply("502 5.5.2 Command not implemented")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readData reads a DATA section up to the terminating dot, undoing the dot
+// stuffing.
+func readData(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return buf.Bytes(), nil
+		}
+		buf.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+// address extracts the mailbox from "FROM:<a@b>" or "TO:<a@b> SIZE=1".
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
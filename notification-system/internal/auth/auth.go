@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+)
+
+// Permission scopes. Admin implies every other scope.
+const (
+	ScopeSend       = "send"
+	ScopeReadStatus = "read-status"
+	ScopeAdmin      = "admin"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject string // API key id or JWT subject
+	Tenant  string
+	Scopes  []string
+}
+
+// Allows reports whether the principal holds scope.
+func (p *Principal) Allows(scope string) bool {
+	return slices.Contains(p.Scopes, ScopeAdmin) || slices.Contains(p.Scopes, scope)
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the authenticated caller, or nil.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Authenticator accepts API keys and HS256 JWTs. Either may be left unset.
+// The JWT secret is read on every call, so a rotated secret applies at once.
+type Authenticator struct {
+	Keys      *KeyStore
+	JWTSecret *secrets.Value
+	JWTIssuer string // checked when set
+}
+
+// Authenticate resolves a bearer token. Tokens with two dots are treated as
+// JWTs, anything else as an API key.
+func (a *Authenticator) Authenticate(token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	if strings.Count(token, ".") == 2 {
+		secret := a.JWTSecret.Get()
+		if secret.Empty() {
+			return nil, ErrInvalidCredentials
+		}
+		claims, err := ParseJWT(token, []byte(secret.Reveal()), a.JWTIssuer)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Subject: claims.Subject, Tenant: claims.Tenant, Scopes: claims.ScopeList()}, nil
+	}
+
+	if a.Keys == nil {
+		return nil, ErrInvalidCredentials
+	}
+	k := a.Keys.Lookup(token)
+	if k == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: k.ID, Tenant: k.Tenant, Scopes: k.Scopes}, nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJWT(t *testing.T) {
+	secret := []byte("jwt-secret")
+	now := time.Now()
+	valid := Claims{Subject: "svc", Issuer: "issuer", Tenant: "acme", Scope: "send read-status", ExpiresAt: now.Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name   string
+		claims func(c *Claims)
+		secret []byte // signed with, the parsing secret if nil
+		issuer string
+		tamper func(token string) string
+		ok     bool
+	}{
+		{name: "valid", ok: true},
+		{name: "issuer matches", issuer: "issuer", ok: true},
+		{name: "wrong issuer", issuer: "other"},
+		{name: "wrong secret", secret: []byte("other-secret")},
+		{name: "no exp", claims: func(c *Claims) { c.ExpiresAt = 0 }},
+		{name: "expired", claims: func(c *Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }},
+		{name: "expired within the clock skew", claims: func(c *Claims) { c.ExpiresAt = now.Add(-10 * time.Second).Unix() }, ok: true},
+		{name: "not valid yet", claims: func(c *Claims) { c.NotBefore = now.Add(time.Minute).Unix() }},
+		{name: "nbf within the clock skew", claims: func(c *Claims) { c.NotBefore = now.Add(10 * time.Second).Unix() }, ok: true},
+		{
+			name: "payload changed after signing",
+			tamper: func(token string) string {
+				parts := strings.Split(token, ".")
+				parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"svc","scope":"admin","exp":9999999999}`))
+				return strings.Join(parts, ".")
+			},
+		},
+		{
+			name: "alg none",
+			tamper: func(token string) string {
+				parts := strings.Split(token, ".")
+				parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+				return parts[0] + "." + parts[1] + "."
+			},
+		},
+		{name: "signature stripped", tamper: func(token string) string { return token[:strings.LastIndex(token, ".")+1] }},
+		{name: "not a jwt", tamper: func(string) string { return "a.b" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			if tt.claims != nil {
+				tt.claims(&c)
+			}
+			signWith := tt.secret
+			if signWith == nil {
+				signWith = secret
+			}
+			token, err := SignJWT(&c, signWith)
+			if err != nil {
+				t.Fatalf("SignJWT: %v", err)
+			}
+			if tt.tamper != nil {
+				token = tt.tamper(token)
+			}
+
+			got, err := ParseJWT(token, secret, tt.issuer)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("ParseJWT error = %v, want %v", err, ErrInvalidCredentials)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJWT: %v", err)
+			}
+			if *got != c {
+				t.Errorf("claims = %+v, want %+v", *got, c)
+			}
+		})
+	}
+}
+
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope string
+		want  map[string]bool
+	}{
+		{"none", "", map[string]bool{ScopeSend: false, ScopeReadStatus: false, ScopeAdmin: false}},
+		{"send", "send", map[string]bool{ScopeSend: true, ScopeReadStatus: false, ScopeAdmin: false}},
+		{"extra spaces", "  send   read-status ", map[string]bool{ScopeSend: true, ScopeReadStatus: true, ScopeAdmin: false}},
+		{"admin allows everything", "admin", map[string]bool{ScopeSend: true, ScopeReadStatus: true, ScopeAdmin: true}},
+		{"unknown scopes are ignored", "sendx read", map[string]bool{ScopeSend: false, ScopeReadStatus: false, ScopeAdmin: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claims{Scope: tt.scope}
+			p := &Principal{Scopes: c.ScopeList()}
+			for scope, want := range tt.want {
+				if got := p.Allows(scope); got != want {
+					t.Errorf("Allows(%s) = %v, want %v", scope, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// APIKey is a provisioned key. Only the SHA-256 of the key is stored.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Tenant string   `json:"tenant"`
+	Scopes []string `json:"scopes"`
+	Hash   string   `json:"hash"`
+}
+
+// KeyStore holds the API keys, indexed by hash.
+type KeyStore struct {
+	byHash map[string]*APIKey
+}
+
+// LoadKeys reads a JSON array of APIKey from path. A missing file gives an
+// empty store.
+func LoadKeys(path string) (*KeyStore, error) {
+	s := &KeyStore{byHash: make(map[string]*APIKey)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, k := range keys {
+		if k.ID == "" || k.Hash == "" {
+			return nil, fmt.Errorf("api key %q needs an id and a hash", k.ID)
+		}
+		for _, scope := range k.Scopes {
+			switch scope {
+			case ScopeSend, ScopeReadStatus, ScopeAdmin:
+			default:
+				return nil, fmt.Errorf("api key %q: unknown scope %q", k.ID, scope)
+			}
+		}
+		s.byHash[k.Hash] = k
+	}
+	return s, nil
+}
+
+// Len is the number of keys in the store.
+func (s *KeyStore) Len() int {
+	return len(s.byHash)
+}
+
+// Lookup returns the key matching the presented secret, or nil.
+func (s *KeyStore) Lookup(key string) *APIKey {
+	return s.byHash[HashKey(key)]
+}
+
+// HashKey is the value stored in APIKey.Hash for key.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewKey generates a random API key.
+func NewKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "nsk_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+// Package config holds the settings that can be changed while the server
+// runs. Everything else is fixed at startup in main.go.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+type Config struct {
+	RateLimit  int      `json:"rate_limit"`  // per user and window
+	TimeWindow Duration `json:"time_window"` // e.g. "1m"
+	Workers    int      `json:"workers"`     // per worker pool
+
+	SMS  SMS  `json:"sms"`
+	Push Push `json:"push"`
+}
+
+type SMS struct {
+	ProviderURL     string  `json:"provider_url"`
+	PricePerSegment float64 `json:"price_per_segment"`
+	MaxSegments     int     `json:"max_segments"` // 0 for no limit
+}
+
+type Push struct {
+	FCMBaseURL   string   `json:"fcm_base_url"`
+	FCMProjectID string   `json:"fcm_project_id"`
+	APNsBaseURL  string   `json:"apns_base_url"`
+	APNsTopic    string   `json:"apns_topic"`
+	Timeout      Duration `json:"timeout"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Load reads path over a copy of defaults, so the file only needs the
+// settings it changes, and validates the result. A missing file gives the
+// defaults.
+func Load(path string, defaults Config) (Config, error) {
+	cfg := defaults
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, cfg.Validate()
+	} else if err != nil {
+		return Config{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields() // catch misspelt settings instead of ignoring them
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.RateLimit < 1 {
+		errs = append(errs, fmt.Errorf("rate_limit must be positive, got %d", c.RateLimit))
+	}
+	if c.TimeWindow.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("time_window must be positive, got %s", c.TimeWindow))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("workers must be positive, got %d", c.Workers))
+	}
+	if err := validURL(c.SMS.ProviderURL); err != nil {
+		errs = append(errs, fmt.Errorf("sms.provider_url: %w", err))
+	}
+	if c.SMS.PricePerSegment < 0 || c.SMS.MaxSegments < 0 {
+		errs = append(errs, errors.New("sms.price_per_segment and sms.max_segments must not be negative"))
+	}
+	if err := validURL(c.Push.FCMBaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("push.fcm_base_url: %w", err))
+	}
+	if err := validURL(c.Push.APNsBaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("push.apns_base_url: %w", err))
+	}
+	if c.Push.Timeout.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("push.timeout must be positive, got %s", c.Push.Timeout))
+	}
+	return errors.Join(errs...)
+}
+
+func validURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", s)
+	}
+	return nil
+}
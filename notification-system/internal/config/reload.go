@@ -0,0 +1,133 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Applier puts a config into effect in one component. On rollback it is
+// called again with the previous config.
+type Applier func(Config) error
+
+type component struct {
+	name  string
+	apply Applier
+}
+
+// Reloader re-reads the config file on SIGHUP or when the file changes. A
+// new config is validated first and then applied component by component;
+// if any component rejects it, the components already changed are put back
+// on the previous config and the previous config stays current.
+type Reloader struct {
+	path     string
+	defaults Config
+
+	mu         sync.Mutex
+	current    Config
+	mtime      time.Time
+	components []component
+}
+
+// NewReloader loads the initial config, see Load.
+func NewReloader(path string, defaults Config) (*Reloader, error) {
+	cfg, err := Load(path, defaults)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloader{path: path, defaults: defaults, current: cfg}
+	r.mtime, _ = modTime(path)
+	return r, nil
+}
+
+// Current is the config in effect.
+func (r *Reloader) Current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnChange registers a component. Components are applied in the order they
+// were registered. Register them before Watch.
+func (r *Reloader) OnChange(name string, apply Applier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components = append(r.components, component{name: name, apply: apply})
+}
+
+// Reload reads the config file and applies it.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mtime, _ = modTime(r.path)
+	next, err := Load(r.path, r.defaults)
+	if err != nil {
+		return fmt.Errorf("invalid config, keeping the current one: %w", err)
+	}
+	if next == r.current {
+		return nil
+	}
+
+	for i, c := range r.components {
+		if err := c.apply(next); err != nil {
+			err = fmt.Errorf("%s rejected the config: %w", c.name, err)
+			for j := i - 1; j >= 0; j-- {
+				if rbErr := r.components[j].apply(r.current); rbErr != nil {
+					err = errors.Join(err, fmt.Errorf("rolling back %s: %w", r.components[j].name, rbErr))
+				}
+			}
+			return err
+		}
+	}
+	r.current = next
+	log.Printf("Config reloaded from %s", r.path)
+	return nil
+}
+
+// Watch reloads on SIGHUP and whenever the file's modification time
+// changes, checked every interval, until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("SIGHUP received, reloading config")
+		case <-ticker.C:
+			mtime, _ := modTime(r.path)
+			r.mu.Lock()
+			changed := !mtime.Equal(r.mtime)
+			r.mu.Unlock()
+			if !changed {
+				continue
+			}
+		}
+		if err := r.Reload(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+		}
+	}
+}
+
+// modTime is the zero time for a missing file, so deleting the file is
+// noticed as a change back to the defaults.
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
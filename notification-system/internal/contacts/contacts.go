@@ -0,0 +1,250 @@
+package contacts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	netmail "net/mail"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// Contact point channels. Device tokens for push live in the push device
+// registry, which the push notifier reads directly.
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+const (
+	codeTTL         = 10 * time.Minute
+	maxCodeAttempts = 5
+)
+
+var (
+	ErrNotFound       = errors.New("contact not found")
+	ErrNoContact      = errors.New("no verified contact")
+	ErrInvalidCode    = errors.New("invalid or expired verification code")
+	ErrTooManyTries   = errors.New("too many verification attempts, request a new code")
+	ErrInvalidChannel = errors.New(`channel must be "email" or "sms"`)
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// Contact is an email address or phone number of a user. Only verified
+// contacts are used to resolve recipients.
+type Contact struct {
+	Channel    string `json:"channel"`
+	Address    string `json:"address"`
+	Verified   bool   `json:"verified"`
+	Primary    bool   `json:"primary"`
+	CreatedAt  int64  `json:"created_at"`
+	VerifiedAt int64  `json:"verified_at,omitempty"`
+
+	CodeHash    string `json:"code_hash,omitempty"`
+	CodeExpires int64  `json:"code_expires,omitempty"`
+	Attempts    int    `json:"attempts,omitempty"`
+}
+
+// Store is the contact directory, one Redis hash per user keyed by address.
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(addr string) *Store {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Store{rdb: rdb}
+}
+
+func contactsKey(ctx context.Context, userID string) string {
+	return tenant.Key(ctx, fmt.Sprintf("contacts:%s", userID))
+}
+
+// Add stores an unverified contact and returns it with the verification code
+// that has to be sent to the address. Adding an existing address issues a
+// new code and keeps its verified state.
+func (s *Store) Add(ctx context.Context, userID, channel, address string, primary bool) (*Contact, string, error) {
+	address, err := normalize(channel, address)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c, err := s.Get(ctx, userID, address)
+	if err == ErrNotFound {
+		c = &Contact{Channel: channel, Address: address, CreatedAt: time.Now().Unix()}
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	code := newCode()
+	c.CodeHash = hashCode(code)
+	c.CodeExpires = time.Now().Add(codeTTL).Unix()
+	c.Attempts = 0
+	c.Primary = c.Primary || primary
+	if err := s.save(ctx, userID, c); err != nil {
+		return nil, "", err
+	}
+	if primary {
+		if err := s.setPrimary(ctx, userID, c); err != nil {
+			return nil, "", err
+		}
+	}
+	return c, code, nil
+}
+
+// Verify marks the contact as verified if code matches the last one issued.
+func (s *Store) Verify(ctx context.Context, userID, address, code string) (*Contact, error) {
+	c, err := s.Get(ctx, userID, address)
+	if err != nil {
+		return nil, err
+	}
+	if c.CodeHash == "" || time.Now().Unix() >= c.CodeExpires {
+		return nil, ErrInvalidCode
+	}
+	if c.Attempts >= maxCodeAttempts {
+		return nil, ErrTooManyTries
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(code)), []byte(c.CodeHash)) != 1 {
+		c.Attempts++
+		if err := s.save(ctx, userID, c); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCode
+	}
+
+	c.Verified = true
+	c.VerifiedAt = time.Now().Unix()
+	c.CodeHash, c.CodeExpires, c.Attempts = "", 0, 0
+	if err := s.save(ctx, userID, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Store) Get(ctx context.Context, userID, address string) (*Contact, error) {
+	data, err := s.rdb.HGet(ctx, contactsKey(ctx, userID), address).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var c Contact
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// List returns the user's contacts, primary and oldest first.
+func (s *Store) List(ctx context.Context, userID string) ([]*Contact, error) {
+	all, err := s.rdb.HGetAll(ctx, contactsKey(ctx, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []*Contact
+	for _, data := range all {
+		var c Contact
+		if err := json.Unmarshal([]byte(data), &c); err != nil {
+			continue
+		}
+		out = append(out, &c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Primary != out[j].Primary {
+			return out[i].Primary
+		}
+		if out[i].CreatedAt != out[j].CreatedAt {
+			return out[i].CreatedAt < out[j].CreatedAt
+		}
+		return out[i].Address < out[j].Address
+	})
+	return out, nil
+}
+
+// Delete removes a contact and reports whether it existed.
+func (s *Store) Delete(ctx context.Context, userID, address string) (bool, error) {
+	removed, err := s.rdb.HDel(ctx, contactsKey(ctx, userID), address).Result()
+	return removed > 0, err
+}
+
+// Resolve returns the address to deliver to on channel: the primary verified
+// contact of that channel, or else the oldest verified one.
+func (s *Store) Resolve(ctx context.Context, userID, channel string) (string, error) {
+	all, err := s.List(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range all {
+		if c.Channel == channel && c.Verified {
+			return c.Address, nil
+		}
+	}
+	return "", fmt.Errorf("%w for %s", ErrNoContact, channel)
+}
+
+// setPrimary clears the primary flag of the user's other contacts on the
+// same channel.
+func (s *Store) setPrimary(ctx context.Context, userID string, primary *Contact) error {
+	all, err := s.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range all {
+		if c.Channel != primary.Channel || c.Address == primary.Address || !c.Primary {
+			continue
+		}
+		c.Primary = false
+		if err := s.save(ctx, userID, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) save(ctx context.Context, userID string, c *Contact) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.rdb.HSet(ctx, contactsKey(ctx, userID), c.Address, data).Err()
+}
+
+func normalize(channel, address string) (string, error) {
+	switch channel {
+	case ChannelEmail:
+		a, err := netmail.ParseAddress(address)
+		if err != nil {
+			return "", fmt.Errorf("invalid email address %q", address)
+		}
+		return a.Address, nil
+	case ChannelSMS:
+		if !e164.MatchString(address) {
+			return "", fmt.Errorf("invalid phone number %q, want E.164 such as +15551234567", address)
+		}
+		return address, nil
+	}
+	return "", ErrInvalidChannel
+}
+
+func newCode() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(1000000))
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
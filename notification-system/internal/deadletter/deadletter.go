@@ -0,0 +1,96 @@
+// Package deadletter keeps notifications that failed on every channel in a
+// topic of the notification queue, so they can be inspected and replayed
+// once the cause is fixed.
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/queue"
+)
+
+// Replayed dead letters are acknowledged under this consumer group, so each
+// one is replayed once.
+const replayGroup = "dead-letter-replay"
+
+// Waiting this long for the next dead letter ends a replay. The first read
+// waits longer since joining a Kafka consumer group takes a few seconds.
+const (
+	firstReadTimeout = 15 * time.Second
+	readTimeout      = 2 * time.Second
+)
+
+// Topic is the dead-letter topic of a notification topic.
+func Topic(base string) string {
+	return base + ".dlq"
+}
+
+// Letter is a dead notification. Value is the task as it was consumed from
+// the notification topic.
+type Letter struct {
+	Key      string
+	Value    []byte
+	Reason   string
+	FailedAt time.Time
+}
+
+// reasonHeader carries why the notification failed.
+const reasonHeader = "reason"
+
+type Writer struct {
+	q     queue.Queue
+	topic string
+}
+
+func NewWriter(q queue.Queue, topic string) *Writer {
+	return &Writer{q: q, topic: topic}
+}
+
+// Publish stores task, keyed by its user, with the reason it failed.
+func (w *Writer) Publish(ctx context.Context, key string, task any, reason string) error {
+	value, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return w.q.Publish(ctx, queue.Message{
+		Topic:   w.topic,
+		Key:     []byte(key),
+		Value:   value,
+		Headers: map[string]string{reasonHeader: reason},
+	})
+}
+
+// Replay hands up to limit dead letters that were not replayed before to
+// fn, oldest first. A letter counts as replayed once fn returns nil; the
+// first error stops the replay and that letter is offered again later.
+func Replay(ctx context.Context, q queue.Queue, topic string, limit int, fn func(Letter) error) (int, error) {
+	reader := q.Reader(topic, replayGroup)
+	defer reader.Close()
+
+	replayed := 0
+	timeout := firstReadTimeout
+	for replayed < limit {
+		readCtx, cancel := context.WithTimeout(ctx, timeout)
+		m, err := reader.Read(readCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			break // caught up
+		} else if err != nil {
+			return replayed, err
+		}
+		timeout = readTimeout
+
+		letter := Letter{Key: string(m.Key), Value: m.Value, Reason: m.Headers[reasonHeader], FailedAt: m.Time}
+		if err := fn(letter); err != nil {
+			return replayed, err
+		}
+		if err := reader.Ack(ctx, m); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
@@ -0,0 +1,313 @@
+// Package history keeps an append-only record of what became of each
+// notification: delivered, failed, expired, suppressed or cancelled, with
+// a hash of the content that was sent and the provider's response. It is
+// stored through database/sql in SQLite or Postgres.
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/status"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
+
+// Page sizes of List.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 1000
+)
+
+// The schema is valid in SQLite and Postgres. Times are unix milliseconds.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS notification_history (
+		event_id          TEXT PRIMARY KEY,
+		tenant_id         TEXT NOT NULL,
+		notification_id   TEXT NOT NULL,
+		user_id           TEXT NOT NULL,
+		channel           TEXT NOT NULL,
+		recipient         TEXT NOT NULL,
+		status            TEXT NOT NULL,
+		reason            TEXT NOT NULL,
+		template_id       TEXT NOT NULL,
+		content_hash      TEXT NOT NULL,
+		provider_response TEXT NOT NULL,
+		started_at        BIGINT NOT NULL,
+		recorded_at       BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS notification_history_user
+		ON notification_history (tenant_id, user_id, event_id)`,
+	`CREATE INDEX IF NOT EXISTS notification_history_recorded
+		ON notification_history (recorded_at)`,
+}
+
+const columns = `event_id, tenant_id, notification_id, user_id, channel, recipient, status,
+	reason, template_id, content_hash, provider_response, started_at, recorded_at`
+
+// Entry is the outcome of one notification on one channel. A notification
+// that fell back to another channel has an entry for the final one.
+type Entry struct {
+	EventID          string // assigned by Record, sorts by time
+	TenantID         string
+	NotificationID   string
+	UserID           string
+	Channel          string
+	Recipient        string
+	Status           string
+	Reason           string
+	TemplateID       string
+	ContentHash      string // see Hash
+	ProviderResponse string
+	StartedAt        time.Time // when a worker picked it up, zero if none did
+	RecordedAt       time.Time
+}
+
+// Query selects entries of the tenant of the context. Empty fields match
+// everything.
+type Query struct {
+	UserID  string
+	Channel string
+	Status  string
+	From    time.Time // inclusive
+	To      time.Time // exclusive
+	Limit   int
+	// After is the page token returned with the previous page.
+	After string
+}
+
+// Retention is how long entries are kept: Default for every tenant not in
+// Tenants. Zero keeps entries forever.
+type Retention struct {
+	Default time.Duration
+	Tenants map[string]time.Duration
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+// Open connects with a database/sql driver, "sqlite" or "pgx", and creates
+// the table if needed.
+func Open(driver, dsn string) (*Store, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// SQLite has a single writer; one connection avoids busy errors.
+		db.SetMaxOpenConns(1)
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create history table: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Final reports whether state ends a notification and belongs in the
+// history.
+func Final(state string) bool {
+	switch state {
+	case status.Cancelled, status.Suppressed, status.Expired, status.Delivered, status.Failed:
+		return true
+	}
+	return false
+}
+
+// Hash fingerprints the rendered content, e.g. subject and body, so the
+// history shows what was sent without keeping it.
+func Hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:%s", len(p), p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newEventID is the current time followed by random bits, so ids sort in
+// the order they were recorded.
+func newEventID(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%019d-%s", t.UnixNano(), hex.EncodeToString(b))
+}
+
+// Record appends e to the history of the tenant of ctx.
+func (s *Store) Record(ctx context.Context, e Entry) error {
+	if e.RecordedAt.IsZero() {
+		e.RecordedAt = time.Now()
+	}
+	e.EventID = newEventID(e.RecordedAt)
+	e.TenantID = tenant.FromContext(ctx)
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO notification_history (`+columns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		e.EventID, e.TenantID, e.NotificationID, e.UserID, e.Channel, e.Recipient, e.Status,
+		e.Reason, e.TemplateID, e.ContentHash, e.ProviderResponse, millis(e.StartedAt), millis(e.RecordedAt))
+	return err
+}
+
+// List returns a page of entries, newest first, and the token of the next
+// page, empty on the last one.
+func (s *Store) List(ctx context.Context, q Query) ([]Entry, string, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	add("tenant_id = $%d", tenant.FromContext(ctx))
+	if q.UserID != "" {
+		add("user_id = $%d", q.UserID)
+	}
+	if q.Channel != "" {
+		add("channel = $%d", q.Channel)
+	}
+	if q.Status != "" {
+		add("status = $%d", q.Status)
+	}
+	if !q.From.IsZero() {
+		add("recorded_at >= $%d", millis(q.From))
+	}
+	if !q.To.IsZero() {
+		add("recorded_at < $%d", millis(q.To))
+	}
+	if q.After != "" {
+		add("event_id < $%d", q.After)
+	}
+	// One extra row tells whether there is a next page.
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM notification_history WHERE %s ORDER BY event_id DESC LIMIT $%d`,
+		columns, strings.Join(where, " AND "), len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var (
+			e                   Entry
+			started, recordedAt int64
+		)
+		err := rows.Scan(&e.EventID, &e.TenantID, &e.NotificationID, &e.UserID, &e.Channel, &e.Recipient, &e.Status,
+			&e.Reason, &e.TemplateID, &e.ContentHash, &e.ProviderResponse, &started, &recordedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		e.StartedAt, e.RecordedAt = fromMillis(started), fromMillis(recordedAt)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+		return entries, entries[limit-1].EventID, nil
+	}
+	return entries, "", nil
+}
+
+// Prune deletes the entries older than their tenant's retention and
+// returns how many.
+func (s *Store) Prune(ctx context.Context, r Retention) (int64, error) {
+	var (
+		deleted int64
+		own     []any // tenants with their own retention
+	)
+	exec := func(query string, args ...any) error {
+		res, err := s.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		deleted += n
+		return nil
+	}
+
+	for id, keep := range r.Tenants {
+		own = append(own, id)
+		if keep <= 0 {
+			continue
+		}
+		err := exec(`DELETE FROM notification_history WHERE tenant_id = $1 AND recorded_at < $2`,
+			id, millis(time.Now().Add(-keep)))
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if r.Default <= 0 {
+		return deleted, nil
+	}
+
+	query := `DELETE FROM notification_history WHERE recorded_at < $1`
+	args := []any{millis(time.Now().Add(-r.Default))}
+	if len(own) > 0 {
+		placeholders := make([]string, len(own))
+		for i := range own {
+			placeholders[i] = fmt.Sprintf("$%d", i+2)
+		}
+		query += ` AND tenant_id NOT IN (` + strings.Join(placeholders, ", ") + `)`
+		args = append(args, own...)
+	}
+	err := exec(query, args...)
+	return deleted, err
+}
+
+// Retain prunes every interval until ctx is done.
+func (s *Store) Retain(ctx context.Context, r Retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.Prune(ctx, r)
+		if err != nil {
+			log.Printf("Failed to prune notification history: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d notification history entries", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,340 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Attachment is a file sent with an email. Setting ContentID makes it an
+// inline part that the HTML body can reference as "cid:<ContentID>".
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+	ContentID   string `json:"content_id"`
+}
+
+// Message is an email ready to be serialized with Bytes.
+type Message struct {
+	From        string
+	ReplyTo     string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	HTML        string
+	Text        string
+	Attachments []Attachment
+	Date        time.Time
+	MessageID   string
+}
+
+// Recipients returns every envelope recipient, including Bcc.
+func (m *Message) Recipients() []string {
+	var out []string
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, addr := range list {
+			if a, err := mail.ParseAddress(addr); err == nil {
+				out = append(out, a.Address)
+			}
+		}
+	}
+	return out
+}
+
+// Bytes renders the message as RFC 5322 text. The body is a
+// multipart/alternative of text and HTML, wrapped in multipart/related when
+// there are inline images and in multipart/mixed when there are attachments.
+func (m *Message) Bytes() ([]byte, error) {
+	if len(m.To) == 0 {
+		return nil, errors.New("mail: no recipients")
+	}
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid from address %q: %w", m.From, err)
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = newMessageID(from.Address)
+	}
+	text := m.Text
+	if text == "" && m.HTML != "" {
+		text = htmlToText(m.HTML)
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", from.String())
+	if err := writeAddressList(&buf, "To", m.To); err != nil {
+		return nil, err
+	}
+	if err := writeAddressList(&buf, "Cc", m.Cc); err != nil {
+		return nil, err
+	}
+	if m.ReplyTo != "" {
+		if err := writeAddressList(&buf, "Reply-To", []string{m.ReplyTo}); err != nil {
+			return nil, err
+		}
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", "<"+messageID+">")
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	var inline, attached []Attachment
+	for _, a := range m.Attachments {
+		if a.ContentID != "" {
+			if !validContentID(a.ContentID) {
+				return nil, fmt.Errorf("mail: invalid content ID %q", a.ContentID)
+			}
+			inline = append(inline, a)
+		} else {
+			attached = append(attached, a)
+		}
+	}
+
+	body := func(w partWriter) error {
+		if len(inline) == 0 {
+			return writeAlternative(w, text, m.HTML)
+		}
+		related, err := w.nested("multipart/related")
+		if err != nil {
+			return err
+		}
+		if err := writeAlternative(related, text, m.HTML); err != nil {
+			return err
+		}
+		for _, a := range inline {
+			if err := writeAttachment(related, a, "inline"); err != nil {
+				return err
+			}
+		}
+		return related.close()
+	}
+
+	root := &topLevel{buf: &buf}
+	if len(attached) == 0 {
+		if err := body(root); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed, err := root.nested("multipart/mixed")
+	if err != nil {
+		return nil, err
+	}
+	if err := body(mixed); err != nil {
+		return nil, err
+	}
+	for _, a := range attached {
+		if err := writeAttachment(mixed, a, "attachment"); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// partWriter abstracts over the top-level message and a multipart body so
+// the same code can write a part at either level.
+type partWriter interface {
+	part(header textproto.MIMEHeader) (io.Writer, error)
+	nested(contentType string) (*multipartWriter, error)
+}
+
+type topLevel struct {
+	buf *bytes.Buffer
+}
+
+func (t *topLevel) part(header textproto.MIMEHeader) (io.Writer, error) {
+	for k, v := range header {
+		writeHeader(t.buf, k, v[0])
+	}
+	t.buf.WriteString("\r\n")
+	return t.buf, nil
+}
+
+func (t *topLevel) nested(contentType string) (*multipartWriter, error) {
+	mw := multipart.NewWriter(t.buf)
+	writeHeader(t.buf, "Content-Type", fmt.Sprintf("%s; boundary=%q", contentType, mw.Boundary()))
+	t.buf.WriteString("\r\n")
+	return &multipartWriter{mw: mw}, nil
+}
+
+type multipartWriter struct {
+	mw *multipart.Writer
+}
+
+func (m *multipartWriter) part(header textproto.MIMEHeader) (io.Writer, error) {
+	return m.mw.CreatePart(header)
+}
+
+func (m *multipartWriter) nested(contentType string) (*multipartWriter, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	w, err := m.mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("%s; boundary=%q", contentType, boundary)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	inner := multipart.NewWriter(w)
+	return &multipartWriter{mw: inner}, inner.SetBoundary(boundary)
+}
+
+func (m *multipartWriter) close() error {
+	return m.mw.Close()
+}
+
+func writeAlternative(w partWriter, text, htmlBody string) error {
+	if htmlBody == "" {
+		return writeTextPart(w, "text/plain", text)
+	}
+	alt, err := w.nested("multipart/alternative")
+	if err != nil {
+		return err
+	}
+	if err := writeTextPart(alt, "text/plain", text); err != nil {
+		return err
+	}
+	if err := writeTextPart(alt, "text/html", htmlBody); err != nil {
+		return err
+	}
+	return alt.close()
+}
+
+func writeTextPart(w partWriter, contentType, body string) error {
+	pw, err := w.part(textproto.MIMEHeader{
+		"Content-Type":              {contentType + `; charset="UTF-8"`},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(pw)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeAttachment(w partWriter, a Attachment, disposition string) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(extension(a.Filename))
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	typeParams, dispParams := map[string]string{}, map[string]string{}
+	if a.Filename != "" {
+		typeParams["name"] = a.Filename
+		dispParams["filename"] = a.Filename
+	}
+	header := textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, typeParams)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType(disposition, dispParams)},
+	}
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+a.ContentID+">")
+	}
+
+	pw, err := w.part(header)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(a.Content)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(pw, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(pw, encoded+"\r\n")
+	return err
+}
+
+// validContentID reports whether id can go between the angle brackets of a
+// Content-ID header: printable ASCII without spaces or brackets.
+func validContentID(id string) bool {
+	for _, c := range id {
+		if c <= ' ' || c > '~' || c == '<' || c == '>' {
+			return false
+		}
+	}
+	return true
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key + ": " + value + "\r\n")
+}
+
+func writeAddressList(buf *bytes.Buffer, key string, addrs []string) error {
+	if len(addrs) == 0 {
+		return nil
+	}
+	var out []string
+	for _, addr := range addrs {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("mail: invalid %s address %q: %w", strings.ToLower(key), addr, err)
+		}
+		out = append(out, a.String())
+	}
+	writeHeader(buf, key, strings.Join(out, ", "))
+	return nil
+}
+
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b) + "@" + domain
+}
+
+func extension(filename string) string {
+	if dot := strings.LastIndex(filename, "."); dot >= 0 {
+		return filename[dot:]
+	}
+	return ""
+}
+
+var (
+	blockTags = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/h[1-6]|/li)[^>]*>`)
+	anyTag    = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankRuns = regexp.MustCompile(`\n\s*\n\s*(\n\s*)+`)
+)
+
+// htmlToText derives a readable plain-text alternative from an HTML body.
+func htmlToText(body string) string {
+	text := blockTags.ReplaceAllString(body, "\n")
+	text = anyTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankRuns.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
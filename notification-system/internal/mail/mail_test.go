@@ -0,0 +1,183 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBytes(t *testing.T) {
+	pdf := Attachment{Filename: "invoice.pdf", Content: bytes.Repeat([]byte("%PDF-1.7 "), 20)}
+	logo := Attachment{Filename: "logo.png", ContentType: "image/png", Content: []byte{0x89, 'P', 'N', 'G'}, ContentID: "logo"}
+	blob := Attachment{Filename: "data", Content: []byte{0, 1, 2}}
+
+	tests := []struct {
+		name      string
+		msg       Message
+		wantTree  string
+		wantParts map[string]string // content type to decoded body
+	}{
+		{
+			name:      "text only",
+			msg:       Message{Text: "Hello"},
+			wantTree:  "text/plain",
+			wantParts: map[string]string{"text/plain": "Hello"},
+		},
+		{
+			name:     "text is derived from HTML",
+			msg:      Message{HTML: "<p>Hello &amp; welcome</p><p>Bye</p>"},
+			wantTree: "multipart/alternative(text/plain,text/html)",
+			wantParts: map[string]string{
+				"text/plain": "Hello & welcome\r\nBye", // line breaks are CRLF on the wire
+				"text/html":  "<p>Hello &amp; welcome</p><p>Bye</p>",
+			},
+		},
+		{
+			name:      "non-ASCII and long lines",
+			msg:       Message{Text: "Grüße " + strings.Repeat("x", 100)},
+			wantTree:  "text/plain",
+			wantParts: map[string]string{"text/plain": "Grüße " + strings.Repeat("x", 100)},
+		},
+		{
+			name:     "attachment",
+			msg:      Message{Text: "See attached", Attachments: []Attachment{pdf}},
+			wantTree: "multipart/mixed(text/plain,application/pdf)",
+			wantParts: map[string]string{
+				"text/plain":      "See attached",
+				"application/pdf": string(pdf.Content),
+			},
+		},
+		{
+			name:     "inline image",
+			msg:      Message{Text: "Hi", HTML: `<img src="cid:logo">`, Attachments: []Attachment{logo}},
+			wantTree: "multipart/related(multipart/alternative(text/plain,text/html),image/png)",
+			wantParts: map[string]string{
+				"image/png": string(logo.Content),
+			},
+		},
+		{
+			name:     "invalid content type",
+			msg:      Message{Text: "Hi", Attachments: []Attachment{{Filename: "notes.txt", ContentType: "text/", Content: []byte("notes")}}},
+			wantTree: "multipart/mixed(text/plain,application/octet-stream)",
+			wantParts: map[string]string{
+				"application/octet-stream": "notes",
+			},
+		},
+		{
+			name:     "inline image and attachment",
+			msg:      Message{Text: "Hi", HTML: `<img src="cid:logo">`, Attachments: []Attachment{blob, logo}},
+			wantTree: "multipart/mixed(multipart/related(multipart/alternative(text/plain,text/html),image/png),application/octet-stream)",
+			wantParts: map[string]string{
+				"image/png":                string(logo.Content),
+				"application/octet-stream": string(blob.Content),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.From = "Alerts <alerts@example.com>"
+			tt.msg.To = []string{"alice@example.com"}
+			tt.msg.Bcc = []string{"audit@example.com"}
+			tt.msg.Subject = "Café ready"
+			tt.msg.Date = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+			raw, err := tt.msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			m, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+
+			subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+			if err != nil || subject != tt.msg.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.msg.Subject)
+			}
+			if bcc := m.Header.Get("Bcc"); bcc != "" {
+				t.Errorf("Bcc header = %q, want none", bcc)
+			}
+			if !strings.HasSuffix(m.Header.Get("Message-ID"), "@example.com>") {
+				t.Errorf("Message-ID = %q, want one at example.com", m.Header.Get("Message-ID"))
+			}
+
+			parts := make(map[string]string)
+			tree := walk(t, m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body, parts)
+			if tree != tt.wantTree {
+				t.Errorf("structure = %s, want %s", tree, tt.wantTree)
+			}
+			for contentType, want := range tt.wantParts {
+				if got := parts[contentType]; got != want {
+					t.Errorf("%s part = %q, want %q", contentType, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBytesRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"no recipients", Message{From: "alerts@example.com"}},
+		{"bad from", Message{From: "alerts", To: []string{"alice@example.com"}}},
+		{"bad to", Message{From: "alerts@example.com", To: []string{"alice"}}},
+		{"bad cc", Message{From: "alerts@example.com", To: []string{"alice@example.com"}, Cc: []string{"bob@"}}},
+		{"header in content ID", Message{From: "alerts@example.com", To: []string{"alice@example.com"},
+			Attachments: []Attachment{{Filename: "logo.png", ContentID: "logo>\r\nBcc: eve@example.com"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.msg.Bytes(); err == nil {
+				t.Error("Bytes succeeded, want an error")
+			}
+		})
+	}
+}
+
+// walk describes the MIME structure of a part, like
+// "multipart/alternative(text/plain,text/html)", and collects the decoded
+// body of every leaf part by content type.
+func walk(t *testing.T, contentType, encoding string, body io.Reader, parts map[string]string) string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("Content-Type %q: %v", contentType, err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var children []string
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", mediaType, err)
+			}
+			children = append(children, walk(t, p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p, parts))
+		}
+		return mediaType + "(" + strings.Join(children, ",") + ")"
+	}
+
+	switch encoding {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("%s: %v", mediaType, err)
+	}
+	parts[mediaType] = string(data)
+	return mediaType
+}
@@ -0,0 +1,278 @@
+// Package outbox keeps the API accepting notifications while the broker is
+// down. Published messages are committed to a local BoltDB file and a relay
+// moves them to the broker in the background, retrying until it succeeds.
+// Messages with the same key reach the broker in the order they were
+// published.
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/queue"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("outbox")
+
+const (
+	// Messages the relay reads from the file at a time.
+	relayBatch = 500
+	// Keys the relay publishes concurrently; each key's messages are
+	// published one after another.
+	relayParallel = 16
+	// Time limit of one publish to the broker.
+	publishTimeout = 10 * time.Second
+	// Retry delays after a failed pass, doubled up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// entry is a message as stored in the file.
+type entry struct {
+	Topic   string            `json:"topic"`
+	Key     []byte            `json:"key"`
+	Value   []byte            `json:"value"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Outbox is a queue.Queue that stores what is published and relays it to
+// the wrapped queue. Readers read from the wrapped queue.
+type Outbox struct {
+	db    *bolt.DB
+	queue queue.Queue
+
+	wake    chan struct{}
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// Open opens or creates the outbox file at path and starts relaying to q,
+// beginning with whatever was left in the file by the previous run.
+func Open(path string, q queue.Queue) (*Outbox, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &Outbox{
+		db:      db,
+		queue:   q,
+		wake:    make(chan struct{}, 1),
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	if n := o.Len(); n > 0 {
+		log.Printf("Outbox has %d messages to relay", n)
+	}
+	go o.relay(ctx)
+	return o, nil
+}
+
+// Publish commits msg to the file. It is published to the broker later.
+func (o *Outbox) Publish(ctx context.Context, msg queue.Message) error {
+	value, err := json.Marshal(entry{Topic: msg.Topic, Key: msg.Key, Value: msg.Value, Headers: msg.Headers})
+	if err != nil {
+		return err
+	}
+	// Batch shares one disk sync among concurrent publishers.
+	err = o.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(nil, seq), value)
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return queue.ErrClosed
+	} else if err != nil {
+		return err
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *Outbox) Reader(topic, group string) queue.Reader {
+	return o.queue.Reader(topic, group)
+}
+
+// Len is the number of messages waiting to be relayed.
+func (o *Outbox) Len() int {
+	n := 0
+	o.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucket).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// Close stops the relay and closes the file and the wrapped queue. Messages
+// not relayed yet are relayed on the next Open.
+func (o *Outbox) Close() error {
+	o.cancel()
+	<-o.stopped
+	err := o.db.Close()
+	if qerr := o.queue.Close(); err == nil {
+		err = qerr
+	}
+	return err
+}
+
+// relay publishes the stored messages until ctx is done. After a failure
+// it starts over from the oldest message, so a key stays blocked until its
+// oldest message went through.
+func (o *Outbox) relay(ctx context.Context) {
+	defer close(o.stopped)
+
+	backoff := minBackoff
+	for {
+		ids, entries, err := o.next()
+		if err != nil {
+			log.Printf("Outbox read error: %v", err)
+		}
+
+		var wait <-chan time.Time
+		if len(ids) > 0 {
+			sent, failed := o.publish(ctx, ids, entries)
+			if err := o.remove(sent); err != nil {
+				log.Printf("Outbox delete error: %v", err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if failed == nil {
+				backoff = minBackoff
+				continue
+			}
+			log.Printf("Outbox relayed %d messages, retrying the rest in %s: %v", len(sent), backoff, failed)
+			wait = time.After(backoff)
+			backoff = min(backoff*2, maxBackoff)
+		} else if err != nil {
+			wait = time.After(backoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-wait:
+		}
+	}
+}
+
+// next returns the oldest relayBatch messages.
+func (o *Outbox) next() ([][]byte, []entry, error) {
+	var (
+		ids     [][]byte
+		entries []entry
+	)
+	err := o.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, v := c.First(); k != nil && len(ids) < relayBatch; k, v = c.Next() {
+			var e entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				log.Printf("Dropping unreadable outbox message: %v", err)
+				e = entry{} // removed below without publishing
+			}
+			ids = append(ids, bytes.Clone(k))
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return ids, entries, err
+}
+
+// publish sends entries to the broker, concurrently for different keys and
+// in order for each key. A key's remaining entries are held back after one
+// of its entries failed. It returns the ids that were published and the
+// first error.
+func (o *Outbox) publish(ctx context.Context, ids [][]byte, entries []entry) ([][]byte, error) {
+	var (
+		order  []string
+		byKey  = make(map[string][]int)
+		sent   [][]byte
+		failed error
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	for i, e := range entries {
+		k := string(e.Key)
+		if _, ok := byKey[k]; !ok {
+			order = append(order, k)
+		}
+		byKey[k] = append(byKey[k], i)
+	}
+
+	keys := make(chan string)
+	for range min(relayParallel, len(order)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range keys {
+				for _, i := range byKey[k] {
+					err := o.publishOne(ctx, entries[i])
+					mu.Lock()
+					if err == nil {
+						sent = append(sent, ids[i])
+					} else if failed == nil {
+						failed = err
+					}
+					mu.Unlock()
+					if err != nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	for _, k := range order {
+		keys <- k
+	}
+	close(keys)
+	wg.Wait()
+	return sent, failed
+}
+
+func (o *Outbox) publishOne(ctx context.Context, e entry) error {
+	if e.Topic == "" {
+		return nil // unreadable, drop it
+	}
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	return o.queue.Publish(ctx, queue.Message{Topic: e.Topic, Key: e.Key, Value: e.Value, Headers: e.Headers})
+}
+
+func (o *Outbox) remove(ids [][]byte) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return o.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for _, id := range ids {
+			if err := b.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
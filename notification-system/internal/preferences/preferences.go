@@ -0,0 +1,173 @@
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// Suppression reasons recorded when Check rejects a notification.
+const (
+	ReasonChannelOptOut  = "channel_opt_out"
+	ReasonCategoryOptOut = "category_opt_out"
+	ReasonQuietHours     = "quiet_hours"
+	ReasonNoChannel      = "no_allowed_channel"
+)
+
+// CategoryVerification marks contact verification codes. The user asked for
+// them, so neither opt-outs nor quiet hours hold them back.
+const CategoryVerification = "verification"
+
+// QuietHours is a daily window, in the user's timezone, during which nothing
+// is delivered. Start and End are "HH:MM"; a window may wrap midnight.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// Preferences is what a user has chosen to receive. A user without stored
+// preferences receives everything.
+type Preferences struct {
+	UserID                 string      `json:"user_id"`
+	OptedOutChannels       []string    `json:"opted_out_channels"`
+	UnsubscribedCategories []string    `json:"unsubscribed_categories"`
+	QuietHours             *QuietHours `json:"quiet_hours,omitempty"`
+	ChannelOrder           []string    `json:"channel_order"` // preferred channels, first is used when a request names none
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(addr string) *Store {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Store{rdb: rdb}
+}
+
+func prefsKey(ctx context.Context, userID string) string {
+	return tenant.Key(ctx, fmt.Sprintf("prefs:%s", userID))
+}
+
+// Get returns the user's preferences, or empty preferences if none are stored.
+func (s *Store) Get(ctx context.Context, userID string) (*Preferences, error) {
+	data, err := s.rdb.Get(ctx, prefsKey(ctx, userID)).Result()
+	if err == redis.Nil {
+		return &Preferences{UserID: userID}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var p Preferences
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) Put(ctx context.Context, p *Preferences) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, prefsKey(ctx, p.UserID), data, 0).Err()
+}
+
+func (p *Preferences) Validate() error {
+	if p.UserID == "" {
+		return fmt.Errorf("user id is required")
+	}
+	if q := p.QuietHours; q != nil {
+		if _, _, err := q.window(); err != nil {
+			return err
+		}
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("invalid quiet hours timezone %q: %w", q.Timezone, err)
+		}
+	}
+	return nil
+}
+
+// Channel picks the channel for a request. An explicit channel is kept;
+// otherwise the first preferred channel the user has not opted out of.
+func (p *Preferences) Channel(requested string) string {
+	if requested != "" {
+		return requested
+	}
+	for _, c := range p.ChannelOrder {
+		if !slices.Contains(p.OptedOutChannels, c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// Check reports whether a notification on channel in category may be
+// delivered at now, and the suppression reason if not. Critical
+// notifications are delivered during quiet hours.
+func (p *Preferences) Check(channel, category string, critical bool, now time.Time) (bool, string) {
+	if channel == "" {
+		return false, ReasonNoChannel
+	}
+	if category == CategoryVerification {
+		return true, ""
+	}
+	if slices.Contains(p.OptedOutChannels, channel) {
+		return false, ReasonChannelOptOut
+	}
+	if category != "" && slices.Contains(p.UnsubscribedCategories, category) {
+		return false, ReasonCategoryOptOut
+	}
+	if !critical && p.QuietHours != nil && p.QuietHours.contains(now) {
+		return false, ReasonQuietHours
+	}
+	return true, ""
+}
+
+func (q *QuietHours) contains(now time.Time) bool {
+	start, end, err := q.window()
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// Wraps midnight, e.g. 22:00-07:00.
+	return minute >= start || minute < end
+}
+
+func (q *QuietHours) window() (int, int, error) {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
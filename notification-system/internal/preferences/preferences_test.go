@@ -0,0 +1,77 @@
+package preferences
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	night := &QuietHours{Start: "22:00", End: "07:00", Timezone: "America/New_York"}
+	lunch := &QuietHours{Start: "12:00", End: "13:00"}
+
+	tests := []struct {
+		name       string
+		prefs      Preferences
+		channel    string
+		category   string
+		critical   bool
+		now        string // RFC 3339
+		wantOK     bool
+		wantReason string
+	}{
+		{"no preferences", Preferences{}, "email", "", false, "2026-03-01T12:00:00Z", true, ""},
+		{"no channel", Preferences{}, "", "", false, "2026-03-01T12:00:00Z", false, ReasonNoChannel},
+		{"channel opt-out", Preferences{OptedOutChannels: []string{"sms"}}, "sms", "", false, "2026-03-01T12:00:00Z", false, ReasonChannelOptOut},
+		{"other channel", Preferences{OptedOutChannels: []string{"sms"}}, "email", "", false, "2026-03-01T12:00:00Z", true, ""},
+		{"category opt-out", Preferences{UnsubscribedCategories: []string{"marketing"}}, "email", "marketing", false, "2026-03-01T12:00:00Z", false, ReasonCategoryOptOut},
+		{"no category", Preferences{UnsubscribedCategories: []string{"marketing"}}, "email", "", false, "2026-03-01T12:00:00Z", true, ""},
+
+		// 22:00-07:00 in New York is 03:00-12:00 UTC in winter.
+		{"before quiet hours", Preferences{QuietHours: night}, "email", "", false, "2026-01-15T02:59:00Z", true, ""},
+		{"quiet hours start", Preferences{QuietHours: night}, "email", "", false, "2026-01-15T03:00:00Z", false, ReasonQuietHours},
+		{"quiet hours after midnight", Preferences{QuietHours: night}, "email", "", false, "2026-01-15T09:30:00Z", false, ReasonQuietHours},
+		{"quiet hours end", Preferences{QuietHours: night}, "email", "", false, "2026-01-15T12:00:00Z", true, ""},
+		{"quiet hours in summer time", Preferences{QuietHours: night}, "email", "", false, "2026-07-15T02:30:00Z", false, ReasonQuietHours},
+		{"after summer quiet hours", Preferences{QuietHours: night}, "email", "", false, "2026-07-15T11:30:00Z", true, ""},
+		{"window within a day", Preferences{QuietHours: lunch}, "sms", "", false, "2026-03-01T12:30:00Z", false, ReasonQuietHours},
+		{"outside a window within a day", Preferences{QuietHours: lunch}, "sms", "", false, "2026-03-01T13:00:00Z", true, ""},
+		{"bad window is ignored", Preferences{QuietHours: &QuietHours{Start: "late", End: "07:00"}}, "sms", "", false, "2026-03-01T03:00:00Z", true, ""},
+
+		{"critical during quiet hours", Preferences{QuietHours: night}, "sms", "", true, "2026-01-15T09:30:00Z", true, ""},
+		{"critical on an opted-out channel", Preferences{OptedOutChannels: []string{"sms"}}, "sms", "", true, "2026-03-01T12:00:00Z", false, ReasonChannelOptOut},
+		{"verification on an opted-out channel", Preferences{OptedOutChannels: []string{"sms"}, QuietHours: night}, "sms", CategoryVerification, false, "2026-01-15T09:30:00Z", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, reason := tt.prefs.Check(tt.channel, tt.category, tt.critical, now)
+			if ok != tt.wantOK || reason != tt.wantReason {
+				t.Errorf("Check = %v, %q, want %v, %q", ok, reason, tt.wantOK, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestChannel(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefs     Preferences
+		requested string
+		want      string
+	}{
+		{"explicit channel is kept", Preferences{ChannelOrder: []string{"sms"}}, "email", "email"},
+		{"first preferred", Preferences{ChannelOrder: []string{"push", "sms"}}, "", "push"},
+		{"opted-out preferences are skipped", Preferences{ChannelOrder: []string{"push", "sms"}, OptedOutChannels: []string{"push"}}, "", "sms"},
+		{"nothing preferred", Preferences{}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.prefs.Channel(tt.requested); got != tt.want {
+				t.Errorf("Channel(%q) = %q, want %q", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package priority
+
+import "fmt"
+
+// Priority classes, from most to least urgent. An empty priority is Normal.
+const (
+	Critical = "critical"
+	High     = "high"
+	Normal   = "normal"
+	Low      = "low"
+)
+
+// Levels lists every priority class, most urgent first.
+var Levels = []string{Critical, High, Normal, Low}
+
+// Parse validates p and normalizes the empty priority to Normal.
+func Parse(p string) (string, error) {
+	switch p {
+	case "":
+		return Normal, nil
+	case Critical, High, Normal, Low:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown priority %q", p)
+}
+
+// Index returns the position of p in Levels. Unknown priorities are Normal.
+func Index(p string) int {
+	for i, l := range Levels {
+		if l == p {
+			return i
+		}
+	}
+	return 2
+}
+
+// Topic is the Kafka topic for priority p. Normal keeps the base topic so
+// existing producers and consumers are unaffected, e.g. "notifications" and
+// "notifications.critical".
+func Topic(base, p string) string {
+	if p == "" || p == Normal {
+		return base
+	}
+	return base + "." + p
+}
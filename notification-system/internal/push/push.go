@@ -0,0 +1,259 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+)
+
+// ErrInvalidToken means the provider no longer accepts the device token and
+// it should be removed from the registry.
+var ErrInvalidToken = errors.New("invalid device token")
+
+// Message is the platform independent content of a push notification.
+type Message struct {
+	Title       string
+	Body        string
+	Badge       int32
+	Data        map[string]string
+	CollapseKey string
+	TTL         time.Duration
+}
+
+// Config points the client at FCM HTTP v1 and APNs compatible endpoints.
+// The base URLs are configurable so a local stand-in server can be used.
+type Config struct {
+	FCMBaseURL     string // e.g. https://fcm.googleapis.com
+	FCMProjectID   string
+	FCMAccessToken *secrets.Value
+
+	APNsBaseURL   string         // e.g. https://api.push.apple.com
+	APNsTopic     string         // the app bundle id
+	APNsAuthToken *secrets.Value // provider JWT
+}
+
+// Error is a failed delivery to one device.
+type Error struct {
+	Platform   string
+	StatusCode int
+	Reason     string
+	Retryable  bool
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s push: status %d: %s", e.Platform, e.StatusCode, e.Reason)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type Client struct {
+	settings atomic.Pointer[clientSettings]
+}
+
+type clientSettings struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewClient(cfg Config, timeout time.Duration) *Client {
+	c := &Client{}
+	c.Reconfigure(cfg, timeout)
+	return c
+}
+
+// Reconfigure switches the endpoints and timeout. Sends already in flight
+// finish with the previous settings.
+func (c *Client) Reconfigure(cfg Config, timeout time.Duration) {
+	c.settings.Store(&clientSettings{cfg: cfg, client: &http.Client{Timeout: timeout}})
+}
+
+// Send delivers msg to one device through the provider of its platform.
+func (c *Client) Send(ctx context.Context, d *Device, msg Message) error {
+	switch d.Platform {
+	case PlatformAndroid:
+		return c.sendFCM(ctx, d.Token, msg)
+	case PlatformIOS:
+		return c.sendAPNs(ctx, d.Token, msg)
+	default:
+		return ErrInvalidPlatform
+	}
+}
+
+// FCMPayload builds an FCM HTTP v1 send request body.
+func FCMPayload(token string, msg Message) map[string]any {
+	android := map[string]any{}
+	if msg.CollapseKey != "" {
+		android["collapse_key"] = msg.CollapseKey
+	}
+	if msg.TTL > 0 {
+		android["ttl"] = strconv.Itoa(int(msg.TTL/time.Second)) + "s"
+	}
+	if msg.Badge > 0 {
+		android["notification"] = map[string]any{"notification_count": msg.Badge}
+	}
+
+	m := map[string]any{
+		"token":        token,
+		"notification": map[string]any{"title": msg.Title, "body": msg.Body},
+		"android":      android,
+	}
+	if len(msg.Data) > 0 {
+		m["data"] = msg.Data
+	}
+	return map[string]any{"message": m}
+}
+
+// APNsPayload builds the JSON body of an APNs request. Custom data keys sit
+// next to the "aps" dictionary.
+func APNsPayload(msg Message) map[string]any {
+	aps := map[string]any{
+		"alert": map[string]any{"title": msg.Title, "body": msg.Body},
+	}
+	if msg.Badge > 0 {
+		aps["badge"] = msg.Badge
+	}
+
+	payload := map[string]any{}
+	for k, v := range msg.Data {
+		payload[k] = v
+	}
+	payload["aps"] = aps
+	return payload
+}
+
+func (c *Client) sendFCM(ctx context.Context, token string, msg Message) error {
+	cfg := c.settings.Load().cfg
+	url := fmt.Sprintf("%s/v1/projects/%s/messages:send", strings.TrimRight(cfg.FCMBaseURL, "/"), cfg.FCMProjectID)
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+cfg.FCMAccessToken.Get().Reveal())
+
+	resp, body, err := c.post(ctx, url, header, FCMPayload(token, msg))
+	if err != nil {
+		return &Error{Platform: PlatformAndroid, Reason: err.Error(), Retryable: true}
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// {"error": {"status": "NOT_FOUND", "details": [{"errorCode": "UNREGISTERED"}]}}
+	var fcmErr struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &fcmErr)
+	reason := fcmErr.Error.Status
+	for _, d := range fcmErr.Error.Details {
+		if d.ErrorCode != "" {
+			reason = d.ErrorCode
+		}
+	}
+
+	e := &Error{
+		Platform:   PlatformAndroid,
+		StatusCode: resp.StatusCode,
+		Reason:     reason,
+		Retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		RetryAfter: retryAfter(resp.Header),
+	}
+	if reason == "UNREGISTERED" ||
+		(reason == "INVALID_ARGUMENT" && strings.Contains(strings.ToLower(fcmErr.Error.Message), "registration token")) {
+		e.Err = ErrInvalidToken
+	}
+	return e
+}
+
+func (c *Client) sendAPNs(ctx context.Context, token string, msg Message) error {
+	cfg := c.settings.Load().cfg
+	url := fmt.Sprintf("%s/3/device/%s", strings.TrimRight(cfg.APNsBaseURL, "/"), token)
+	header := http.Header{}
+	header.Set("Authorization", "bearer "+cfg.APNsAuthToken.Get().Reveal())
+	header.Set("apns-topic", cfg.APNsTopic)
+	header.Set("apns-push-type", "alert")
+	header.Set("apns-priority", "10")
+	if msg.CollapseKey != "" {
+		header.Set("apns-collapse-id", msg.CollapseKey)
+	}
+	if msg.TTL > 0 {
+		header.Set("apns-expiration", strconv.FormatInt(time.Now().Add(msg.TTL).Unix(), 10))
+	}
+
+	resp, body, err := c.post(ctx, url, header, APNsPayload(msg))
+	if err != nil {
+		return &Error{Platform: PlatformIOS, Reason: err.Error(), Retryable: true}
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// {"reason": "BadDeviceToken"}
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(body, &apnsErr)
+
+	e := &Error{
+		Platform:   PlatformIOS,
+		StatusCode: resp.StatusCode,
+		Reason:     apnsErr.Reason,
+		Retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		RetryAfter: retryAfter(resp.Header),
+	}
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		apnsErr.Reason == "BadDeviceToken",
+		apnsErr.Reason == "Unregistered",
+		apnsErr.Reason == "DeviceTokenNotForTopic":
+		e.Err = ErrInvalidToken
+	}
+	return e
+}
+
+func (c *Client) post(ctx context.Context, url string, header http.Header, payload any) (*http.Response, []byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.settings.Load().client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+func retryAfter(h http.Header) time.Duration {
+	if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	PlatformIOS     = "ios"     // delivered through APNs
+	PlatformAndroid = "android" // delivered through FCM
+)
+
+var ErrInvalidPlatform = errors.New(`platform must be "ios" or "android"`)
+
+// Device is a push token registered for a user.
+type Device struct {
+	Token     string `json:"token"`
+	Platform  string `json:"platform"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Registry keeps the device tokens of each user.
+type Registry struct {
+	rdb *redis.Client
+}
+
+func NewRegistry(addr string) *Registry {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Registry{rdb: rdb}
+}
+
+func devicesKey(ctx context.Context, userID string) string {
+	return tenant.Key(ctx, fmt.Sprintf("devices:%s", userID))
+}
+
+func (r *Registry) Register(ctx context.Context, userID, token, platform string) (*Device, error) {
+	if platform != PlatformIOS && platform != PlatformAndroid {
+		return nil, ErrInvalidPlatform
+	}
+	if token == "" {
+		return nil, errors.New("device token is required")
+	}
+
+	d := &Device{Token: token, Platform: platform, CreatedAt: time.Now().Unix()}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.rdb.HSet(ctx, devicesKey(ctx, userID), token, data).Err(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Unregister removes a token and reports whether it was registered.
+func (r *Registry) Unregister(ctx context.Context, userID, token string) (bool, error) {
+	removed, err := r.rdb.HDel(ctx, devicesKey(ctx, userID), token).Result()
+	return removed > 0, err
+}
+
+func (r *Registry) List(ctx context.Context, userID string) ([]*Device, error) {
+	all, err := r.rdb.HGetAll(ctx, devicesKey(ctx, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []*Device
+	for _, data := range all {
+		var d Device
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			continue
+		}
+		out = append(out, &d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out, nil
+}
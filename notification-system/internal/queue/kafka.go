@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type Kafka struct {
+	brokers []string
+	writer  *kafka.Writer
+}
+
+func NewKafka(brokers []string) *Kafka {
+	// The topic is set per message.
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        false,
+	}
+	return &Kafka{brokers: brokers, writer: writer}
+}
+
+func (k *Kafka) Publish(ctx context.Context, msg Message) error {
+	var headers []kafka.Header
+	for key, value := range msg.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   msg.Topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+		Time:    time.Now(),
+	})
+}
+
+// Reader starts new groups at the oldest message. Ack commits the offset,
+// which also covers the unacknowledged messages before it in the partition.
+func (k *Kafka) Reader(topic, group string) Reader {
+	return &kafkaReader{kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     k.brokers,
+		Topic:       topic,
+		GroupID:     group,
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+	})}
+}
+
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
+
+type kafkaReader struct {
+	r *kafka.Reader
+}
+
+func (r *kafkaReader) Read(ctx context.Context) (Message, error) {
+	m, err := r.r.FetchMessage(ctx)
+	if errors.Is(err, io.EOF) {
+		return Message{}, ErrClosed
+	} else if err != nil {
+		return Message{}, err
+	}
+	msg := Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Time: m.Time, receipt: m}
+	if len(m.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(m.Headers))
+		for _, h := range m.Headers {
+			msg.Headers[h.Key] = string(h.Value)
+		}
+	}
+	return msg, nil
+}
+
+func (r *kafkaReader) Ack(ctx context.Context, msg Message) error {
+	m, ok := msg.receipt.(kafka.Message)
+	if !ok {
+		return errors.New("message was not read from Kafka")
+	}
+	return r.r.CommitMessages(ctx, m)
+}
+
+func (r *kafkaReader) Close() error {
+	return r.r.Close()
+}
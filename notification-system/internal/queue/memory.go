@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps topics in process. Unlike Kafka every message goes to a
+// single reader of its topic whatever the reader's group, messages count
+// as processed once read, and nothing survives a restart.
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	closed chan struct{}
+}
+
+type memoryTopic struct {
+	msgs []Message
+	// ready is closed and replaced when a message is published, waking the
+	// readers waiting for one.
+	ready chan struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		topics: make(map[string]*memoryTopic),
+		closed: make(chan struct{}),
+	}
+}
+
+// topic returns the named topic, creating it on first use. Call with mu held.
+func (m *Memory) topic(name string) *memoryTopic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &memoryTopic{ready: make(chan struct{})}
+		m.topics[name] = t
+	}
+	return t
+}
+
+func (m *Memory) Publish(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.closed:
+		return ErrClosed
+	default:
+	}
+
+	msg.Time = time.Now()
+	t := m.topic(msg.Topic)
+	t.msgs = append(t.msgs, msg)
+	close(t.ready)
+	t.ready = make(chan struct{})
+	return nil
+}
+
+func (m *Memory) Reader(topic, group string) Reader {
+	return &memoryReader{m: m, topic: topic, closed: make(chan struct{})}
+}
+
+// Close stops every reader. Unread messages are dropped.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.closed:
+	default:
+		close(m.closed)
+	}
+	return nil
+}
+
+// Len is the number of unread messages of topic.
+func (m *Memory) Len(topic string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.topic(topic).msgs)
+}
+
+type memoryReader struct {
+	m         *Memory
+	topic     string
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (r *memoryReader) Read(ctx context.Context) (Message, error) {
+	for {
+		select {
+		case <-r.closed:
+			return Message{}, ErrClosed
+		case <-r.m.closed:
+			return Message{}, ErrClosed
+		default:
+		}
+
+		r.m.mu.Lock()
+		t := r.m.topic(r.topic)
+		if len(t.msgs) > 0 {
+			msg := t.msgs[0]
+			t.msgs[0] = Message{}
+			t.msgs = t.msgs[1:]
+			r.m.mu.Unlock()
+			return msg, nil
+		}
+		ready := t.ready
+		r.m.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-r.closed:
+			return Message{}, ErrClosed
+		case <-r.m.closed:
+			return Message{}, ErrClosed
+		}
+	}
+}
+
+func (r *memoryReader) Ack(ctx context.Context, msg Message) error {
+	return nil
+}
+
+func (r *memoryReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
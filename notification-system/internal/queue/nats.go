@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Header carrying the message key, JetStream messages have none of their own.
+const natsKeyHeader = "Notification-Key"
+
+// NATS keeps each topic in a JetStream stream of the same subject, created
+// on first use with a retention of its own. Every consumer group is a
+// durable pull consumer; messages not acknowledged within claimIdle are
+// delivered again.
+type NATS struct {
+	nc *nats.Conn
+	js jetstream.JetStream
+
+	mu      sync.Mutex
+	streams map[string]bool // topics whose stream exists
+}
+
+func NewNATS(url string) (*NATS, error) {
+	// Keep connecting in the background when the server is down at startup,
+	// an outbox accepts notifications meanwhile.
+	nc, err := nats.Connect(url, nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &NATS{nc: nc, js: js, streams: make(map[string]bool)}, nil
+}
+
+// streamName derives the stream of topic. Stream names may not contain dots.
+func streamName(topic string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(topic)
+}
+
+// ensureStream creates the stream of topic unless it is known to exist.
+func (q *NATS) ensureStream(ctx context.Context, topic string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.streams[topic] {
+		return nil
+	}
+	_, err := q.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     streamName(topic),
+		Subjects: []string{topic},
+		MaxAge:   retention,
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		return err
+	}
+	q.streams[topic] = true
+	return nil
+}
+
+func (q *NATS) Publish(ctx context.Context, msg Message) error {
+	if err := q.ensureStream(ctx, msg.Topic); err != nil {
+		return natsError(err)
+	}
+	m := nats.NewMsg(msg.Topic)
+	m.Data = msg.Value
+	for name, value := range msg.Headers {
+		m.Header.Set(name, value)
+	}
+	if len(msg.Key) > 0 {
+		m.Header.Set(natsKeyHeader, string(msg.Key))
+	}
+	_, err := q.js.PublishMsg(ctx, m)
+	return natsError(err)
+}
+
+func (q *NATS) Reader(topic, group string) Reader {
+	return &natsReader{q: q, topic: topic, group: group, closed: make(chan struct{})}
+}
+
+func (q *NATS) Close() error {
+	return q.nc.Drain()
+}
+
+type natsReader struct {
+	q        *NATS
+	topic    string
+	group    string
+	consumer jetstream.Consumer
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (r *natsReader) Read(ctx context.Context) (Message, error) {
+	for {
+		select {
+		case <-r.closed:
+			return Message{}, ErrClosed
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+
+		if r.consumer == nil {
+			if err := r.join(ctx); err != nil {
+				return Message{}, natsError(err)
+			}
+		}
+		m, err := r.consumer.Next(jetstream.FetchContext(ctx))
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, jetstream.ErrNoMessages) {
+			continue
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return Message{}, ctx.Err()
+			}
+			return Message{}, natsError(err)
+		}
+		return r.message(m), nil
+	}
+}
+
+// join creates the group's durable consumer, or attaches to it.
+func (r *natsReader) join(ctx context.Context) error {
+	if err := r.q.ensureStream(ctx, r.topic); err != nil {
+		return err
+	}
+	consumer, err := r.q.js.CreateOrUpdateConsumer(ctx, streamName(r.topic), jetstream.ConsumerConfig{
+		Durable:       streamName(r.group),
+		FilterSubject: r.topic,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       claimIdle,
+	})
+	if err != nil {
+		return err
+	}
+	r.consumer = consumer
+	return nil
+}
+
+func (r *natsReader) message(m jetstream.Msg) Message {
+	msg := Message{Topic: r.topic, Value: m.Data(), receipt: m}
+	if md, err := m.Metadata(); err == nil {
+		msg.Time = md.Timestamp
+	}
+	for name, values := range m.Headers() {
+		if name == natsKeyHeader {
+			msg.Key = []byte(values[0])
+			continue
+		}
+		if msg.Headers == nil {
+			msg.Headers = make(map[string]string)
+		}
+		msg.Headers[name] = values[0]
+	}
+	return msg
+}
+
+func (r *natsReader) Ack(ctx context.Context, msg Message) error {
+	m, ok := msg.receipt.(jetstream.Msg)
+	if !ok {
+		return errors.New("message was not read from NATS")
+	}
+	return natsError(m.DoubleAck(ctx))
+}
+
+// Close leaves the group's consumer on the server, the next reader of the
+// group continues where this one stopped.
+func (r *natsReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+func natsError(err error) error {
+	if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrConnectionDraining) {
+		return ErrClosed
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+// Package queue carries serialized notifications from the API to the load
+// balancer. Kafka is the production driver, Redis Streams and NATS
+// JetStream serve deployments without Kafka, and Memory runs everything in
+// one process for development and tests.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrClosed is returned by Read once the reader or its queue is closed.
+var ErrClosed = errors.New("queue closed")
+
+// Messages are kept this long by the brokers that need a retention,
+// matching Kafka's default.
+const retention = 7 * 24 * time.Hour
+
+// Unacknowledged messages of a reader that went away are handed to another
+// reader of the group after claimIdle.
+const claimIdle = time.Minute
+
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+	Time    time.Time // set by the queue on publish
+
+	// receipt is what the driver needs to acknowledge the message.
+	receipt any
+}
+
+type Queue interface {
+	// Publish appends msg to msg.Topic.
+	Publish(ctx context.Context, msg Message) error
+	// Reader consumes topic as a member of the consumer group.
+	Reader(topic, group string) Reader
+	Close() error
+}
+
+type Reader interface {
+	// Read blocks until the next message arrives or ctx is done.
+	Read(ctx context.Context) (Message, error)
+	// Ack marks msg as processed. Messages that are not acknowledged are
+	// delivered again, to this or another reader of the group.
+	Ack(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// Brokers Open accepts.
+const (
+	BrokerKafka = "kafka"
+	BrokerRedis = "redis"
+	BrokerNATS  = "nats"
+)
+
+// Open connects to the broker at addr: comma separated Kafka brokers, a
+// Redis address or a NATS server URL.
+func Open(broker, addr string) (Queue, error) {
+	switch broker {
+	case BrokerKafka:
+		return NewKafka(strings.Split(addr, ",")), nil
+	case BrokerRedis:
+		return NewRedis(addr), nil
+	case BrokerNATS:
+		return NewNATS(addr)
+	default:
+		return nil, fmt.Errorf("unknown broker %q", broker)
+	}
+}
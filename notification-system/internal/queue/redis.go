@@ -0,0 +1,275 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Read blocks on Redis this long at a time.
+	redisBlock = 2 * time.Second
+	// Messages fetched per round trip.
+	redisBatch = 16
+	// How often a reader looks for messages other readers left unacknowledged.
+	redisClaimInterval = 30 * time.Second
+
+	// Stream entry fields. Headers are stored as headerPrefix+name.
+	fieldKey     = "key"
+	fieldValue   = "value"
+	headerPrefix = "header:"
+)
+
+// Redis keeps each topic in a Redis stream read through consumer groups.
+// Messages are acknowledged with XACK; the ones a reader fetched but never
+// acknowledged are reclaimed by another reader of the group after
+// claimIdle. Streams are trimmed to retention on publish.
+type Redis struct {
+	rdb *redis.Client
+}
+
+func NewRedis(addr string) *Redis {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Redis{rdb: rdb}
+}
+
+func streamKey(topic string) string {
+	return fmt.Sprintf("stream:%s", topic)
+}
+
+func (q *Redis) Publish(ctx context.Context, msg Message) error {
+	values := map[string]any{
+		fieldKey:   msg.Key,
+		fieldValue: msg.Value,
+	}
+	for name, value := range msg.Headers {
+		values[headerPrefix+name] = value
+	}
+	minID := strconv.FormatInt(time.Now().Add(-retention).UnixMilli(), 10)
+	err := q.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(msg.Topic),
+		MinID:  minID,
+		Approx: true,
+		Values: values,
+	}).Err()
+	if errors.Is(err, redis.ErrClosed) {
+		return ErrClosed
+	}
+	return err
+}
+
+// Reader joins group under the host name as consumer, so after a restart
+// the reader first gets the messages it had not acknowledged before.
+func (q *Redis) Reader(topic, group string) Reader {
+	consumer, err := os.Hostname()
+	if err != nil {
+		consumer = strconv.Itoa(os.Getpid())
+	}
+	return &redisReader{
+		rdb:      q.rdb,
+		topic:    topic,
+		stream:   streamKey(topic),
+		group:    group,
+		consumer: consumer,
+		closed:   make(chan struct{}),
+	}
+}
+
+func (q *Redis) Close() error {
+	return q.rdb.Close()
+}
+
+type redisReader struct {
+	rdb      *redis.Client
+	topic    string
+	stream   string
+	group    string
+	consumer string
+
+	joined bool // the group exists
+	// own is set while the reader works through the messages delivered to
+	// its consumer name before, e.g. by a previous run, ownFrom is the last
+	// one it got.
+	own       bool
+	ownFrom   string
+	claimedAt time.Time
+	// claimFrom is where the next reclaim continues in the pending list.
+	claimFrom string
+	buffered  []redis.XMessage
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (r *redisReader) Read(ctx context.Context) (Message, error) {
+	for {
+		select {
+		case <-r.closed:
+			return Message{}, ErrClosed
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+
+		if len(r.buffered) > 0 {
+			m := r.buffered[0]
+			r.buffered = r.buffered[1:]
+			if len(m.Values) == 0 {
+				// Trimmed while pending, nothing left to deliver.
+				r.rdb.XAck(ctx, r.stream, r.group, m.ID)
+				continue
+			}
+			return r.message(m), nil
+		}
+
+		if err := r.fetch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return Message{}, ctx.Err()
+			}
+			if errors.Is(err, redis.ErrClosed) {
+				return Message{}, ErrClosed
+			}
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				r.joined = false // the stream or group was deleted
+			}
+			return Message{}, err
+		}
+	}
+}
+
+// fetch buffers the next messages: the reader's own pending ones after
+// joining, then reclaimed and new ones. It returns without messages when
+// none arrived within redisBlock.
+func (r *redisReader) fetch(ctx context.Context) error {
+	if !r.joined {
+		err := r.rdb.XGroupCreateMkStream(ctx, r.stream, r.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+		r.joined, r.own = true, true
+		r.ownFrom, r.claimFrom = "0-0", "0-0"
+	}
+
+	if r.own {
+		msgs, err := r.readGroup(ctx, r.ownFrom, 0)
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			r.buffered = msgs
+			r.ownFrom = msgs[len(msgs)-1].ID
+			return nil
+		}
+		r.own = false
+	}
+
+	if time.Since(r.claimedAt) >= redisClaimInterval {
+		msgs, next, err := r.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   r.stream,
+			Group:    r.group,
+			Consumer: r.consumer,
+			MinIdle:  claimIdle,
+			Start:    r.claimFrom,
+			Count:    redisBatch,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		// Keep claiming from where this pass stopped until the whole
+		// pending list was seen.
+		r.claimFrom = next
+		if next == "0-0" {
+			r.claimedAt = time.Now()
+		}
+		if len(msgs) > 0 {
+			r.buffered = msgs
+			return nil
+		}
+	}
+
+	block := redisBlock
+	if deadline, ok := ctx.Deadline(); ok {
+		block = max(min(block, time.Until(deadline)), time.Millisecond)
+	}
+	msgs, err := r.readGroup(ctx, ">", block)
+	if err != nil {
+		return err
+	}
+	r.buffered = msgs
+	return nil
+}
+
+// readGroup reads the consumer's pending messages after id, or new ones
+// for ">".
+func (r *redisReader) readGroup(ctx context.Context, id string, block time.Duration) ([]redis.XMessage, error) {
+	args := &redis.XReadGroupArgs{
+		Group:    r.group,
+		Consumer: r.consumer,
+		Streams:  []string{r.stream, id},
+		Count:    redisBatch,
+		Block:    block,
+	}
+	if block == 0 {
+		args.Block = -1 // don't block
+	}
+	streams, err := r.rdb.XReadGroup(ctx, args).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var msgs []redis.XMessage
+	for _, s := range streams {
+		msgs = append(msgs, s.Messages...)
+	}
+	return msgs, nil
+}
+
+func (r *redisReader) message(m redis.XMessage) Message {
+	msg := Message{Topic: r.topic, receipt: m.ID}
+	if ms, _, ok := strings.Cut(m.ID, "-"); ok {
+		if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			msg.Time = time.UnixMilli(n)
+		}
+	}
+	for field, value := range m.Values {
+		s, _ := value.(string)
+		switch {
+		case field == fieldKey:
+			msg.Key = []byte(s)
+		case field == fieldValue:
+			msg.Value = []byte(s)
+		case strings.HasPrefix(field, headerPrefix):
+			if msg.Headers == nil {
+				msg.Headers = make(map[string]string)
+			}
+			msg.Headers[strings.TrimPrefix(field, headerPrefix)] = s
+		}
+	}
+	return msg
+}
+
+func (r *redisReader) Ack(ctx context.Context, msg Message) error {
+	id, ok := msg.receipt.(string)
+	if !ok {
+		return errors.New("message was not read from Redis")
+	}
+	return r.rdb.XAck(ctx, r.stream, r.group, id).Err()
+}
+
+// Close leaves buffered messages pending. They are read again when a reader
+// with the same consumer name joins, or reclaimed by another one.
+func (r *redisReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+)
+
+// QueueDepth is the number of tasks in the user's overflow queue.
+func (l *Limiter) QueueDepth(ctx context.Context, userID string) (int64, error) {
+	return l.store.Len(ctx, userID)
+}
+
+// PeekQueue returns up to limit of the user's queued tasks, oldest first,
+// without removing them.
+func (l *Limiter) PeekQueue(ctx context.Context, userID string, limit int) ([]QueuedTask, error) {
+	return l.store.Peek(ctx, userID, limit)
+}
+
+// PurgeQueue removes every queued task of the user and returns them.
+func (l *Limiter) PurgeQueue(ctx context.Context, userID string) ([]QueuedTask, error) {
+	return l.store.Purge(ctx, userID)
+}
+
+// PushFront puts task back at the head of the user's queue, e.g. when it
+// was popped but could not be handed on.
+func (l *Limiter) PushFront(ctx context.Context, task QueuedTask) error {
+	return l.store.Push(ctx, task, true)
+}
+
+// ResetRateLimit clears the user's counter for the current window.
+func (l *Limiter) ResetRateLimit(ctx context.Context, userID string) error {
+	return l.store.Reset(ctx, userID)
+}
+
+// PauseChannel stops dispatching tasks of channel until ResumeChannel. The
+// load balancer parks them in the meantime.
+func (l *Limiter) PauseChannel(ctx context.Context, channel string) error {
+	return l.store.Pause(ctx, channel)
+}
+
+// ResumeChannel lets channel be dispatched again. Its parked tasks are
+// picked up by the load balancer.
+func (l *Limiter) ResumeChannel(ctx context.Context, channel string) error {
+	return l.store.Resume(ctx, channel)
+}
+
+func (l *Limiter) Paused(ctx context.Context, channel string) (bool, error) {
+	return l.store.Paused(ctx, channel)
+}
+
+func (l *Limiter) PausedChannels(ctx context.Context) ([]string, error) {
+	return l.store.PausedChannels(ctx)
+}
+
+// Park holds back an allowed task while its channel is paused. Like Defer it
+// gives back the budget the task used; parked tasks are checked against the
+// rate limit again when they are unparked.
+func (l *Limiter) Park(ctx context.Context, task QueuedTask) error {
+	if err := l.store.Park(ctx, task); err != nil {
+		return err
+	}
+	l.release(ctx, budgetUser(task))
+	return nil
+}
+
+// Unpark returns the oldest parked task of channel, or nil if there is none.
+func (l *Limiter) Unpark(ctx context.Context, channel string) (*QueuedTask, error) {
+	return l.store.Unpark(ctx, channel)
+}
+
+// ParkedChannels maps the channels with parked tasks to their count.
+func (l *Limiter) ParkedChannels(ctx context.Context) (map[string]int64, error) {
+	return l.store.ParkedChannels(ctx)
+}
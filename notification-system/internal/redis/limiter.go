@@ -2,77 +2,221 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/lazypanda2004/notification-system/internal/mail"
+	"github.com/lazypanda2004/notification-system/internal/priority"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/lazypanda2004/notification-system/notifier"
 )
 
+// Limiter enforces the per-user rate limits and tenant quotas and holds the
+// tasks over the limit in per-user overflow queues. Its state lives in a
+// LimiterStore: Redis in production, so every load balancer shares it, or
+// memory for a single process.
 type Limiter struct {
-	rdb        *redis.Client
+	store   LimiterStore
+	tenants *tenant.Registry
+
+	mu         sync.RWMutex
 	rateLimit  int
 	timeWindow time.Duration
 }
 
 type QueuedTask struct {
-	UserID    string
-	Type      string 
-	Recipient string 
-	Message   string 
+	ID              string                  `json:"notification_id"`
+	TenantID        string                  `json:"tenant_id"`
+	UserID          string                  `json:"user_id"`
+	Type            string                  `json:"type"`
+	Recipient       string                  `json:"recipient"`
+	Message         string                  `json:"message"`
+	TemplateID      string                  `json:"template_id"`
+	TemplateVersion int32                   `json:"template_version"`
+	Variables       map[string]string       `json:"variables"`
+	Subject         string                  `json:"subject"`
+	From            string                  `json:"from"`
+	ReplyTo         string                  `json:"reply_to"`
+	Cc              []string                `json:"cc"`
+	Bcc             []string                `json:"bcc"`
+	Attachments     []mail.Attachment       `json:"attachments"`
+	TextMessage     string                  `json:"text_message"`
+	Title           string                  `json:"title"`
+	Badge           int32                   `json:"badge"`
+	Data            map[string]string       `json:"data"`
+	CollapseKey     string                  `json:"collapse_key"`
+	PushTTLSeconds  int64                   `json:"push_ttl_seconds"`
+	Category        string                  `json:"category"`
+	Fallback        []notifier.FallbackStep `json:"fallback"`
+	TimeoutSeconds  int64                   `json:"timeout_seconds"`
+	Priority        string                  `json:"priority"`
+	ExpiresAt       int64                   `json:"expires_at"`
+}
+
+// ErrExpired is returned with tasks whose expires_at has passed. They are
+// dropped instead of queued or delivered.
+var ErrExpired = errors.New("notification expired")
+
+// Expired reports whether the task must no longer be delivered at now.
+func (t *QueuedTask) Expired(now time.Time) bool {
+	return t.ExpiresAt > 0 && now.Unix() >= t.ExpiresAt
 }
 
+// NewLimiter keeps the limiter state in the Redis server at addr.
 func NewLimiter(addr string, rateLimit int, timeWindow time.Duration) *Limiter {
-	rdb := redis.NewClient(&redis.Options{
-		Addr: addr,
-	})
+	return NewLimiterWithStore(NewRedisStore(addr), rateLimit, timeWindow)
+}
+
+func NewLimiterWithStore(store LimiterStore, rateLimit int, timeWindow time.Duration) *Limiter {
 	return &Limiter{
-		rdb:        rdb,
+		store:      store,
 		rateLimit:  rateLimit,
 		timeWindow: timeWindow,
 	}
 }
 
+// SetPolicy changes the per-user limit and the window. Counters already
+// running keep their window until they expire.
+func (l *Limiter) SetPolicy(rateLimit int, timeWindow time.Duration) error {
+	if rateLimit < 1 || timeWindow <= 0 {
+		return fmt.Errorf("invalid rate limit %d per %s", rateLimit, timeWindow)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rateLimit, l.timeWindow = rateLimit, timeWindow
+	return nil
+}
+
+func (l *Limiter) policy() (int, time.Duration) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.rateLimit, l.timeWindow
+}
+
+// UseTenants applies the per-user limits and tenant quotas of the registry.
+func (l *Limiter) UseTenants(reg *tenant.Registry) {
+	l.tenants = reg
+}
+
+// AllowOrQueue counts task against the user's rate limit and the tenant's
+// quota and queues it in Redis once either is exceeded. Critical tasks such
+// as OTP codes are exempt from the user's limit but still count against the
+// quota. Expired tasks are rejected with ErrExpired. Keys are scoped to the
+// tenant of ctx.
 func (l *Limiter) AllowOrQueue(ctx context.Context, task QueuedTask) (bool, error) {
-	key := fmt.Sprintf("rate_limit:%s", task.UserID)
-	count, err := l.rdb.Incr(ctx, key).Result()
-	if err != nil {
-		return false, err
+	if task.Expired(time.Now()) {
+		return false, ErrExpired
 	}
 
-	if count == 1 {
-		l.rdb.Expire(ctx, key, l.timeWindow)
+	allowed, err := l.take(ctx, budgetUser(task))
+	if err != nil {
+		return false, err
 	}
 
-	if int(count) > l.rateLimit {
+	if !allowed {
 		// Exceeded limit - queue the task
-		queueKey := fmt.Sprintf("queue:%s", task.UserID)
-		data, err := json.Marshal(task)
-		if err != nil {
-			return false, err
-		}
-		err = l.rdb.RPush(ctx, queueKey, data).Err()
-		if err != nil {
-			return false, err
-		}
-		return false, nil
+		return false, l.store.Push(ctx, task, false)
 	}
 	return true, nil
 }
 
+// Defer puts back a task that was allowed but could not be dispatched, ahead
+// of the user's other queued tasks, and returns the budget it used.
+func (l *Limiter) Defer(ctx context.Context, task QueuedTask) error {
+	if err := l.store.Push(ctx, task, true); err != nil {
+		return err
+	}
+	l.release(ctx, budgetUser(task))
+	return nil
+}
+
+// PopQueuedTask returns the oldest queued task of the user, or nil if there
+// is none. An expired task is returned together with ErrExpired.
 func (l *Limiter) PopQueuedTask(ctx context.Context, userID string) (*QueuedTask, error) {
-	queueKey := fmt.Sprintf("queue:%s", userID)
-	data, err := l.rdb.LPop(ctx, queueKey).Result()
-	if err == redis.Nil {
-		return nil, nil // empty
-	} else if err != nil {
+	task, err := l.store.Pop(ctx, userID)
+	if task == nil || err != nil {
 		return nil, err
 	}
+	if task.Expired(time.Now()) {
+		return task, ErrExpired
+	}
+	return task, nil
+}
 
-	var task QueuedTask
-	err = json.Unmarshal([]byte(data), &task)
-	if err != nil {
+// NextQueuedTask pops the oldest queued task of the user if it fits the
+// budget, and returns nil otherwise. Like AllowOrQueue, a critical task only
+// needs the tenant's quota. Like PopQueuedTask it returns expired tasks with
+// ErrExpired; those do not use up the budget.
+func (l *Limiter) NextQueuedTask(ctx context.Context, userID string) (*QueuedTask, error) {
+	task, err := l.PopQueuedTask(ctx, userID)
+	if task == nil || err != nil {
+		return task, err
+	}
+
+	allowed, err := l.take(ctx, budgetUser(*task))
+	if err != nil || !allowed {
+		// Back to the head of the queue, to keep its turn.
+		if perr := l.store.Push(ctx, *task, true); perr != nil {
+			return nil, errors.Join(err, fmt.Errorf("putting back task %s: %w", task.ID, perr))
+		}
 		return nil, err
 	}
-	return &task, nil
+	return task, nil
+}
+
+// QueuedTenants lists the tenants that have tasks in an overflow queue.
+func (l *Limiter) QueuedTenants(ctx context.Context) ([]string, error) {
+	return l.store.QueuedTenants(ctx)
+}
+
+// QueuedUsers lists the users of the tenant of ctx that have tasks in their
+// overflow queue.
+func (l *Limiter) QueuedUsers(ctx context.Context) ([]string, error) {
+	return l.store.QueuedUsers(ctx)
+}
+
+// limits returns the per-user limit and the tenant quota (0 for none) of
+// the tenant of ctx.
+func (l *Limiter) limits(ctx context.Context) (int, int) {
+	userLimit, _ := l.policy()
+	quota := 0
+	if cfg := l.tenants.Get(tenant.FromContext(ctx)); cfg != nil {
+		if cfg.RateLimit > 0 {
+			userLimit = cfg.RateLimit
+		}
+		quota = cfg.Quota
+	}
+	return userLimit, quota
+}
+
+// take uses one unit of the user's budget, and of the tenant's quota, for
+// the current window if any is left. Without a user only the quota is
+// used.
+func (l *Limiter) take(ctx context.Context, userID string) (bool, error) {
+	userLimit, quota := l.limits(ctx)
+	if userID == "" && quota == 0 {
+		return true, nil
+	}
+	_, window := l.policy()
+	return l.store.Take(ctx, userID, userLimit, quota, window)
+}
+
+// budgetUser is the user whose budget task is charged to, or "" for a
+// critical task, which only uses the tenant's quota.
+func budgetUser(task QueuedTask) string {
+	if task.Priority == priority.Critical {
+		return ""
+	}
+	return task.UserID
+}
+
+// release gives back a unit taken for a task that was not sent.
+func (l *Limiter) release(ctx context.Context, userID string) {
+	_, quota := l.limits(ctx)
+	if userID == "" && quota == 0 {
+		return
+	}
+	l.store.Release(ctx, userID, quota > 0)
 }
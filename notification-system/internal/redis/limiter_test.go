@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lazypanda2004/notification-system/internal/priority"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
+
+type send struct {
+	user     string
+	priority string
+	want     bool // allowed, else queued
+}
+
+func TestAllowOrQueue(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota int
+		sends []send
+	}{
+		{
+			name: "user limit",
+			sends: []send{
+				{"alice", "", true}, {"alice", "", true}, {"alice", "", false},
+				{"bob", "", true},
+			},
+		},
+		{
+			name: "critical skips the user limit",
+			sends: []send{
+				{"alice", "", true}, {"alice", "", true},
+				{"alice", priority.Critical, true}, {"alice", priority.Critical, true},
+				{"alice", "", false},
+			},
+		},
+		{
+			name:  "quota holds every user",
+			quota: 3,
+			sends: []send{
+				{"alice", "", true}, {"bob", "", true}, {"carol", "", true},
+				{"dave", "", false},
+			},
+		},
+		{
+			name:  "critical counts against the quota",
+			quota: 3,
+			sends: []send{
+				{"alice", priority.Critical, true}, {"alice", priority.Critical, true},
+				{"bob", "", true},
+				{"carol", "", false},
+				{"alice", priority.Critical, false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for name, newStore := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				l := NewLimiterWithStore(newStore(t), 2, time.Minute)
+				l.UseTenants(registry(t, tt.quota))
+				ctx := tenant.WithTenant(context.Background(), "acme")
+
+				for i, s := range tt.sends {
+					got, err := l.AllowOrQueue(ctx, QueuedTask{ID: strconv.Itoa(i), UserID: s.user, Priority: s.priority})
+					if err != nil {
+						t.Fatalf("send %d: %v", i, err)
+					}
+					if got != s.want {
+						t.Errorf("send %d (%s, %q) allowed = %v, want %v", i, s.user, s.priority, got, s.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCriticalTasksOutsideAllowOrQueue(t *testing.T) {
+	type step struct {
+		op       string // send, park (send and park it), queue (push it) or next (NextQueuedTask)
+		user     string
+		priority string
+		want     bool // allowed, or popped for next
+	}
+	tests := []struct {
+		name  string
+		quota int
+		steps []step
+	}{
+		{
+			name:  "parking a critical task gives its quota back",
+			quota: 2,
+			steps: []step{
+				{"park", "alice", priority.Critical, true},
+				{"send", "bob", "", true},
+				{"send", "carol", "", true},
+				{"send", "dave", "", false},
+			},
+		},
+		{
+			name:  "queued critical task skips the user limit",
+			quota: 4,
+			steps: []step{
+				{"send", "alice", "", true}, {"send", "alice", "", true},
+				{"queue", "alice", priority.Critical, false},
+				{"next", "alice", "", true},
+				{"queue", "alice", "", false},
+				{"next", "alice", "", false},
+			},
+		},
+		{
+			name:  "queued critical task needs the quota",
+			quota: 2,
+			steps: []step{
+				{"send", "alice", "", true}, {"send", "bob", "", true},
+				{"queue", "alice", priority.Critical, false},
+				{"next", "alice", "", false},
+				{"next", "alice", "", false}, // still at the head
+			},
+		},
+	}
+	for _, tt := range tests {
+		for name, newStore := range stores {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				store := newStore(t)
+				l := NewLimiterWithStore(store, 2, time.Minute)
+				l.UseTenants(registry(t, tt.quota))
+				ctx := tenant.WithTenant(context.Background(), "acme")
+
+				for i, s := range tt.steps {
+					task := QueuedTask{ID: strconv.Itoa(i), UserID: s.user, Priority: s.priority, Type: "sms"}
+					var got bool
+					var err error
+					switch s.op {
+					case "send", "park":
+						got, err = l.AllowOrQueue(ctx, task)
+						if err == nil && s.op == "park" {
+							err = l.Park(ctx, task)
+						}
+					case "queue":
+						err = store.Push(ctx, task, false)
+					case "next":
+						var next *QueuedTask
+						next, err = l.NextQueuedTask(ctx, s.user)
+						got = next != nil
+					}
+					if err != nil {
+						t.Fatalf("step %d (%s): %v", i, s.op, err)
+					}
+					if got != s.want {
+						t.Errorf("step %d (%s %s, %q) = %v, want %v", i, s.op, s.user, s.priority, got, s.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// stores are the LimiterStores every test runs against.
+var stores = map[string]func(t *testing.T) LimiterStore{
+	"memory": func(t *testing.T) LimiterStore { return NewMemoryStore() },
+	"redis":  func(t *testing.T) LimiterStore { return NewRedisStore(miniredis.RunT(t).Addr()) },
+}
+
+// registry configures tenant acme with quota.
+func registry(t *testing.T, quota int) *tenant.Registry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	config := `[{"id": "acme", "quota": ` + strconv.Itoa(quota) + `}]`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := tenant.LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
@@ -0,0 +1,242 @@
+package redis
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
+
+// MemoryStore keeps the limiter state in process, for a single load
+// balancer in development and tests. Nothing survives a restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter                // by counterKey and quotaKey
+	queues   map[string]map[string][]QueuedTask // by tenant and user
+	paused   map[string]bool
+	parked   map[string][]QueuedTask // by channel
+}
+
+type counter struct {
+	n       int
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]*counter),
+		queues:   make(map[string]map[string][]QueuedTask),
+		paused:   make(map[string]bool),
+		parked:   make(map[string][]QueuedTask),
+	}
+}
+
+// incr adds delta to the counter under key, starting a new window of
+// length window when it has expired. Call with mu held.
+func (s *MemoryStore) incr(key string, delta int, window time.Duration) int {
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expires) {
+		c = &counter{expires: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.n += delta
+	return c.n
+}
+
+// decr undoes incr, leaving an expired counter alone. Call with mu held.
+func (s *MemoryStore) decr(key string) {
+	if c, ok := s.counters[key]; ok && time.Now().Before(c.expires) {
+		c.n--
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, userID string, limit, quota int, window time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Like takeScript the user's count goes up even when over the limit.
+	userKey := counterKey(ctx, userID)
+	if userID != "" && s.incr(userKey, 1, window) > limit {
+		return false, nil
+	}
+	if quota > 0 && s.incr(quotaKey(ctx), 1, window) > quota {
+		if userID != "" {
+			s.decr(userKey)
+		}
+		s.decr(quotaKey(ctx))
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, userID string, quota bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != "" {
+		s.decr(counterKey(ctx, userID))
+	}
+	if quota {
+		s.decr(quotaKey(ctx))
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, counterKey(ctx, userID))
+	return nil
+}
+
+func (s *MemoryStore) Push(ctx context.Context, task QueuedTask, front bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := tenant.FromContext(ctx)
+	users, ok := s.queues[id]
+	if !ok {
+		users = make(map[string][]QueuedTask)
+		s.queues[id] = users
+	}
+	if front {
+		users[task.UserID] = append([]QueuedTask{task}, users[task.UserID]...)
+	} else {
+		users[task.UserID] = append(users[task.UserID], task)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Pop(ctx context.Context, userID string) (*QueuedTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := tenant.FromContext(ctx)
+	q := s.queues[id][userID]
+	if len(q) == 0 {
+		return nil, nil
+	}
+	task := q[0]
+	s.setQueue(id, userID, q[1:])
+	return &task, nil
+}
+
+// setQueue replaces the user's queue. Empty queues, and tenants without
+// queues, are removed so QueuedUsers and QueuedTenants list only the
+// non-empty ones. Call with mu held.
+func (s *MemoryStore) setQueue(tenantID, userID string, q []QueuedTask) {
+	if len(q) > 0 {
+		s.queues[tenantID][userID] = q
+		return
+	}
+	delete(s.queues[tenantID], userID)
+	if len(s.queues[tenantID]) == 0 {
+		delete(s.queues, tenantID)
+	}
+}
+
+func (s *MemoryStore) Peek(ctx context.Context, userID string, limit int) ([]QueuedTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[tenant.FromContext(ctx)][userID]
+	return slices.Clone(q[:min(limit, len(q))]), nil
+}
+
+func (s *MemoryStore) Purge(ctx context.Context, userID string) ([]QueuedTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := tenant.FromContext(ctx)
+	q := s.queues[id][userID]
+	if len(q) > 0 {
+		s.setQueue(id, userID, nil)
+	}
+	return q, nil
+}
+
+func (s *MemoryStore) Len(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.queues[tenant.FromContext(ctx)][userID])), nil
+}
+
+func (s *MemoryStore) QueuedTenants(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for id := range s.queues {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) QueuedUsers(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []string
+	for userID := range s.queues[tenant.FromContext(ctx)] {
+		users = append(users, userID)
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) Pause(ctx context.Context, channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused[channel] = true
+	return nil
+}
+
+func (s *MemoryStore) Resume(ctx context.Context, channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.paused, channel)
+	return nil
+}
+
+func (s *MemoryStore) Paused(ctx context.Context, channel string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused[channel], nil
+}
+
+func (s *MemoryStore) PausedChannels(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var channels []string
+	for c := range s.paused {
+		channels = append(channels, c)
+	}
+	return channels, nil
+}
+
+func (s *MemoryStore) Park(ctx context.Context, task QueuedTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parked[task.Type] = append(s.parked[task.Type], task)
+	return nil
+}
+
+func (s *MemoryStore) Unpark(ctx context.Context, channel string) (*QueuedTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.parked[channel]
+	if len(q) == 0 {
+		return nil, nil
+	}
+	task := q[0]
+	if len(q) == 1 {
+		delete(s.parked, channel)
+	} else {
+		s.parked[channel] = q[1:]
+	}
+	return &task, nil
+}
+
+func (s *MemoryStore) ParkedChannels(ctx context.Context) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int64, len(s.parked))
+	for c, q := range s.parked {
+		out[c] = int64(len(q))
+	}
+	return out, nil
+}
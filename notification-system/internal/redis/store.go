@@ -0,0 +1,323 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// LimiterStore keeps the state of a Limiter. Counters and overflow queues
+// belong to the tenant of ctx; paused channels and parked tasks are shared
+// by all tenants, and parked tasks carry their tenant id.
+type LimiterStore interface {
+	// Take counts one task against the user's limit and, when quota is
+	// positive, against the tenant's quota, in windows starting with the
+	// first count. Nothing is counted for the tenant when the user is over
+	// the limit, and the user's count is given back when the tenant is over
+	// its quota. With an empty userID only the quota is counted.
+	Take(ctx context.Context, userID string, limit, quota int, window time.Duration) (bool, error)
+	// Release gives back a count of Take, and of the tenant's if quota. With
+	// an empty userID only the tenant's count is given back.
+	Release(ctx context.Context, userID string, quota bool) error
+	// Reset clears the user's count.
+	Reset(ctx context.Context, userID string) error
+
+	// Push adds task to the back, or the front, of its user's queue.
+	Push(ctx context.Context, task QueuedTask, front bool) error
+	// Pop removes the oldest task of the user's queue, or returns nil.
+	Pop(ctx context.Context, userID string) (*QueuedTask, error)
+	Peek(ctx context.Context, userID string, limit int) ([]QueuedTask, error)
+	Purge(ctx context.Context, userID string) ([]QueuedTask, error)
+	Len(ctx context.Context, userID string) (int64, error)
+	// QueuedTenants lists the tenants with a non-empty queue, and
+	// QueuedUsers the users of the tenant of ctx with one.
+	QueuedTenants(ctx context.Context) ([]string, error)
+	QueuedUsers(ctx context.Context) ([]string, error)
+
+	Pause(ctx context.Context, channel string) error
+	Resume(ctx context.Context, channel string) error
+	Paused(ctx context.Context, channel string) (bool, error)
+	PausedChannels(ctx context.Context) ([]string, error)
+	// Park holds task until Unpark returns it, oldest first.
+	Park(ctx context.Context, task QueuedTask) error
+	Unpark(ctx context.Context, channel string) (*QueuedTask, error)
+	ParkedChannels(ctx context.Context) (map[string]int64, error)
+}
+
+// RedisStore shares the limiter state between processes through Redis.
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(addr string) *RedisStore {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &RedisStore{rdb: rdb}
+}
+
+// Sets of users with a non-empty overflow queue (per tenant) and of tenants
+// with such users, so the queues can be drained without scanning the
+// keyspace. They are outside "queue:", where any user id names a queue.
+const (
+	queuedUsersKey   = "queue-index:users"
+	queuedTenantsKey = "queue-index:tenants"
+)
+
+// Paused channels and the tasks parked while their channel is paused.
+const (
+	pausedChannelsKey = "paused_channels"
+	parkedChannelsKey = "parked_channels"
+)
+
+func queueKey(ctx context.Context, userID string) string {
+	return tenant.Key(ctx, fmt.Sprintf("queue:%s", userID))
+}
+
+func counterKey(ctx context.Context, userID string) string {
+	return tenant.Key(ctx, fmt.Sprintf("rate_limit:%s", userID))
+}
+
+func quotaKey(ctx context.Context) string {
+	return fmt.Sprintf("tenant_quota:%s", tenant.FromContext(ctx))
+}
+
+func parkedKey(channel string) string {
+	return fmt.Sprintf("parked:%s", channel)
+}
+
+// popScript pops the oldest queued task and forgets the user, and then the
+// tenant, once their queues are empty, atomically so a concurrent push
+// cannot be missed.
+var popScript = redis.NewScript(`
+local data = redis.call('LPOP', KEYS[1])
+if redis.call('LLEN', KEYS[1]) == 0 then
+	redis.call('SREM', KEYS[2], ARGV[1])
+	if redis.call('SCARD', KEYS[2]) == 0 then
+		redis.call('SREM', KEYS[3], ARGV[2])
+	end
+end
+return data
+`)
+
+// takeScript implements Take for the user's and the tenant's counters, or
+// for the tenant's alone when it is the only key.
+var takeScript = redis.NewScript(`
+local quota = KEYS[#KEYS]
+local user = #KEYS == 2 and KEYS[1]
+if user then
+	local n = redis.call('INCR', user)
+	if n == 1 then
+		redis.call('PEXPIRE', user, ARGV[3])
+	end
+	if n > tonumber(ARGV[1]) then
+		return 0
+	end
+end
+if tonumber(ARGV[2]) > 0 then
+	local t = redis.call('INCR', quota)
+	if t == 1 then
+		redis.call('PEXPIRE', quota, ARGV[3])
+	end
+	if t > tonumber(ARGV[2]) then
+		if user then
+			redis.call('DECR', user)
+		end
+		redis.call('DECR', quota)
+		return 0
+	end
+end
+return 1
+`)
+
+// unparkScript pops a parked task and forgets the channel once it has none
+// left, like popScript does for the overflow queues.
+var unparkScript = redis.NewScript(`
+local data = redis.call('LPOP', KEYS[1])
+if redis.call('LLEN', KEYS[1]) == 0 then
+	redis.call('SREM', KEYS[2], ARGV[1])
+end
+return data
+`)
+
+// purgeScript empties a queue and forgets the user, and then the tenant,
+// atomically like popScript.
+var purgeScript = redis.NewScript(`
+local data = redis.call('LRANGE', KEYS[1], 0, -1)
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+if redis.call('SCARD', KEYS[2]) == 0 then
+	redis.call('SREM', KEYS[3], ARGV[2])
+end
+return data
+`)
+
+func (s *RedisStore) Take(ctx context.Context, userID string, limit, quota int, window time.Duration) (bool, error) {
+	keys := []string{quotaKey(ctx)}
+	if userID != "" {
+		keys = []string{counterKey(ctx, userID), quotaKey(ctx)}
+	}
+	ok, err := takeScript.Run(ctx, s.rdb, keys, limit, quota, window.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, userID string, quota bool) error {
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if userID != "" {
+			pipe.Decr(ctx, counterKey(ctx, userID))
+		}
+		if quota {
+			pipe.Decr(ctx, quotaKey(ctx))
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Reset(ctx context.Context, userID string) error {
+	return s.rdb.Del(ctx, counterKey(ctx, userID)).Err()
+}
+
+func (s *RedisStore) Push(ctx context.Context, task QueuedTask, front bool) error {
+	key := queueKey(ctx, task.UserID)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if front {
+			pipe.LPush(ctx, key, data)
+		} else {
+			pipe.RPush(ctx, key, data)
+		}
+		pipe.SAdd(ctx, tenant.Key(ctx, queuedUsersKey), task.UserID)
+		pipe.SAdd(ctx, queuedTenantsKey, tenant.FromContext(ctx))
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Pop(ctx context.Context, userID string) (*QueuedTask, error) {
+	keys := []string{queueKey(ctx, userID), tenant.Key(ctx, queuedUsersKey), queuedTenantsKey}
+	data, err := popScript.Run(ctx, s.rdb, keys, userID, tenant.FromContext(ctx)).Text()
+	if err == redis.Nil {
+		return nil, nil // empty
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeTask(data)
+}
+
+func (s *RedisStore) Peek(ctx context.Context, userID string, limit int) ([]QueuedTask, error) {
+	data, err := s.rdb.LRange(ctx, queueKey(ctx, userID), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeTasks(data), nil
+}
+
+func (s *RedisStore) Purge(ctx context.Context, userID string) ([]QueuedTask, error) {
+	keys := []string{queueKey(ctx, userID), tenant.Key(ctx, queuedUsersKey), queuedTenantsKey}
+	data, err := purgeScript.Run(ctx, s.rdb, keys, userID, tenant.FromContext(ctx)).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	return decodeTasks(data), nil
+}
+
+func (s *RedisStore) Len(ctx context.Context, userID string) (int64, error) {
+	return s.rdb.LLen(ctx, queueKey(ctx, userID)).Result()
+}
+
+func (s *RedisStore) QueuedTenants(ctx context.Context) ([]string, error) {
+	return s.rdb.SMembers(ctx, queuedTenantsKey).Result()
+}
+
+func (s *RedisStore) QueuedUsers(ctx context.Context) ([]string, error) {
+	return s.rdb.SMembers(ctx, tenant.Key(ctx, queuedUsersKey)).Result()
+}
+
+func (s *RedisStore) Pause(ctx context.Context, channel string) error {
+	return s.rdb.SAdd(ctx, pausedChannelsKey, channel).Err()
+}
+
+func (s *RedisStore) Resume(ctx context.Context, channel string) error {
+	return s.rdb.SRem(ctx, pausedChannelsKey, channel).Err()
+}
+
+func (s *RedisStore) Paused(ctx context.Context, channel string) (bool, error) {
+	return s.rdb.SIsMember(ctx, pausedChannelsKey, channel).Result()
+}
+
+func (s *RedisStore) PausedChannels(ctx context.Context) ([]string, error) {
+	return s.rdb.SMembers(ctx, pausedChannelsKey).Result()
+}
+
+func (s *RedisStore) Park(ctx context.Context, task QueuedTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, parkedKey(task.Type), data)
+		pipe.SAdd(ctx, parkedChannelsKey, task.Type)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Unpark(ctx context.Context, channel string) (*QueuedTask, error) {
+	keys := []string{parkedKey(channel), parkedChannelsKey}
+	data, err := unparkScript.Run(ctx, s.rdb, keys, channel).Text()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeTask(data)
+}
+
+func (s *RedisStore) ParkedChannels(ctx context.Context) (map[string]int64, error) {
+	channels, err := s.rdb.SMembers(ctx, parkedChannelsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(channels))
+	for _, c := range channels {
+		n, err := s.rdb.LLen(ctx, parkedKey(c)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			out[c] = n
+		}
+	}
+	return out, nil
+}
+
+func decodeTask(data string) (*QueuedTask, error) {
+	var task QueuedTask
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func decodeTasks(data []string) []QueuedTask {
+	tasks := make([]QueuedTask, 0, len(data))
+	for _, d := range data {
+		var t QueuedTask
+		if err := json.Unmarshal([]byte(d), &t); err != nil {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
@@ -0,0 +1,383 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	recurringDueKey = "recurring:due"       // sorted set: schedule id -> next run
+	recurringKey    = "recurring:schedules" // hash: schedule id -> Recurring
+
+	// Missed-run policies applied when a schedule is found overdue, e.g. after
+	// downtime.
+	MissedSkip    = "skip"     // drop missed occurrences, wait for the next one
+	MissedRunOnce = "run_once" // send a single notification for all missed ones
+	MissedCatchUp = "catch_up" // send one notification per missed occurrence
+
+	// An occurrence this close to its due time is never considered missed.
+	missedGrace = time.Minute
+	maxCatchUp  = 100
+)
+
+// advanceScript stores a schedule that fired, unless it changed since it
+// was loaded, e.g. was paused or deleted meanwhile. Without a next run the
+// schedule is taken off the due set.
+var advanceScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+if ARGV[4] == '' then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+else
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[1])
+end
+return 1
+`)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+)
+
+// Recurring is a cron schedule that publishes Notification on every occurrence.
+type Recurring struct {
+	ID              string          `json:"id"`
+	TenantID        string          `json:"tenant_id"`
+	Cron            string          `json:"cron"`
+	Timezone        string          `json:"timezone"`
+	UserID          string          `json:"user_id"`
+	Notification    json.RawMessage `json:"notification"`
+	Paused          bool            `json:"paused"`
+	MissedRunPolicy string          `json:"missed_run_policy"`
+	NextRun         int64           `json:"next_run"`
+	LastRun         int64           `json:"last_run"`
+}
+
+// OccurrenceFunc turns a schedule's stored notification into the payload for
+// one occurrence at the given time.
+type OccurrenceFunc func(r *Recurring, at time.Time) ([]byte, error)
+
+type CronScheduler struct {
+	rdb           *redis.Client
+	publisher     Publisher
+	occurrence    OccurrenceFunc
+	defaultPolicy string
+	pollInterval  time.Duration
+}
+
+func NewCronScheduler(addr string, publisher Publisher, occurrence OccurrenceFunc, defaultPolicy string) *CronScheduler {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &CronScheduler{
+		rdb:           rdb,
+		publisher:     publisher,
+		occurrence:    occurrence,
+		defaultPolicy: defaultPolicy,
+		pollInterval:  time.Second,
+	}
+}
+
+// Validate parses the cron expression, timezone and policy of r.
+func Validate(r *Recurring) (cron.Schedule, *time.Location, error) {
+	sched, err := cronParser.Parse(r.Cron)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q: %w", r.Cron, err)
+	}
+	loc := time.UTC
+	if r.Timezone != "" {
+		loc, err = time.LoadLocation(r.Timezone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid timezone %q: %w", r.Timezone, err)
+		}
+	}
+	switch r.MissedRunPolicy {
+	case MissedSkip, MissedRunOnce, MissedCatchUp:
+	default:
+		return nil, nil, fmt.Errorf("invalid missed run policy %q", r.MissedRunPolicy)
+	}
+	return sched, loc, nil
+}
+
+// Create validates and stores a new schedule and computes its first run.
+// The schedule belongs to the tenant of ctx.
+func (c *CronScheduler) Create(ctx context.Context, r *Recurring) error {
+	r.TenantID = tenant.FromContext(ctx)
+	if r.MissedRunPolicy == "" {
+		r.MissedRunPolicy = c.defaultPolicy
+	}
+	sched, loc, err := Validate(r)
+	if err != nil {
+		return err
+	}
+	r.NextRun = sched.Next(time.Now().In(loc)).Unix()
+	return c.save(ctx, r, !r.Paused)
+}
+
+// Get returns a schedule of the tenant of ctx.
+func (c *CronScheduler) Get(ctx context.Context, id string) (*Recurring, error) {
+	r, err := c.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.TenantID != tenant.FromContext(ctx) {
+		return nil, ErrScheduleNotFound
+	}
+	return r, nil
+}
+
+func (c *CronScheduler) load(ctx context.Context, id string) (*Recurring, error) {
+	r, _, err := c.loadRaw(ctx, id)
+	return r, err
+}
+
+// loadRaw is load that also returns the stored data, see advance.
+func (c *CronScheduler) loadRaw(ctx context.Context, id string) (*Recurring, string, error) {
+	data, err := c.rdb.HGet(ctx, recurringKey, id).Result()
+	if err == redis.Nil {
+		return nil, "", ErrScheduleNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	var r Recurring
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, "", err
+	}
+	return &r, data, nil
+}
+
+// List returns all schedules of the tenant of ctx, optionally only those of
+// one user.
+func (c *CronScheduler) List(ctx context.Context, userID string) ([]*Recurring, error) {
+	all, err := c.rdb.HGetAll(ctx, recurringKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var out []*Recurring
+	for id, data := range all {
+		var r Recurring
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			log.Printf("Skipping malformed schedule %s: %v", id, err)
+			continue
+		}
+		if r.TenantID != tenant.FromContext(ctx) || (userID != "" && r.UserID != userID) {
+			continue
+		}
+		out = append(out, &r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (c *CronScheduler) Pause(ctx context.Context, id string) (*Recurring, error) {
+	r, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.Paused = true
+	return r, c.save(ctx, r, false)
+}
+
+// Resume reactivates a paused schedule from the next occurrence after now;
+// occurrences that fell inside the pause are not treated as missed.
+func (c *CronScheduler) Resume(ctx context.Context, id string) (*Recurring, error) {
+	r, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	sched, loc, err := Validate(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Paused = false
+	r.NextRun = sched.Next(time.Now().In(loc)).Unix()
+	return r, c.save(ctx, r, true)
+}
+
+func (c *CronScheduler) Delete(ctx context.Context, id string) error {
+	if _, err := c.Get(ctx, id); err != nil {
+		return err
+	}
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, recurringDueKey, id)
+		pipe.HDel(ctx, recurringKey, id)
+		return nil
+	})
+	return err
+}
+
+func (c *CronScheduler) save(ctx context.Context, r *Recurring, active bool) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, recurringKey, r.ID, data)
+		if active {
+			pipe.ZAdd(ctx, recurringDueKey, redis.Z{Score: float64(r.NextRun), Member: r.ID})
+		} else {
+			pipe.ZRem(ctx, recurringDueKey, r.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+// advance saves r in place of loaded, the data it was loaded from, and
+// reports false when the stored schedule changed in between; the change
+// wins then.
+func (c *CronScheduler) advance(ctx context.Context, r *Recurring, loaded string, active bool) (bool, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return false, err
+	}
+	next := ""
+	if active {
+		next = strconv.FormatInt(r.NextRun, 10)
+	}
+	saved, err := advanceScript.Run(ctx, c.rdb, []string{recurringKey, recurringDueKey}, r.ID, loaded, data, next).Int()
+	return saved == 1, err
+}
+
+// Start fires due schedules until ctx is cancelled.
+func (c *CronScheduler) Start(ctx context.Context) error {
+	log.Println("Cron scheduler started")
+
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := c.fireDue(ctx); err != nil {
+				log.Printf("Cron scheduler error: %v", err)
+			}
+		}
+	}
+}
+
+func (c *CronScheduler) fireDue(ctx context.Context) error {
+	now := time.Now()
+	ids, err := claimScript.Run(ctx, c.rdb, []string{recurringDueKey},
+		now.Unix(), now.Add(leaseDuration).Unix(), batchSize).StringSlice()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		r, loaded, err := c.loadRaw(ctx, id)
+		if err == ErrScheduleNotFound {
+			c.rdb.ZRem(ctx, recurringDueKey, id)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if r.Paused {
+			c.advance(ctx, r, loaded, false)
+			continue
+		}
+
+		sched, loc, err := Validate(r)
+		if err != nil {
+			log.Printf("Pausing invalid schedule %s: %v", id, err)
+			r.Paused = true
+			c.advance(ctx, r, loaded, false)
+			continue
+		}
+
+		failed := false
+		for _, at := range c.occurrences(r, sched, loc, now) {
+			if err := c.publish(ctx, r, at); err != nil {
+				log.Printf("Failed to publish occurrence of schedule %s: %v", id, err)
+				failed = true
+				break
+			}
+			r.LastRun = at.Unix()
+		}
+
+		if !failed {
+			r.NextRun = sched.Next(now.In(loc)).Unix()
+		} else if r.LastRun >= r.NextRun {
+			// Resume after the last occurrence that made it out; the rest
+			// are retried on the next poll.
+			r.NextRun = sched.Next(time.Unix(r.LastRun, 0).In(loc)).Unix()
+		}
+		saved, err := c.advance(ctx, r, loaded, true)
+		if err != nil {
+			log.Printf("Failed to save schedule %s: %v", id, err)
+		} else if !saved {
+			log.Printf("Schedule %s changed while it fired, keeping the change", id)
+		}
+	}
+	return nil
+}
+
+// occurrences returns the occurrence times that should be published now,
+// applying the schedule's missed-run policy.
+func (c *CronScheduler) occurrences(r *Recurring, sched cron.Schedule, loc *time.Location, now time.Time) []time.Time {
+	due := time.Unix(r.NextRun, 0).In(loc)
+	if now.Sub(due) <= missedGrace {
+		return []time.Time{due}
+	}
+
+	switch r.MissedRunPolicy {
+	case MissedCatchUp:
+		var missed []time.Time
+		for at := due; !at.After(now) && len(missed) < maxCatchUp; at = sched.Next(at) {
+			missed = append(missed, at)
+		}
+		log.Printf("Schedule %s catching up on %d missed occurrence(s)", r.ID, len(missed))
+		return missed
+	case MissedRunOnce:
+		last := lastOccurrence(sched, due, now.In(loc))
+		log.Printf("Schedule %s missed occurrences from %s, running the one of %s once", r.ID, due, last)
+		return []time.Time{last}
+	default:
+		log.Printf("Schedule %s skipping missed occurrences from %s", r.ID, due)
+		return nil
+	}
+}
+
+// lastOccurrence returns the last occurrence of sched that is not after
+// now, given that due is one. It looks back from now in growing windows
+// rather than stepping through every occurrence since due.
+func lastOccurrence(sched cron.Schedule, due, now time.Time) time.Time {
+	last := due
+	for window := time.Minute; ; window *= 2 {
+		from := now.Add(-window)
+		if !from.After(due) {
+			break
+		}
+		if at := sched.Next(from); !at.After(now) {
+			last = at
+			break
+		}
+	}
+	for at := sched.Next(last); !at.After(now); at = sched.Next(at) {
+		last = at
+	}
+	return last
+}
+
+func (c *CronScheduler) publish(ctx context.Context, r *Recurring, at time.Time) error {
+	payload, err := c.occurrence(r, at)
+	if err != nil {
+		return err
+	}
+	return c.publisher.Publish(ctx, r.UserID, payload)
+}
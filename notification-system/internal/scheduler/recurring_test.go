@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestNextRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		cron     string
+		timezone string
+		from     string // RFC 3339
+		want     string // RFC 3339
+	}{
+		{"hourly", "0 * * * *", "", "2026-03-01T10:15:00Z", "2026-03-01T11:00:00Z"},
+		{"on the minute is not again", "*/15 * * * *", "", "2026-03-01T10:15:00Z", "2026-03-01T10:30:00Z"},
+		{"daily in a timezone", "0 9 * * *", "America/New_York", "2026-03-01T15:00:00Z", "2026-03-02T14:00:00Z"},
+		{"across daylight saving", "0 9 * * *", "America/New_York", "2026-03-08T00:00:00Z", "2026-03-08T13:00:00Z"},
+		{"weekdays skip the weekend", "30 8 * * 1-5", "Europe/Berlin", "2026-03-06T08:00:00Z", "2026-03-09T07:30:00Z"},
+		{"descriptor", "@monthly", "", "2026-03-15T00:00:00Z", "2026-04-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, loc, err := Validate(&Recurring{Cron: tt.cron, Timezone: tt.timezone, MissedRunPolicy: MissedSkip})
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			got := sched.Next(mustTime(t, tt.from).In(loc))
+			if want := mustTime(t, tt.want); !got.Equal(want) {
+				t.Errorf("Next = %s, want %s", got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Recurring
+		ok   bool
+	}{
+		{"valid", Recurring{Cron: "0 * * * *", Timezone: "Asia/Tokyo", MissedRunPolicy: MissedRunOnce}, true},
+		{"bad cron", Recurring{Cron: "61 * * * *", MissedRunPolicy: MissedSkip}, false},
+		{"seconds are not supported", Recurring{Cron: "0 0 * * * *", MissedRunPolicy: MissedSkip}, false},
+		{"bad timezone", Recurring{Cron: "0 * * * *", Timezone: "Mars/Olympus", MissedRunPolicy: MissedSkip}, false},
+		{"bad policy", Recurring{Cron: "0 * * * *", MissedRunPolicy: "sometimes"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Validate(&tt.r)
+			if (err == nil) != tt.ok {
+				t.Errorf("Validate error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	due := mustTime(t, "2026-03-01T10:00:00Z")
+	hours := func(from, n int) []time.Time {
+		var out []time.Time
+		for i := range n {
+			out = append(out, due.Add(time.Duration(from+i)*time.Hour))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+		now    time.Time
+		want   []time.Time
+	}{
+		{"on time", MissedSkip, due.Add(10 * time.Second), hours(0, 1)},
+		{"within the grace", MissedSkip, due.Add(missedGrace), hours(0, 1)},
+		{"skip", MissedSkip, due.Add(3*time.Hour + time.Minute), nil},
+		{"run once sends the latest", MissedRunOnce, due.Add(3*time.Hour + time.Minute), hours(3, 1)},
+		{"run once past the catch-up limit", MissedRunOnce, due.Add(500*time.Hour + 30*time.Minute), hours(500, 1)},
+		{"run once a year later", MissedRunOnce, due.Add(365*24*time.Hour + 59*time.Minute), hours(365*24, 1)},
+		{"catch up", MissedCatchUp, due.Add(3*time.Hour + time.Minute), hours(0, 4)},
+		{"catch up is capped", MissedCatchUp, due.Add(500 * time.Hour), hours(0, maxCatchUp)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Recurring{ID: "s1", Cron: "0 * * * *", MissedRunPolicy: tt.policy, NextRun: due.Unix()}
+			sched, loc, err := Validate(r)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			got := (&CronScheduler{}).occurrences(r, sched, loc, tt.now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences = %d times, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFireDueKeepsConcurrentChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		// change runs while the occurrence is being published.
+		change     func(c *CronScheduler, ctx context.Context, id string) error
+		wantErr    error
+		wantPaused bool
+		wantDue    bool
+	}{
+		{
+			name:    "unchanged schedule advances",
+			change:  func(c *CronScheduler, ctx context.Context, id string) error { return nil },
+			wantDue: true,
+		},
+		{
+			name: "pause wins",
+			change: func(c *CronScheduler, ctx context.Context, id string) error {
+				_, err := c.Pause(ctx, id)
+				return err
+			},
+			wantPaused: true,
+		},
+		{
+			name: "delete wins",
+			change: func(c *CronScheduler, ctx context.Context, id string) error {
+				return c.Delete(ctx, id)
+			},
+			wantErr: ErrScheduleNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var c *CronScheduler
+			var changeErr error
+			p := publisherFunc(func(ctx context.Context, key string, value []byte) error {
+				changeErr = tt.change(c, ctx, "s1")
+				return nil
+			})
+			c = NewCronScheduler(miniredis.RunT(t).Addr(), p,
+				func(r *Recurring, at time.Time) ([]byte, error) { return r.Notification, nil }, MissedSkip)
+
+			r := &Recurring{ID: "s1", Cron: "* * * * *", Notification: json.RawMessage(`{}`), MissedRunPolicy: MissedSkip}
+			if err := c.Create(ctx, r); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			// Make it due now.
+			r.NextRun = time.Now().Unix()
+			if err := c.save(ctx, r, true); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			if err := c.fireDue(ctx); err != nil {
+				t.Fatalf("fireDue: %v", err)
+			}
+			if changeErr != nil {
+				t.Fatalf("change: %v", changeErr)
+			}
+
+			got, err := c.Get(ctx, "s1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.Paused != tt.wantPaused {
+				t.Errorf("Paused = %v, want %v", got.Paused, tt.wantPaused)
+			}
+			_, err = c.rdb.ZScore(ctx, recurringDueKey, "s1").Result()
+			if due := err == nil; due != tt.wantDue {
+				t.Errorf("in the due set = %v, want %v", due, tt.wantDue)
+			}
+		})
+	}
+}
+
+type publisherFunc func(ctx context.Context, key string, value []byte) error
+
+func (f publisherFunc) Publish(ctx context.Context, key string, value []byte) error {
+	return f(ctx, key, value)
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	dueKey     = "scheduled:due"      // sorted set: notification id -> unix time it is due
+	payloadKey = "scheduled:payloads" // hash: notification id -> Entry
+	claimsKey  = "scheduled:claims"   // hash: notification id -> unix time its lease ends
+
+	batchSize = 100
+	// A claimed notification is pushed this far into the future so that it is
+	// released again if the process dies before it reaches the broker.
+	leaseDuration = 30 * time.Second
+	retryDelay    = 5 * time.Second
+)
+
+// Publisher hands a due notification over to the delivery pipeline.
+type Publisher interface {
+	Publish(ctx context.Context, key string, value []byte) error
+}
+
+type Scheduler struct {
+	rdb          *redis.Client
+	publisher    Publisher
+	pollInterval time.Duration
+}
+
+var (
+	ErrAlreadyScheduled = errors.New("notification is already scheduled")
+	ErrNotFound         = errors.New("notification not found or already sent")
+	// ErrClaimed is returned for a notification that is being released; it
+	// can no longer be changed.
+	ErrClaimed = errors.New("notification is being sent")
+)
+
+// Entry is a pending notification.
+type Entry struct {
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// claimScript moves every due id forward by the lease so only one poller
+// releases it, and returns the claimed ids. With a second key the end of
+// each lease is also stored there.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+	if KEYS[2] then
+		redis.call('HSET', KEYS[2], id, ARGV[2])
+	end
+end
+return ids
+`)
+
+// scheduleScript stores an entry unless its id is taken.
+var scheduleScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// changeScript cancels a pending notification, returning its entry, or
+// moves it to ARGV[3] when that is given, provided its entry is still
+// ARGV[4]. It returns 0 for an unknown or replaced id and -1 for one under
+// a lease that has not ended at ARGV[2].
+var changeScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+if tonumber(redis.call('HGET', KEYS[3], ARGV[1]) or '0') > tonumber(ARGV[2]) then
+	return -1
+end
+if ARGV[4] and redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[4] then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+if ARGV[3] then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+local data = redis.call('HGET', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return data or ''
+`)
+
+func NewScheduler(addr string, publisher Publisher) *Scheduler {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Scheduler{
+		rdb:          rdb,
+		publisher:    publisher,
+		pollInterval: time.Second,
+	}
+}
+
+// Schedule stores the payload until at, after which it is published with
+// key. It fails with ErrAlreadyScheduled if id is pending already.
+func (s *Scheduler) Schedule(ctx context.Context, id, key string, payload []byte, at time.Time) error {
+	data, err := json.Marshal(Entry{Key: key, Payload: payload})
+	if err != nil {
+		return err
+	}
+
+	added, err := scheduleScript.Run(ctx, s.rdb, []string{dueKey, payloadKey}, id, data, at.Unix()).Int()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return ErrAlreadyScheduled
+	}
+	return nil
+}
+
+// Cancel removes a pending notification and returns it. It fails with
+// ErrNotFound if the id is unknown or has already been released, and with
+// ErrClaimed while it is being released.
+func (s *Scheduler) Cancel(ctx context.Context, id string) (*Entry, error) {
+	res, err := s.change(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if data, _ := res.(string); data != "" {
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			log.Printf("Cancelled malformed scheduled notification %s: %v", id, err)
+		}
+	}
+	return &e, nil
+}
+
+// Reschedule moves a pending notification to a new due time. check, if not
+// nil, is given the pending entry first and its error stops the change. It
+// fails like Cancel.
+func (s *Scheduler) Reschedule(ctx context.Context, id string, at time.Time, check func(*Entry) error) error {
+	data, err := s.rdb.HGet(ctx, payloadKey, id).Result()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if check != nil {
+		var e Entry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return err
+		}
+		if err := check(&e); err != nil {
+			return err
+		}
+	}
+	_, err = s.change(ctx, id, at.Unix(), data)
+	return err
+}
+
+func (s *Scheduler) change(ctx context.Context, id string, args ...any) (any, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	res, err := changeScript.Run(ctx, s.rdb, []string{dueKey, payloadKey, claimsKey},
+		append([]any{id, now}, args...)...).Result()
+	if err != nil {
+		return nil, err
+	}
+	switch res {
+	case int64(0):
+		return nil, ErrNotFound
+	case int64(-1):
+		return nil, ErrClaimed
+	}
+	return res, nil
+}
+
+// Start releases due notifications until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) error {
+	log.Println("Scheduler started")
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.releaseDue(ctx); err != nil {
+				log.Printf("Scheduler release error: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) releaseDue(ctx context.Context) error {
+	now := time.Now()
+	ids, err := claimScript.Run(ctx, s.rdb, []string{dueKey, claimsKey},
+		now.Unix(), now.Add(leaseDuration).Unix(), batchSize).StringSlice()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		data, err := s.rdb.HGet(ctx, payloadKey, id).Result()
+		if err == redis.Nil {
+			s.remove(ctx, id)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		var e Entry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			log.Printf("Dropping malformed scheduled notification %s: %v", id, err)
+			s.remove(ctx, id)
+			continue
+		}
+
+		if err := s.publisher.Publish(ctx, e.Key, e.Payload); err != nil {
+			log.Printf("Failed to release scheduled notification %s: %v", id, err)
+			s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.ZAdd(ctx, dueKey, redis.Z{Score: float64(now.Add(retryDelay).Unix()), Member: id})
+				pipe.HDel(ctx, claimsKey, id)
+				return nil
+			})
+			continue
+		}
+
+		s.remove(ctx, id)
+		log.Printf("Released scheduled notification %s", id)
+	}
+	return nil
+}
+
+func (s *Scheduler) remove(ctx context.Context, id string) {
+	s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, dueKey, id)
+		pipe.HDel(ctx, payloadKey, id)
+		pipe.HDel(ctx, claimsKey, id)
+		return nil
+	})
+}
@@ -0,0 +1,185 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// recorder is a Publisher that remembers what it was given.
+type recorder struct {
+	mu       sync.Mutex
+	keys     []string
+	payloads []string
+	err      error
+}
+
+func (p *recorder) Publish(ctx context.Context, key string, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.keys = append(p.keys, key)
+	p.payloads = append(p.payloads, string(value))
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Second)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// run is given a scheduler holding notification "n1" of user "alice"
+		// due at due.
+		due  time.Time
+		run  func(t *testing.T, s *Scheduler, p *recorder)
+		want []string // payloads published
+	}{
+		{
+			name: "due notification is released once",
+			due:  past,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				s.releaseDue(ctx)
+				s.releaseDue(ctx)
+			},
+			want: []string{`"n1"`},
+		},
+		{
+			name: "future notification is held",
+			due:  future,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				s.releaseDue(ctx)
+			},
+		},
+		{
+			name: "duplicate id is rejected",
+			due:  future,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				err := s.Schedule(ctx, "n1", "mallory", []byte(`"other"`), past)
+				if !errors.Is(err, ErrAlreadyScheduled) {
+					t.Errorf("Schedule duplicate = %v, want %v", err, ErrAlreadyScheduled)
+				}
+				s.releaseDue(ctx)
+			},
+		},
+		{
+			name: "cancel returns the entry",
+			due:  future,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				e, err := s.Cancel(ctx, "n1")
+				if err != nil {
+					t.Fatalf("Cancel: %v", err)
+				}
+				if e.Key != "alice" || string(e.Payload) != `"n1"` {
+					t.Errorf("Cancel = %+v, want alice's entry", e)
+				}
+				if _, err := s.Cancel(ctx, "n1"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("second Cancel = %v, want %v", err, ErrNotFound)
+				}
+			},
+		},
+		{
+			name: "reschedule moves the due time",
+			due:  future,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				if err := s.Reschedule(ctx, "n1", past, nil); err != nil {
+					t.Fatalf("Reschedule: %v", err)
+				}
+				s.releaseDue(ctx)
+			},
+			want: []string{`"n1"`},
+		},
+		{
+			name: "check can stop a reschedule",
+			due:  past,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				stop := errors.New("expires first")
+				err := s.Reschedule(ctx, "n1", future, func(e *Entry) error {
+					if string(e.Payload) != `"n1"` {
+						t.Errorf("check got %s, want the pending entry", e.Payload)
+					}
+					return stop
+				})
+				if !errors.Is(err, stop) {
+					t.Errorf("Reschedule = %v, want %v", err, stop)
+				}
+				s.releaseDue(ctx)
+			},
+			want: []string{`"n1"`},
+		},
+		{
+			name: "notification replaced after the check is left alone",
+			due:  future,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				err := s.Reschedule(ctx, "n1", past, func(e *Entry) error {
+					s.Cancel(ctx, "n1")
+					return s.Schedule(ctx, "n1", "alice", []byte(`"other"`), future)
+				})
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Reschedule = %v, want %v", err, ErrNotFound)
+				}
+				s.releaseDue(ctx)
+			},
+		},
+		{
+			name: "claimed notification can not be changed",
+			due:  past,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				// Claim without releasing, as a poller that is publishing.
+				claimScript.Run(ctx, s.rdb, []string{dueKey, claimsKey},
+					time.Now().Unix(), time.Now().Add(leaseDuration).Unix(), batchSize)
+				if _, err := s.Cancel(ctx, "n1"); !errors.Is(err, ErrClaimed) {
+					t.Errorf("Cancel = %v, want %v", err, ErrClaimed)
+				}
+				if err := s.Reschedule(ctx, "n1", future, nil); !errors.Is(err, ErrClaimed) {
+					t.Errorf("Reschedule = %v, want %v", err, ErrClaimed)
+				}
+			},
+		},
+		{
+			name: "failed release ends the claim",
+			due:  past,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				p.err = errors.New("broker down")
+				s.releaseDue(ctx)
+				if _, err := s.Cancel(ctx, "n1"); err != nil {
+					t.Errorf("Cancel after failed release = %v", err)
+				}
+			},
+		},
+		{
+			name: "unknown id",
+			due:  future,
+			run: func(t *testing.T, s *Scheduler, p *recorder) {
+				if err := s.Reschedule(ctx, "n2", future, nil); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Reschedule = %v, want %v", err, ErrNotFound)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &recorder{}
+			s := NewScheduler(miniredis.RunT(t).Addr(), p)
+			if err := s.Schedule(ctx, "n1", "alice", []byte(`"n1"`), tt.due); err != nil {
+				t.Fatalf("Schedule: %v", err)
+			}
+			tt.run(t, s, p)
+			if len(p.payloads) != len(tt.want) {
+				t.Fatalf("published %v, want %v", p.payloads, tt.want)
+			}
+			for i := range tt.want {
+				if p.payloads[i] != tt.want[i] || p.keys[i] != "alice" {
+					t.Errorf("published %s with key %s, want %s with key alice", p.payloads[i], p.keys[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
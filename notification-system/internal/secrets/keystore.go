@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	kdfIterations = 600000
+	saltSize      = 16
+)
+
+var ErrWrongPassphrase = errors.New("keystore: wrong passphrase or corrupted entry")
+
+// keystoreFile is the on-disk format: entries are AES-256-GCM sealed with a
+// key derived from the passphrase, and bound to their name so they cannot
+// be swapped.
+type keystoreFile struct {
+	Salt    []byte            `json:"salt"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// Keystore is an encrypted file of named secrets for hosts without a secret
+// manager. Edit it with cmd/keystore.
+type Keystore struct {
+	path string
+	file keystoreFile
+	aead cipher.AEAD
+}
+
+// OpenKeystore reads the keystore at path, or starts an empty one if the
+// file does not exist yet.
+func OpenKeystore(path string, passphrase Secret) (*Keystore, error) {
+	if passphrase.Empty() {
+		return nil, errors.New("keystore: empty passphrase")
+	}
+
+	k := &Keystore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		k.file.Salt = make([]byte, saltSize)
+		rand.Read(k.file.Salt)
+	} else if err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &k.file); err != nil {
+		return nil, fmt.Errorf("keystore %s: %w", path, err)
+	}
+	if k.file.Entries == nil {
+		k.file.Entries = make(map[string][]byte)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase.Reveal(), k.file.Salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	k.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Get decrypts the named entry.
+func (k *Keystore) Get(name string) (Secret, error) {
+	sealed, ok := k.file.Entries[name]
+	if !ok {
+		return Secret{}, fmt.Errorf("%w: keystore:%s", ErrNotFound, name)
+	}
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return Secret{}, ErrWrongPassphrase
+	}
+	plain, err := k.aead.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil {
+		return Secret{}, ErrWrongPassphrase
+	}
+	return New(string(plain)), nil
+}
+
+// Set adds or replaces an entry. Call Save to write it.
+func (k *Keystore) Set(name string, value Secret) {
+	nonce := make([]byte, k.aead.NonceSize())
+	rand.Read(nonce)
+	k.file.Entries[name] = k.aead.Seal(nonce, nonce, []byte(value.Reveal()), []byte(name))
+}
+
+// Delete removes an entry and reports whether it existed.
+func (k *Keystore) Delete(name string) bool {
+	_, ok := k.file.Entries[name]
+	delete(k.file.Entries, name)
+	return ok
+}
+
+// Names lists the entries without decrypting them.
+func (k *Keystore) Names() []string {
+	var out []string
+	for name := range k.file.Entries {
+		out = append(out, name)
+	}
+	return out
+}
+
+// Save writes the keystore atomically, readable by the owner only, so a
+// running server never sees a partial file.
+func (k *Keystore) Save() error {
+	data, err := json.MarshalIndent(k.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), k.path)
+}
@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase string // used to open the saved file
+		modify     func(k *Keystore)
+		get        string
+		want       string
+		wantErr    error
+	}{
+		{name: "round trip", passphrase: "hunter2", get: "smtp", want: "smtp-password"},
+		{name: "empty value", passphrase: "hunter2", modify: func(k *Keystore) { k.Set("empty", New("")) }, get: "empty", want: ""},
+		{name: "wrong passphrase", passphrase: "hunter3", get: "smtp", wantErr: ErrWrongPassphrase},
+		{name: "missing entry", passphrase: "hunter2", get: "jwt", wantErr: ErrNotFound},
+		{name: "deleted entry", passphrase: "hunter2", modify: func(k *Keystore) { k.Delete("smtp") }, get: "smtp", wantErr: ErrNotFound},
+		{
+			name:       "entries cannot be swapped",
+			passphrase: "hunter2",
+			modify:     func(k *Keystore) { k.file.Entries["sms"] = k.file.Entries["smtp"] },
+			get:        "sms",
+			wantErr:    ErrWrongPassphrase,
+		},
+		{
+			name:       "truncated entry",
+			passphrase: "hunter2",
+			modify:     func(k *Keystore) { k.file.Entries["smtp"] = k.file.Entries["smtp"][:4] },
+			get:        "smtp",
+			wantErr:    ErrWrongPassphrase,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keystore.json")
+			k, err := OpenKeystore(path, New("hunter2"))
+			if err != nil {
+				t.Fatalf("OpenKeystore: %v", err)
+			}
+			k.Set("smtp", New("smtp-password"))
+			if tt.modify != nil {
+				tt.modify(k)
+			}
+			if err := k.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			k, err = OpenKeystore(path, New(tt.passphrase))
+			if err != nil {
+				t.Fatalf("OpenKeystore again: %v", err)
+			}
+			got, err := k.Get(tt.get)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get(%s) error = %v, want %v", tt.get, err, tt.wantErr)
+			}
+			if err == nil && got.Reveal() != tt.want {
+				t.Errorf("Get(%s) = %q, want %q", tt.get, got.Reveal(), tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenKeystoreNeedsPassphrase(t *testing.T) {
+	if _, err := OpenKeystore(filepath.Join(t.TempDir(), "keystore.json"), Secret{}); err == nil {
+		t.Error("OpenKeystore with an empty passphrase succeeded, want an error")
+	}
+}
+
+func TestStoreOpensKeystoreOnFirstUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	t.Setenv("KEYSTORE_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		name    string
+		create  bool // save a keystore with an smtp entry first
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{name: "env without a keystore file", ref: "env:KEYSTORE_TEST_SECRET", want: "from-env"},
+		{name: "literal without a keystore file", ref: "local-token", want: "local-token"},
+		{name: "keystore reference without the file", ref: "keystore:smtp", wantErr: ErrNotFound},
+		{name: "keystore reference once the file exists", create: true, ref: "keystore:smtp", want: "smtp-password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.create {
+				k, err := OpenKeystore(path, New("hunter2"))
+				if err != nil {
+					t.Fatalf("OpenKeystore: %v", err)
+				}
+				k.Set("smtp", New("smtp-password"))
+				if err := k.Save(); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+
+			got, err := NewStore(path, New("hunter2")).Get(tt.ref)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get(%s) error = %v, want %v", tt.ref, err, tt.wantErr)
+			}
+			if err == nil && got.Reveal() != tt.want {
+				t.Errorf("Get(%s) = %q, want %q", tt.ref, got.Reveal(), tt.want)
+			}
+		})
+	}
+}
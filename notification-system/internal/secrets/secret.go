@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"fmt"
+	"sync"
+)
+
+const redacted = "[redacted]"
+
+// Secret is a credential. It prints and marshals as "[redacted]" with every
+// fmt verb so it cannot leak through logs or %+v dumps; Reveal returns the
+// value where it is actually needed.
+type Secret struct {
+	value string
+}
+
+func New(value string) Secret {
+	return Secret{value: value}
+}
+
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+func (s Secret) Empty() bool {
+	return s.value == ""
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// Value follows one reference and always returns its latest resolved
+// value, so holders pick up rotations without being rebuilt.
+type Value struct {
+	ref string
+
+	mu      sync.RWMutex
+	current Secret
+}
+
+// Literal is a Value that never changes, for credentials configured in code
+// or left empty.
+func Literal(value string) *Value {
+	return &Value{current: New(value)}
+}
+
+// Get returns the current value. A nil Value is empty.
+func (v *Value) Get() Secret {
+	if v == nil {
+		return Secret{}
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.current
+}
+
+// Ref is the reference the value was resolved from.
+func (v *Value) Ref() string {
+	if v == nil {
+		return ""
+	}
+	return v.ref
+}
+
+func (v *Value) String() string {
+	return v.Get().String()
+}
+
+func (v *Value) set(s Secret) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	changed := v.current.value != s.value
+	v.current = s
+	return changed
+}
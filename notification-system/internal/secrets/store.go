@@ -0,0 +1,170 @@
+// Package secrets resolves credential references and keeps them current.
+//
+// A reference names where a secret lives:
+//
+//	env:NAME        environment variable
+//	file:/path      file contents without the trailing newline, e.g. a
+//	                mounted Kubernetes or Docker secret
+//	keystore:name   entry of the encrypted keystore, see Keystore
+//
+// Anything else is taken as the literal value, for local development.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Store resolves references once and re-resolves them on Reload, updating
+// the Values handed out so rotated credentials take effect in place.
+type Store struct {
+	keystorePath string
+	passphrase   Secret
+
+	mu            sync.Mutex
+	keystore      *Keystore
+	keystoreMtime time.Time
+	values        map[string]*Value
+}
+
+// NewStore creates a store. keystorePath may be empty when no keystore:
+// references are used. The keystore is opened on the first keystore:
+// reference, so a missing file only matters to those.
+func NewStore(keystorePath string, passphrase Secret) *Store {
+	return &Store{
+		keystorePath: keystorePath,
+		passphrase:   passphrase,
+		values:       make(map[string]*Value),
+	}
+}
+
+// Value resolves ref and returns a handle that follows its rotations. It
+// fails if the secret cannot be resolved, so missing credentials are
+// noticed at startup rather than on the first send.
+func (s *Store) Value(ref string) (*Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.values[ref]; ok {
+		return v, nil
+	}
+	secret, err := s.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	v := &Value{ref: ref, current: secret}
+	s.values[ref] = v
+	return v, nil
+}
+
+// Get returns the current value of ref, resolving it on first use.
+func (s *Store) Get(ref string) (Secret, error) {
+	v, err := s.Value(ref)
+	if err != nil {
+		return Secret{}, err
+	}
+	return v.Get(), nil
+}
+
+// Reload re-reads every resolved reference. A reference that can no longer
+// be resolved keeps its previous value and is reported in the error.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for ref, v := range s.values {
+		secret, err := s.resolve(ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if v.set(secret) {
+			log.Printf("Secret %s rotated", describe(ref))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch reloads the secrets every interval until ctx is done.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("Failed to reload secrets: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Store) resolve(ref string) (Secret, error) {
+	scheme, name, _ := strings.Cut(ref, ":")
+	switch scheme {
+	case "env":
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return Secret{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+		}
+		return New(v), nil
+	case "file":
+		data, err := os.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return Secret{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+		} else if err != nil {
+			return Secret{}, err
+		}
+		return New(strings.TrimRight(string(data), "\r\n")), nil
+	case "keystore":
+		if s.keystorePath == "" {
+			return Secret{}, fmt.Errorf("%w: %s, no keystore configured", ErrNotFound, ref)
+		}
+		if err := s.loadKeystore(); err != nil {
+			return Secret{}, err
+		}
+		return s.keystore.Get(name)
+	}
+	return New(ref), nil
+}
+
+// loadKeystore opens the keystore, or opens it again if the file changed
+// since it was last read. Key derivation is slow on purpose, so unchanged files are
+// skipped.
+func (s *Store) loadKeystore() error {
+	info, err := os.Stat(s.keystorePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: keystore %s does not exist", ErrNotFound, s.keystorePath)
+	} else if err != nil {
+		return fmt.Errorf("keystore: %w", err)
+	}
+	if s.keystore != nil && info.ModTime().Equal(s.keystoreMtime) {
+		return nil
+	}
+	k, err := OpenKeystore(s.keystorePath, s.passphrase)
+	if err != nil {
+		return err
+	}
+	s.keystore, s.keystoreMtime = k, info.ModTime()
+	return nil
+}
+
+// describe names a reference for logs. Literal values are not named.
+func describe(ref string) string {
+	switch scheme, _, _ := strings.Cut(ref, ":"); scheme {
+	case "env", "file", "keystore":
+		return ref
+	}
+	return "(literal)"
+}
@@ -0,0 +1,68 @@
+package sms
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+)
+
+// Query parameters that tie a status callback to its notification.
+const (
+	paramNotificationID = "notification_id"
+	paramUserID         = "user_id"
+	paramTenantID       = "tenant_id"
+)
+
+// CallbackURL is base with the notification the callback reports on
+// added to the query. The provider signs the full URL, so the parameters
+// can be trusted once the signature checks out.
+func CallbackURL(base, notificationID, userID, tenantID string) string {
+	if base == "" {
+		return ""
+	}
+	q := url.Values{}
+	q.Set(paramNotificationID, notificationID)
+	q.Set(paramUserID, userID)
+	q.Set(paramTenantID, tenantID)
+	return base + "?" + q.Encode()
+}
+
+// CallbackHandler receives delivery status callbacks. publicURL must be the
+// exact URL the provider was given, without the query CallbackURL adds,
+// since it is part of the signature. The current auth token is used, so
+// callbacks keep verifying after a rotation.
+func CallbackHandler(authToken *secrets.Value, publicURL string, onStatus func(StatusUpdate)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		signedURL := publicURL
+		if r.URL.RawQuery != "" {
+			signedURL += "?" + r.URL.RawQuery
+		}
+		if !ValidSignature(authToken.Get().Reveal(), signedURL, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+			log.Printf("Rejected SMS status callback with invalid signature")
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+
+		q := r.URL.Query()
+		onStatus(StatusUpdate{
+			NotificationID: q.Get(paramNotificationID),
+			UserID:         q.Get(paramUserID),
+			TenantID:       q.Get(paramTenantID),
+			MessageID:      r.PostForm.Get("MessageSid"),
+			To:             r.PostForm.Get("To"),
+			Status:         r.PostForm.Get("MessageStatus"),
+			ErrorCode:      r.PostForm.Get("ErrorCode"),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,80 @@
+package sms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+)
+
+func TestCallbackHandler(t *testing.T) {
+	const (
+		token     = "secret-token"
+		publicURL = "https://notify.example.com/callbacks/sms"
+	)
+	signed := CallbackURL(publicURL, "n1", "alice", "acme")
+	form := url.Values{"MessageSid": {"SM1"}, "To": {"+15551234567"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}
+
+	tests := []struct {
+		name       string
+		target     string // URL the request is sent to
+		signedURL  string // URL the signature is computed over
+		wantStatus int
+		want       StatusUpdate
+	}{
+		{
+			name:       "with the notification in the query",
+			target:     signed,
+			signedURL:  signed,
+			wantStatus: http.StatusNoContent,
+			want:       StatusUpdate{"n1", "alice", "acme", "SM1", "+15551234567", "undelivered", "30003"},
+		},
+		{
+			name:       "without a query",
+			target:     publicURL,
+			signedURL:  publicURL,
+			wantStatus: http.StatusNoContent,
+			want:       StatusUpdate{MessageID: "SM1", To: "+15551234567", Status: "undelivered", ErrorCode: "30003"},
+		},
+		{
+			name:       "query changed after signing",
+			target:     CallbackURL(publicURL, "n1", "alice", "other"),
+			signedURL:  signed,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "query signed but not sent",
+			target:     publicURL,
+			signedURL:  signed,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *StatusUpdate
+			h := CallbackHandler(secrets.Literal(token), publicURL, func(u StatusUpdate) { got = &u })
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Twilio-Signature", Signature(token, tt.signedURL, form))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusNoContent {
+				if got != nil {
+					t.Errorf("onStatus called with %+v, want no call", *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("onStatus got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
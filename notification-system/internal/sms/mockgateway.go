@@ -0,0 +1,177 @@
+package sms
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Magic destination numbers that make the mock gateway fail, so error
+// handling can be exercised offline.
+const (
+	MockInvalidNumber = "+15005550001"
+	MockUnsubscribed  = "+15005550004"
+	MockServerError   = "+15005550500"
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// SentMessage is a message accepted by the mock gateway.
+type SentMessage struct {
+	SID            string
+	To             string
+	From           string
+	Body           string
+	Segmentation   Segmentation
+	StatusCallback string
+	ReceivedAt     time.Time
+}
+
+// MockGateway is a local stand-in for the Twilio-style API used by
+// HTTPProvider. It records every accepted message and, when a status
+// callback is given, reports "sent" and "delivered" with signed requests.
+type MockGateway struct {
+	AccountSID    string
+	AuthToken     string
+	CallbackDelay time.Duration
+
+	mu       sync.Mutex
+	messages []SentMessage
+	client   *http.Client
+}
+
+func NewMockGateway(accountSID, authToken string) *MockGateway {
+	return &MockGateway{
+		AccountSID:    accountSID,
+		AuthToken:     authToken,
+		CallbackDelay: 100 * time.Millisecond,
+		client:        &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Messages returns a copy of everything the gateway accepted so far.
+func (g *MockGateway) Messages() []SentMessage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]SentMessage(nil), g.messages...)
+}
+
+func (g *MockGateway) Reset() {
+	g.mu.Lock()
+	g.messages = nil
+	g.mu.Unlock()
+}
+
+func (g *MockGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := "/2010-04-01/Accounts/" + g.AccountSID + "/Messages.json"
+	if r.URL.Path != path {
+		writeAPIError(w, http.StatusNotFound, 20404, "The requested resource was not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, 20004, "Method not allowed")
+		return
+	}
+	sid, token, ok := r.BasicAuth()
+	if !ok || sid != g.AccountSID || token != g.AuthToken {
+		writeAPIError(w, http.StatusUnauthorized, 20003, "Authenticate")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, 20001, "Invalid form body")
+		return
+	}
+
+	to := r.PostForm.Get("To")
+	switch {
+	case to == MockServerError:
+		writeAPIError(w, http.StatusInternalServerError, 20500, "Internal server error")
+		return
+	case to == MockInvalidNumber || !e164.MatchString(to):
+		writeAPIError(w, http.StatusBadRequest, codeInvalidNumber, "The 'To' number "+to+" is not a valid phone number.")
+		return
+	case to == MockUnsubscribed:
+		writeAPIError(w, http.StatusBadRequest, codeUnsubscribed, "Attempt to send to unsubscribed recipient")
+		return
+	}
+	if r.PostForm.Get("Body") == "" {
+		writeAPIError(w, http.StatusBadRequest, 21602, "Message body is required.")
+		return
+	}
+
+	msg := SentMessage{
+		SID:            "SM" + randomHex(16),
+		To:             to,
+		From:           r.PostForm.Get("From"),
+		Body:           r.PostForm.Get("Body"),
+		Segmentation:   Segment(r.PostForm.Get("Body")),
+		StatusCallback: r.PostForm.Get("StatusCallback"),
+		ReceivedAt:     time.Now(),
+	}
+	g.mu.Lock()
+	g.messages = append(g.messages, msg)
+	g.mu.Unlock()
+	log.Printf("Mock SMS gateway: accepted %s to %s (%d %s segment(s))",
+		msg.SID, msg.To, msg.Segmentation.Segments, msg.Segmentation.Encoding)
+
+	if msg.StatusCallback != "" {
+		go g.reportStatus(msg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"sid":          msg.SID,
+		"status":       "queued",
+		"to":           msg.To,
+		"from":         msg.From,
+		"body":         msg.Body,
+		"num_segments": strconv.Itoa(msg.Segmentation.Segments),
+	})
+}
+
+func (g *MockGateway) reportStatus(msg SentMessage) {
+	for _, status := range []string{"sent", "delivered"} {
+		time.Sleep(g.CallbackDelay)
+
+		form := url.Values{}
+		form.Set("MessageSid", msg.SID)
+		form.Set("To", msg.To)
+		form.Set("MessageStatus", status)
+
+		req, err := http.NewRequest(http.MethodPost, msg.StatusCallback, strings.NewReader(form.Encode()))
+		if err != nil {
+			log.Printf("Mock SMS gateway: bad callback URL %s: %v", msg.StatusCallback, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Twilio-Signature", Signature(g.AuthToken, msg.StatusCallback, form))
+
+		resp, err := g.client.Do(req)
+		if err != nil {
+			log.Printf("Mock SMS gateway: status callback failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Code: code, Message: message, Status: status})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
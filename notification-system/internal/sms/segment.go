@@ -0,0 +1,85 @@
+package sms
+
+import (
+	"unicode/utf16"
+)
+
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet; each character is one septet.
+var gsm7Basic = map[rune]bool{}
+
+// gsm7Extension characters are sent as an escape plus a septet, so they
+// count twice.
+var gsm7Extension = map[rune]bool{}
+
+func init() {
+	for _, r := range "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà" {
+		gsm7Basic[r] = true
+	}
+	for _, r := range "\f^{}\\[~]|€" {
+		gsm7Extension[r] = true
+	}
+}
+
+// Segmentation describes how a body is split into SMS segments.
+type Segmentation struct {
+	Encoding string
+	Units    int // septets for GSM-7, UTF-16 code units for UCS-2
+	Segments int
+}
+
+// Segment computes the encoding and segment count of body. GSM-7 fits 160
+// septets in a single message and 153 per part once concatenated; UCS-2 fits
+// 70 and 67.
+func Segment(body string) Segmentation {
+	septets, ok := gsm7Length(body)
+	if ok {
+		return Segmentation{
+			Encoding: EncodingGSM7,
+			Units:    septets,
+			Segments: segments(septets, 160, 153),
+		}
+	}
+
+	units := len(utf16.Encode([]rune(body)))
+	return Segmentation{
+		Encoding: EncodingUCS2,
+		Units:    units,
+		Segments: segments(units, 70, 67),
+	}
+}
+
+// Cost returns the price of sending the message at pricePerSegment.
+func (s Segmentation) Cost(pricePerSegment float64) float64 {
+	return float64(s.Segments) * pricePerSegment
+}
+
+func gsm7Length(body string) (int, bool) {
+	n := 0
+	for _, r := range body {
+		switch {
+		case gsm7Basic[r]:
+			n++
+		case gsm7Extension[r]:
+			n += 2
+		default:
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+func segments(units, single, multi int) int {
+	if units == 0 {
+		return 1
+	}
+	if units <= single {
+		return 1
+	}
+	return (units + multi - 1) / multi
+}
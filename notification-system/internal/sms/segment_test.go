@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSegment(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Segmentation
+	}{
+		{"empty", "", Segmentation{EncodingGSM7, 0, 1}},
+		{"short", "Your code is 123456", Segmentation{EncodingGSM7, 19, 1}},
+		{"accents in the basic alphabet", "Café à Göteborg", Segmentation{EncodingGSM7, 15, 1}},
+		{"single GSM-7 message", strings.Repeat("a", 160), Segmentation{EncodingGSM7, 160, 1}},
+		{"one septet over", strings.Repeat("a", 161), Segmentation{EncodingGSM7, 161, 2}},
+		{"two full GSM-7 parts", strings.Repeat("a", 306), Segmentation{EncodingGSM7, 306, 2}},
+		{"third GSM-7 part", strings.Repeat("a", 307), Segmentation{EncodingGSM7, 307, 3}},
+		{"extension characters count twice", strings.Repeat("€", 80), Segmentation{EncodingGSM7, 160, 1}},
+		{"extension character over the limit", strings.Repeat("a", 159) + "[", Segmentation{EncodingGSM7, 161, 2}},
+		{"character outside GSM-7", "Crème brûlée", Segmentation{EncodingUCS2, 12, 1}},
+		{"single UCS-2 message", strings.Repeat("ж", 70), Segmentation{EncodingUCS2, 70, 1}},
+		{"one unit over", strings.Repeat("ж", 71), Segmentation{EncodingUCS2, 71, 2}},
+		{"two full UCS-2 parts", strings.Repeat("ж", 134), Segmentation{EncodingUCS2, 134, 2}},
+		{"third UCS-2 part", strings.Repeat("ж", 135), Segmentation{EncodingUCS2, 135, 3}},
+		{"emoji are surrogate pairs", strings.Repeat("😀", 35), Segmentation{EncodingUCS2, 70, 1}},
+		{"one emoji turns it all UCS-2", strings.Repeat("a", 69) + "😀", Segmentation{EncodingUCS2, 71, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Segment(tt.body); got != tt.want {
+				t.Errorf("Segment = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Message is a single outbound SMS.
+type Message struct {
+	To             string
+	From           string
+	Body           string
+	StatusCallback string // URL the provider reports delivery status to
+}
+
+// Result is what the provider reported after accepting a message.
+type Result struct {
+	ID           string
+	Status       string
+	Segmentation Segmentation
+	Cost         float64
+}
+
+// Provider sends SMS through a gateway.
+type Provider interface {
+	Send(ctx context.Context, msg Message) (*Result, error)
+}
+
+var (
+	ErrInvalidNumber = errors.New("invalid destination number")
+	ErrUnsubscribed  = errors.New("recipient has unsubscribed")
+	ErrTooLong       = errors.New("message exceeds the segment limit")
+)
+
+// ProviderError is a failure response from the gateway.
+type ProviderError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	Retryable  bool
+	Err        error // one of the sentinel errors above, if the code maps to one
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("sms provider: status %d code %d: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// StatusUpdate is a delivery report received on the status callback.
+type StatusUpdate struct {
+	NotificationID string // from the CallbackURL query, empty without one
+	UserID         string
+	TenantID       string
+	MessageID      string
+	To             string
+	Status         string // queued, sent, delivered, undelivered or failed
+	ErrorCode      string
+}
+
+// Failed reports whether the message will not reach the recipient.
+func (u StatusUpdate) Failed() bool {
+	return u.Status == "undelivered" || u.Status == "failed"
+}
@@ -0,0 +1,177 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+)
+
+// Error codes of the Twilio-style API that map onto sentinel errors.
+const (
+	codeInvalidNumber = 21211
+	codeUnsubscribed  = 21610
+	codeRateLimited   = 20429
+)
+
+// HTTPProvider talks to a Twilio-style REST API:
+// POST {BaseURL}/2010-04-01/Accounts/{AccountSID}/Messages.json with a form
+// body, authenticated with the account SID and auth token.
+type HTTPProvider struct {
+	BaseURL         string
+	AccountSID      string
+	AuthToken       *secrets.Value
+	PricePerSegment float64
+	MaxSegments     int
+
+	mu     sync.RWMutex // guards the fields above once the provider is in use
+	client *http.Client
+}
+
+func NewHTTPProvider(baseURL, accountSID string, authToken *secrets.Value) *HTTPProvider {
+	return &HTTPProvider{
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		AccountSID:  accountSID,
+		AuthToken:   authToken,
+		MaxSegments: 10,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Reconfigure changes the API URL and pricing of a provider in use.
+func (p *HTTPProvider) Reconfigure(baseURL string, pricePerSegment float64, maxSegments int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.BaseURL = strings.TrimRight(baseURL, "/")
+	p.PricePerSegment = pricePerSegment
+	p.MaxSegments = maxSegments
+}
+
+type apiMessage struct {
+	SID         string `json:"sid"`
+	Status      string `json:"status"`
+	NumSegments string `json:"num_segments"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+func (p *HTTPProvider) Send(ctx context.Context, msg Message) (*Result, error) {
+	p.mu.RLock()
+	baseURL, price, maxSegments := p.BaseURL, p.PricePerSegment, p.MaxSegments
+	p.mu.RUnlock()
+
+	seg := Segment(msg.Body)
+	if maxSegments > 0 && seg.Segments > maxSegments {
+		return nil, &ProviderError{
+			Code:    0,
+			Message: fmt.Sprintf("%d segments, limit is %d", seg.Segments, maxSegments),
+			Err:     ErrTooLong,
+		}
+	}
+
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("From", msg.From)
+	form.Set("Body", msg.Body)
+	if msg.StatusCallback != "" {
+		form.Set("StatusCallback", msg.StatusCallback)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", baseURL, p.AccountSID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(p.AccountSID, p.AuthToken.Get().Reveal())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// Network failures are worth another attempt.
+		return nil, &ProviderError{Message: err.Error(), Retryable: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, mapError(resp)
+	}
+
+	var m apiMessage
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("sms provider: decoding response: %w", err)
+	}
+	return &Result{
+		ID:           m.SID,
+		Status:       m.Status,
+		Segmentation: seg,
+		Cost:         seg.Cost(price),
+	}, nil
+}
+
+func mapError(resp *http.Response) error {
+	var body apiError
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	e := &ProviderError{
+		StatusCode: resp.StatusCode,
+		Code:       body.Code,
+		Message:    body.Message,
+		Retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	switch body.Code {
+	case codeInvalidNumber:
+		e.Err = ErrInvalidNumber
+	case codeUnsubscribed:
+		e.Err = ErrUnsubscribed
+	case codeRateLimited:
+		e.Retryable = true
+	}
+	return e
+}
+
+// Signature computes the X-Twilio-Signature style signature of a request:
+// base64(HMAC-SHA1(authToken, url + sorted key/value pairs of params)).
+func Signature(authToken, fullURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(fullURL)
+	for _, k := range keys {
+		for _, v := range params[k] {
+			sb.WriteString(k)
+			sb.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(sb.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidSignature reports whether signature matches the request.
+func ValidSignature(authToken, fullURL string, params url.Values, signature string) bool {
+	expected := Signature(authToken, fullURL, params)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,177 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// States a notification moves through.
+const (
+	Queued      = "queued"
+	Scheduled   = "scheduled"
+	RateLimited = "rate_limited" // waiting in the user's overflow queue
+	Cancelled   = "cancelled"
+	Suppressed  = "suppressed"
+	Expired     = "expired"
+	Delivered   = "delivered"
+	Failed      = "failed"
+)
+
+// Records are kept this long after their last update.
+const retention = 7 * 24 * time.Hour
+
+// final states end a notification. A record in one of them is not moved
+// back to a pending state, which a late write such as a "queued" recorded
+// after the worker already finished would otherwise do.
+var final = map[string]bool{
+	Cancelled:  true,
+	Suppressed: true,
+	Expired:    true,
+	Delivered:  true,
+	Failed:     true,
+}
+
+// recordScript sets the fields in ARGV[4:] and publishes ARGV[2] unless
+// ARGV[3], the new state, is pending and the record's is final. It returns
+// whether the record changed.
+var recordScript = redis.NewScript(`
+if ARGV[3] == '0' and redis.call('HGET', KEYS[1], 'final') == '1' then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+redis.call('PUBLISH', KEYS[2], ARGV[2])
+return 1
+`)
+
+// Status is the latest known state of one notification.
+type Status struct {
+	NotificationID string    `json:"notification_id"`
+	UserID         string    `json:"user_id"`
+	State          string    `json:"state"`
+	Channel        string    `json:"channel"`
+	Reason         string    `json:"reason"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(addr string) *Store {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Store{rdb: rdb}
+}
+
+func statusKey(ctx context.Context, id string) string {
+	return tenant.Key(ctx, fmt.Sprintf("status:%s", id))
+}
+
+// eventsChannel is the pub/sub channel every recorded state change of the
+// tenant is published on.
+func eventsChannel(ctx context.Context) string {
+	return tenant.Key(ctx, "status_events")
+}
+
+// Record stores a new state for a notification. Empty fields keep their
+// previous value, and a final state is kept over a pending one. Every state
+// change is also counted in the tenant metrics and published to Watch
+// subscribers.
+func (s *Store) Record(ctx context.Context, st Status) error {
+	if st.NotificationID == "" {
+		return nil
+	}
+	if st.UpdatedAt.IsZero() {
+		st.UpdatedAt = time.Now()
+	}
+
+	event, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	isFinal := "0"
+	if final[st.State] {
+		isFinal = "1"
+	}
+
+	args := []any{int64(retention / time.Second), event, isFinal,
+		"state", st.State,
+		"updated_at", st.UpdatedAt.Unix(),
+		"reason", st.Reason,
+		"final", isFinal,
+	}
+	if st.UserID != "" {
+		args = append(args, "user_id", st.UserID)
+	}
+	if st.Channel != "" {
+		args = append(args, "channel", st.Channel)
+	}
+
+	changed, err := recordScript.Run(ctx, s.rdb, []string{statusKey(ctx, st.NotificationID), eventsChannel(ctx)}, args...).Int()
+	if err != nil {
+		return err
+	}
+	if changed == 1 {
+		tenant.Count(ctx, st.State)
+	}
+	return nil
+}
+
+// Watch calls fn with every state change recorded for the tenant of ctx
+// until ctx is done. Changes are delivered as they happen and are not
+// replayed; Get returns the state recorded before Watch was called. Events
+// carry only the fields set on that change.
+func (s *Store) Watch(ctx context.Context, fn func(Status)) error {
+	sub := s.rdb.Subscribe(ctx, eventsChannel(ctx))
+	defer sub.Close()
+
+	// Fail early if the subscription cannot be set up.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var st Status
+			if err := json.Unmarshal([]byte(msg.Payload), &st); err != nil {
+				continue
+			}
+			fn(st)
+		}
+	}
+}
+
+// Get returns the status of a notification, or nil if nothing is recorded.
+func (s *Store) Get(ctx context.Context, id string) (*Status, error) {
+	fields, err := s.rdb.HGetAll(ctx, statusKey(ctx, id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	updated, _ := strconv.ParseInt(fields["updated_at"], 10, 64)
+	return &Status{
+		NotificationID: id,
+		UserID:         fields["user_id"],
+		State:          fields["state"],
+		Channel:        fields["channel"],
+		Reason:         fields["reason"],
+		UpdatedAt:      time.Unix(updated, 0),
+	}, nil
+}
@@ -0,0 +1,39 @@
+package status
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRecordKeepsFinalStates(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		want   string
+	}{
+		{"pending to final", []string{Queued, Delivered}, Delivered},
+		{"final to pending", []string{Delivered, Queued}, Delivered},
+		{"final to final", []string{Delivered, Failed}, Failed},
+		{"pending to pending", []string{RateLimited, Queued}, Queued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewStore(miniredis.RunT(t).Addr())
+			for _, state := range tt.states {
+				if err := s.Record(ctx, Status{NotificationID: "n1", State: state}); err != nil {
+					t.Fatalf("Record(%s): %v", state, err)
+				}
+			}
+			st, err := s.Get(ctx, "n1")
+			if err != nil || st == nil {
+				t.Fatalf("Get = %v, %v", st, err)
+			}
+			if st.State != tt.want {
+				t.Errorf("State = %s, want %s", st.State, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	latestKey  = "templates:latest"  // hash: template id -> latest stored version, per tenant
+	counterKey = "templates:counter" // hash: template id -> last version handed out, per tenant
+)
+
+// nextVersionScript hands out the next version number of a template. It
+// starts after the latest version for templates created before the counter.
+var nextVersionScript = redis.NewScript(`
+local last = math.max(tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0'),
+	tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0'))
+redis.call('HSET', KEYS[1], ARGV[1], last + 1)
+return last + 1
+`)
+
+// repointScript points the latest version of a template at the highest one
+// stored, or removes the pointer when none is left.
+var repointScript = redis.NewScript(`
+local latest = 0
+for _, v in ipairs(redis.call('HKEYS', KEYS[1])) do
+	latest = math.max(latest, tonumber(v) or 0)
+end
+if latest == 0 then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+else
+	redis.call('HSET', KEYS[2], ARGV[1], latest)
+end
+return latest
+`)
+
+var (
+	ErrNotFound        = errors.New("template not found")
+	ErrMissingVariable = errors.New("missing template variable")
+)
+
+// Template holds the per-channel bodies of one template version. Bodies use
+// Go template syntax, e.g. "Hi {{.name}}".
+type Template struct {
+	ID           string `json:"id"`
+	Version      int    `json:"version"`
+	EmailSubject string `json:"email_subject"`
+	EmailHTML    string `json:"email_html"`
+	EmailText    string `json:"email_text"`
+	SMSText      string `json:"sms_text"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// Rendered is the output of a template for one channel. Text is the only
+// body for SMS and the plain-text alternative for email.
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type Store struct {
+	rdb *redis.Client
+}
+
+func NewStore(addr string) *Store {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Store{rdb: rdb}
+}
+
+func versionsKey(ctx context.Context, id string) string {
+	return tenant.Key(ctx, fmt.Sprintf("template:%s", id))
+}
+
+// Create stores t as the next version of t.ID and returns the version number.
+func (s *Store) Create(ctx context.Context, t *Template) (int, error) {
+	if t.ID == "" {
+		return 0, errors.New("template id is required")
+	}
+	if t.EmailHTML == "" && t.EmailText == "" && t.SMSText == "" {
+		return 0, errors.New("template has no bodies")
+	}
+	if err := t.parse(); err != nil {
+		return 0, err
+	}
+
+	version, err := nextVersionScript.Run(ctx, s.rdb,
+		[]string{tenant.Key(ctx, counterKey), tenant.Key(ctx, latestKey)}, t.ID).Int()
+	if err != nil {
+		return 0, err
+	}
+	t.Version = version
+	t.CreatedAt = time.Now().Unix()
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.rdb.HSet(ctx, versionsKey(ctx, t.ID), strconv.Itoa(t.Version), data).Err(); err != nil {
+		return 0, err
+	}
+	if err := s.repoint(ctx, t.ID); err != nil {
+		return 0, err
+	}
+	return t.Version, nil
+}
+
+// Get returns one version of a template; version 0 means the latest.
+func (s *Store) Get(ctx context.Context, id string, version int) (*Template, error) {
+	if version == 0 {
+		latest, err := s.rdb.HGet(ctx, tenant.Key(ctx, latestKey), id).Int()
+		if err == redis.Nil {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		version = latest
+	}
+
+	data, err := s.rdb.HGet(ctx, versionsKey(ctx, id), strconv.Itoa(version)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var t Template
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List returns the latest version of every template of the tenant of ctx.
+func (s *Store) List(ctx context.Context) ([]*Template, error) {
+	ids, err := s.rdb.HKeys(ctx, tenant.Key(ctx, latestKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+
+	var out []*Template
+	for _, id := range ids {
+		t, err := s.Get(ctx, id, 0)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Delete removes one version of a template, or all of them when version is 0.
+// Version numbers are never reused.
+func (s *Store) Delete(ctx context.Context, id string, version int) error {
+	if version == 0 {
+		_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, versionsKey(ctx, id))
+			pipe.HDel(ctx, tenant.Key(ctx, latestKey), id)
+			return nil
+		})
+		return err
+	}
+
+	removed, err := s.rdb.HDel(ctx, versionsKey(ctx, id), strconv.Itoa(version)).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return s.repoint(ctx, id)
+}
+
+// repoint makes the latest version of id the highest one still stored.
+func (s *Store) repoint(ctx context.Context, id string) error {
+	return repointScript.Run(ctx, s.rdb, []string{versionsKey(ctx, id), tenant.Key(ctx, latestKey)}, id).Err()
+}
+
+// Render looks up a template and renders it for channel with vars.
+func (s *Store) Render(ctx context.Context, id string, version int, channel string, vars map[string]string) (*Rendered, error) {
+	t, err := s.Get(ctx, id, version)
+	if err != nil {
+		return nil, fmt.Errorf("template %s v%d: %w", id, version, err)
+	}
+	return t.Render(channel, vars)
+}
+
+// Render fills the template bodies for channel. Any variable referenced by
+// the template but absent from vars fails with ErrMissingVariable.
+func (t *Template) Render(channel string, vars map[string]string) (*Rendered, error) {
+	var out Rendered
+	var err error
+
+	switch channel {
+	case "email":
+		if t.EmailHTML == "" && t.EmailText == "" {
+			return nil, fmt.Errorf("template %s v%d has no email body", t.ID, t.Version)
+		}
+		if out.Subject, err = t.renderText("email_subject", t.EmailSubject, vars); err != nil {
+			return nil, err
+		}
+		if out.HTML, err = t.renderHTML(t.EmailHTML, vars); err != nil {
+			return nil, err
+		}
+		if out.Text, err = t.renderText("email_text", t.EmailText, vars); err != nil {
+			return nil, err
+		}
+	case "sms":
+		if t.SMSText == "" {
+			return nil, fmt.Errorf("template %s v%d has no sms body", t.ID, t.Version)
+		}
+		if out.Text, err = t.renderText("sms_text", t.SMSText, vars); err != nil {
+			return nil, err
+		}
+	default:
+		// Other channels carry a single text body; prefer the SMS text.
+		body := t.SMSText
+		if body == "" {
+			body = t.EmailText
+		}
+		if out.Text, err = t.renderText("text", body, vars); err != nil {
+			return nil, err
+		}
+	}
+	return &out, nil
+}
+
+func (t *Template) parse() error {
+	if _, err := texttemplate.New("email_subject").Parse(t.EmailSubject); err != nil {
+		return err
+	}
+	if _, err := htmltemplate.New("email_html").Parse(t.EmailHTML); err != nil {
+		return err
+	}
+	if _, err := texttemplate.New("email_text").Parse(t.EmailText); err != nil {
+		return err
+	}
+	if _, err := texttemplate.New("sms_text").Parse(t.SMSText); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *Template) renderHTML(body string, vars map[string]string) (string, error) {
+	if body == "" {
+		return "", nil
+	}
+	tmpl, err := htmltemplate.New("email_html").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, vars); err != nil {
+		return "", t.wrapExecError(err)
+	}
+	return sb.String(), nil
+}
+
+func (t *Template) renderText(name, body string, vars map[string]string) (string, error) {
+	if body == "" {
+		return "", nil
+	}
+	tmpl, err := texttemplate.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, vars); err != nil {
+		return "", t.wrapExecError(err)
+	}
+	return sb.String(), nil
+}
+
+func (t *Template) wrapExecError(err error) error {
+	if strings.Contains(err.Error(), "map has no entry for key") {
+		return fmt.Errorf("template %s v%d: %w: %v", t.ID, t.Version, ErrMissingVariable, err)
+	}
+	return fmt.Errorf("template %s v%d: %w", t.ID, t.Version, err)
+}
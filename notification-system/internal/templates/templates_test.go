@@ -0,0 +1,228 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := &Template{
+		ID:           "welcome",
+		Version:      1,
+		EmailSubject: "Welcome {{.name}}",
+		EmailHTML:    "<p>Hi {{.name}}</p>",
+		EmailText:    "Hi {{.name}}",
+		SMSText:      "Hi {{.name}}, code {{.code}}",
+	}
+	tests := []struct {
+		name    string
+		tmpl    *Template
+		channel string
+		vars    map[string]string
+		want    Rendered
+		wantErr error
+	}{
+		{
+			name:    "email",
+			tmpl:    tmpl,
+			channel: "email",
+			vars:    map[string]string{"name": "Ann"},
+			want:    Rendered{Subject: "Welcome Ann", HTML: "<p>Hi Ann</p>", Text: "Hi Ann"},
+		},
+		{
+			name:    "html is escaped",
+			tmpl:    tmpl,
+			channel: "email",
+			vars:    map[string]string{"name": "<b>Ann</b>"},
+			want:    Rendered{Subject: "Welcome <b>Ann</b>", HTML: "<p>Hi &lt;b&gt;Ann&lt;/b&gt;</p>", Text: "Hi <b>Ann</b>"},
+		},
+		{
+			name:    "sms",
+			tmpl:    tmpl,
+			channel: "sms",
+			vars:    map[string]string{"name": "Ann", "code": "1234"},
+			want:    Rendered{Text: "Hi Ann, code 1234"},
+		},
+		{
+			name:    "other channels use the sms text",
+			tmpl:    tmpl,
+			channel: "slack",
+			vars:    map[string]string{"name": "Ann", "code": "1234"},
+			want:    Rendered{Text: "Hi Ann, code 1234"},
+		},
+		{
+			name:    "other channels fall back to the email text",
+			tmpl:    &Template{ID: "t", EmailText: "Hi {{.name}}"},
+			channel: "push",
+			vars:    map[string]string{"name": "Ann"},
+			want:    Rendered{Text: "Hi Ann"},
+		},
+		{
+			name:    "missing variable",
+			tmpl:    tmpl,
+			channel: "sms",
+			vars:    map[string]string{"name": "Ann"},
+			wantErr: ErrMissingVariable,
+		},
+		{
+			name:    "missing html variable",
+			tmpl:    tmpl,
+			channel: "email",
+			vars:    nil,
+			wantErr: ErrMissingVariable,
+		},
+		{
+			name:    "no sms body",
+			tmpl:    &Template{ID: "t", EmailText: "Hi"},
+			channel: "sms",
+			wantErr: errAny,
+		},
+		{
+			name:    "no email body",
+			tmpl:    &Template{ID: "t", SMSText: "Hi"},
+			channel: "email",
+			wantErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tmpl.Render(tt.channel, tt.vars)
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("Render error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Render = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in the tables.
+var errAny = errors.New("any error")
+
+func TestVersions(t *testing.T) {
+	type step struct {
+		create  bool // create a version, else delete version
+		version int  // version to delete, 0 for all
+		want    int  // version created, or latest version after a delete, 0 for none
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "versions count up",
+			steps: []step{{create: true, want: 1}, {create: true, want: 2}, {create: true, want: 3}},
+		},
+		{
+			name: "deleting the latest repoints to the highest left",
+			steps: []step{
+				{create: true, want: 1}, {create: true, want: 2}, {create: true, want: 3},
+				{version: 3, want: 2},
+				{version: 1, want: 2},
+			},
+		},
+		{
+			name: "deleting the last version removes the template",
+			steps: []step{
+				{create: true, want: 1},
+				{version: 1, want: 0},
+			},
+		},
+		{
+			name: "deleted versions are not reused",
+			steps: []step{
+				{create: true, want: 1}, {create: true, want: 2},
+				{version: 2, want: 1},
+				{create: true, want: 3},
+				{version: 0, want: 0},
+				{create: true, want: 4},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(miniredis.RunT(t).Addr())
+			ctx := context.Background()
+			for i, st := range tt.steps {
+				if st.create {
+					v, err := s.Create(ctx, &Template{ID: "welcome", SMSText: "Hi"})
+					if err != nil {
+						t.Fatalf("step %d: Create: %v", i, err)
+					}
+					if v != st.want {
+						t.Fatalf("step %d: Create = v%d, want v%d", i, v, st.want)
+					}
+					continue
+				}
+				if err := s.Delete(ctx, "welcome", st.version); err != nil {
+					t.Fatalf("step %d: Delete v%d: %v", i, st.version, err)
+				}
+				got, err := s.Get(ctx, "welcome", 0)
+				switch {
+				case st.want == 0 && !errors.Is(err, ErrNotFound):
+					t.Fatalf("step %d: Get latest = %v, %v, want not found", i, got, err)
+				case st.want != 0 && err != nil:
+					t.Fatalf("step %d: Get latest: %v", i, err)
+				case st.want != 0 && got.Version != st.want:
+					t.Fatalf("step %d: latest = v%d, want v%d", i, got.Version, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestListIsPerTenant(t *testing.T) {
+	s := NewStore(miniredis.RunT(t).Addr())
+	acme := tenant.WithTenant(context.Background(), "acme")
+	globex := tenant.WithTenant(context.Background(), "globex")
+
+	for _, c := range []struct {
+		ctx context.Context
+		id  string
+	}{{acme, "a1"}, {acme, "a2"}, {globex, "g1"}, {context.Background(), "d1"}} {
+		if _, err := s.Create(c.ctx, &Template{ID: c.id, SMSText: "Hi"}); err != nil {
+			t.Fatalf("Create %s: %v", c.id, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{"acme", acme, []string{"a1", "a2"}},
+		{"globex", globex, []string{"g1"}},
+		{"default", context.Background(), []string{"d1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := s.List(tt.ctx)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got []string
+			for _, tmpl := range list {
+				got = append(got, tmpl.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("List = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Per-tenant counters, served by MetricsHandler as
+// {"acme": {"received": 10, "delivered": 9, ...}}.
+var (
+	metricsMu sync.Mutex
+	metrics   = make(map[string]map[string]int64)
+)
+
+// Count increments the named counter of the tenant of ctx.
+func Count(ctx context.Context, name string) {
+	id := FromContext(ctx)
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	m, ok := metrics[id]
+	if !ok {
+		m = make(map[string]int64)
+		metrics[id] = m
+	}
+	m[name]++
+}
+
+// Metrics returns a copy of the counters of every tenant.
+func Metrics() map[string]map[string]int64 {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	out := make(map[string]map[string]int64, len(metrics))
+	for id, m := range metrics {
+		c := make(map[string]int64, len(m))
+		for name, n := range m {
+			c[name] = n
+		}
+		out[id] = c
+	}
+	return out
+}
+
+// MetricsHandler serves Metrics as JSON. It shows every tenant's numbers,
+// so it belongs on an internal listener.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Metrics())
+	})
+}
@@ -0,0 +1,103 @@
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Config is what a tenant may override. Zero values fall back to the
+// server-wide defaults.
+type Config struct {
+	ID string `json:"id"`
+
+	// Per-user limit within the rate limit window.
+	RateLimit int `json:"rate_limit"`
+	// Limit for all users of the tenant together within the window.
+	Quota int `json:"quota"`
+
+	SMS  *SMSAccount  `json:"sms,omitempty"`
+	SMTP *SMTPAccount `json:"smtp,omitempty"`
+
+	// Days the notification history is kept, 0 for the server default.
+	HistoryRetentionDays int `json:"history_retention_days,omitempty"`
+}
+
+// SMSAccount is a tenant's own account at the SMS provider. AuthToken is a
+// secret reference such as "env:ACME_SMS_TOKEN", see package secrets.
+type SMSAccount struct {
+	AccountSID string `json:"account_sid"`
+	AuthToken  string `json:"auth_token"`
+	From       string `json:"from"`
+}
+
+// SMTPAccount is a mail relay. Password is a secret reference such as
+// "keystore:acme-smtp", see package secrets.
+type SMTPAccount struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// Registry holds the configured tenants. Only configured tenants and Default
+// are accepted.
+type Registry struct {
+	tenants map[string]*Config
+}
+
+// LoadRegistry reads a JSON array of Config from path. A missing file gives
+// a registry with only the Default tenant.
+func LoadRegistry(path string) (*Registry, error) {
+	r := &Registry{tenants: make(map[string]*Config)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var configs []*Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, c := range configs {
+		if err := Validate(c.ID); err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", c.ID, err)
+		}
+		if _, dup := r.tenants[c.ID]; dup {
+			return nil, fmt.Errorf("tenant %q configured twice", c.ID)
+		}
+		r.tenants[c.ID] = c
+	}
+	return r, nil
+}
+
+// Known reports whether requests for the tenant are accepted.
+func (r *Registry) Known(id string) bool {
+	if id == Default {
+		return true
+	}
+	_, ok := r.tenants[id]
+	return ok
+}
+
+// Get returns the tenant's config, or nil if it has none.
+func (r *Registry) Get(id string) *Config {
+	if r == nil {
+		return nil
+	}
+	return r.tenants[id]
+}
+
+// All returns every configured tenant.
+func (r *Registry) All() []*Config {
+	var out []*Config
+	for _, c := range r.tenants {
+		out = append(out, c)
+	}
+	return out
+}
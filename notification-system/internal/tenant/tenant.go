@@ -0,0 +1,65 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Default is the tenant of callers that do not name one. Its Redis keys are
+// not prefixed, so a single-tenant deployment keeps its existing data.
+const Default = "default"
+
+var (
+	ErrInvalidID = errors.New("tenant id must be 1-64 letters, digits, '-' or '_'")
+
+	validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+type contextKey struct{}
+
+// WithTenant returns a context that carries the tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = Default
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant of ctx, or Default if there is none.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Key namespaces a Redis key by the tenant of ctx, e.g. "prefs:42" becomes
+// "tenant:acme:prefs:42".
+func Key(ctx context.Context, key string) string {
+	return KeyFor(FromContext(ctx), key)
+}
+
+// Prefix of the keys of every tenant but Default.
+const keyPrefix = "tenant:"
+
+// KeyFor is Key for an explicit tenant id. A key of the default tenant that
+// would start with "tenant:" is moved under "default:", so no key of the
+// default tenant can name one of another tenant.
+func KeyFor(id, key string) string {
+	if id == "" || id == Default {
+		if strings.HasPrefix(key, keyPrefix) {
+			return Default + ":" + key
+		}
+		return key
+	}
+	return keyPrefix + id + ":" + key
+}
+
+func Validate(id string) error {
+	if !validID.MatchString(id) {
+		return ErrInvalidID
+	}
+	return nil
+}
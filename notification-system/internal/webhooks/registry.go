@@ -0,0 +1,171 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// After a rotation the previous secret keeps signing requests for this long
+// so receivers can roll over without dropping deliveries.
+const rotationGrace = 24 * time.Hour
+
+var ErrNotFound = errors.New("webhook endpoint not found")
+
+// Endpoint is a registered HTTP callback target.
+type Endpoint struct {
+	ID             string `json:"id"`
+	UserID         string `json:"user_id"`
+	URL            string `json:"url"`
+	Secret         string `json:"secret"`
+	PreviousSecret string `json:"previous_secret,omitempty"`
+	PreviousUntil  int64  `json:"previous_until,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	RotatedAt      int64  `json:"rotated_at,omitempty"`
+}
+
+// Secrets returns every secret the endpoint should currently be signed with.
+func (e *Endpoint) Secrets(now time.Time) []string {
+	secrets := []string{e.Secret}
+	if e.PreviousSecret != "" && now.Unix() < e.PreviousUntil {
+		secrets = append(secrets, e.PreviousSecret)
+	}
+	return secrets
+}
+
+type Registry struct {
+	rdb *redis.Client
+}
+
+func NewRegistry(addr string) *Registry {
+	rdb := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	return &Registry{rdb: rdb}
+}
+
+func endpointKey(ctx context.Context, id string) string {
+	return tenant.Key(ctx, fmt.Sprintf("webhook:%s", id))
+}
+
+func userKey(ctx context.Context, userID string) string {
+	return tenant.Key(ctx, fmt.Sprintf("webhooks:%s", userID))
+}
+
+// Register stores a new endpoint for userID with a freshly generated secret.
+func (r *Registry) Register(ctx context.Context, userID, rawURL string) (*Endpoint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q", rawURL)
+	}
+
+	e := &Endpoint{
+		ID:        "wh_" + randomHex(12),
+		UserID:    userID,
+		URL:       u.String(),
+		Secret:    newSecret(),
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := r.save(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *Registry) Get(ctx context.Context, id string) (*Endpoint, error) {
+	data, err := r.rdb.Get(ctx, endpointKey(ctx, id)).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var e Endpoint
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the endpoints registered by userID.
+func (r *Registry) List(ctx context.Context, userID string) ([]*Endpoint, error) {
+	ids, err := r.rdb.SMembers(ctx, userKey(ctx, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+
+	var out []*Endpoint
+	for _, id := range ids {
+		e, err := r.Get(ctx, id)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Rotate replaces the signing secret. The old one stays valid for
+// rotationGrace.
+func (r *Registry) Rotate(ctx context.Context, id string) (*Endpoint, error) {
+	e, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	e.PreviousSecret = e.Secret
+	e.PreviousUntil = now.Add(rotationGrace).Unix()
+	e.Secret = newSecret()
+	e.RotatedAt = now.Unix()
+	if err := r.save(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *Registry) Delete(ctx context.Context, id string) error {
+	e, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, endpointKey(ctx, id))
+		pipe.SRem(ctx, userKey(ctx, e.UserID), id)
+		return nil
+	})
+	return err
+}
+
+func (r *Registry) save(ctx context.Context, e *Endpoint) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, endpointKey(ctx, e.ID), data, 0)
+		pipe.SAdd(ctx, userKey(ctx, e.UserID), e.ID)
+		return nil
+	})
+	return err
+}
+
+func newSecret() string {
+	return "whsec_" + randomHex(24)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	IDHeader        = "X-Webhook-Id"
+)
+
+// Sign builds the signature header value "t=<unix>,v1=<hex>[,v1=<hex>...]"
+// with one v1 entry per secret. Each entry is
+// HMAC-SHA256(secret, "<unix>.<body>").
+func Sign(secrets []string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	parts := []string{"t=" + ts}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+computeMAC(secret, ts, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verify checks a signature header against secret and rejects timestamps
+// older than tolerance, for use by receivers.
+func Verify(secret, header string, body []byte, tolerance time.Duration) bool {
+	var ts string
+	var macs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			macs = append(macs, v)
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return false
+	}
+
+	expected := computeMAC(secret, ts, body)
+	for _, mac := range macs {
+		if hmac.Equal([]byte(mac), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+func computeMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
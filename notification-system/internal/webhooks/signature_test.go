@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"n1","message":"hi"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		secrets   []string // signed with
+		secret    string   // verified with
+		signedAt  time.Time
+		body      []byte // verified body, the signed one if nil
+		tolerance time.Duration
+		tamper    func(header string) string
+		want      bool
+	}{
+		{name: "valid", secrets: []string{"s1"}, secret: "s1", signedAt: now, tolerance: time.Minute, want: true},
+		{name: "wrong secret", secrets: []string{"s1"}, secret: "s2", signedAt: now, tolerance: time.Minute},
+		{name: "new secret during rotation", secrets: []string{"new", "old"}, secret: "new", signedAt: now, tolerance: time.Minute, want: true},
+		{name: "old secret during rotation", secrets: []string{"new", "old"}, secret: "old", signedAt: now, tolerance: time.Minute, want: true},
+		{name: "changed body", secrets: []string{"s1"}, secret: "s1", signedAt: now, body: []byte(`{"id":"n2"}`), tolerance: time.Minute},
+		{name: "too old", secrets: []string{"s1"}, secret: "s1", signedAt: now.Add(-2 * time.Minute), tolerance: time.Minute},
+		{name: "no tolerance accepts any age", secrets: []string{"s1"}, secret: "s1", signedAt: now.Add(-48 * time.Hour), want: true},
+		{
+			name: "timestamp changed after signing", secrets: []string{"s1"}, secret: "s1", signedAt: now, tolerance: time.Minute,
+			tamper: func(h string) string {
+				return "t=" + strconv.FormatInt(now.Unix()+1, 10) + h[strings.Index(h, ","):]
+			},
+		},
+		{
+			name: "no timestamp", secrets: []string{"s1"}, secret: "s1", signedAt: now, tolerance: time.Minute,
+			tamper: func(h string) string { return h[strings.Index(h, ",")+1:] },
+		},
+		{
+			name: "spaces after commas", secrets: []string{"s1"}, secret: "s1", signedAt: now, tolerance: time.Minute, want: true,
+			tamper: func(h string) string { return strings.ReplaceAll(h, ",", ", ") },
+		},
+		{name: "empty header", secrets: nil, secret: "s1", signedAt: now, tolerance: time.Minute, tamper: func(string) string { return "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := Sign(tt.secrets, tt.signedAt, body)
+			if tt.tamper != nil {
+				header = tt.tamper(header)
+			}
+			verified := tt.body
+			if verified == nil {
+				verified = body
+			}
+			if got := Verify(tt.secret, header, verified, tt.tolerance); got != tt.want {
+				t.Errorf("Verify(%q) = %v, want %v", header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignFormat(t *testing.T) {
+	at := time.Unix(1772366400, 0)
+	tests := []struct {
+		name    string
+		secrets []string
+		wantMAC int
+	}{
+		{"one secret", []string{"s1"}, 1},
+		{"rotation", []string{"new", "old"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := strings.Split(Sign(tt.secrets, at, []byte("{}")), ",")
+			if parts[0] != "t=1772366400" {
+				t.Errorf("first part = %q, want t=1772366400", parts[0])
+			}
+			if len(parts)-1 != tt.wantMAC {
+				t.Fatalf("got %d signatures, want %d", len(parts)-1, tt.wantMAC)
+			}
+			for i, p := range parts[1:] {
+				if want := "v1=" + computeMAC(tt.secrets[i], "1772366400", []byte("{}")); p != want {
+					t.Errorf("signature %d = %q, want %q", i, p, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package workerpool
+
+import (
+	"sync"
+
+	"github.com/lazypanda2004/notification-system/internal/priority"
+)
+
+// Share of dispatches each priority below critical gets while they are all
+// backlogged. Critical tasks are always dispatched first.
+var weights = map[string]int{
+	priority.High:   4,
+	priority.Normal: 2,
+	priority.Low:    1,
+}
+
+// level holds the tasks of one priority, a FIFO per tenant. Tenants are
+// served round robin so one tenant's backlog cannot starve the others.
+type level struct {
+	order []string // tenants with queued tasks, next to be served first
+	tasks map[string][]Task
+}
+
+// fairQueue orders tasks by priority and, within a priority, by tenant.
+type fairQueue struct {
+	mu       sync.Mutex
+	nonEmpty *sync.Cond
+	notFull  *sync.Cond
+	levels   []*level // one per priority.Levels entry
+	credit   []int
+	capacity int // per tenant and priority
+	closed   bool
+}
+
+func newFairQueue(capacity int) *fairQueue {
+	q := &fairQueue{
+		levels:   make([]*level, len(priority.Levels)),
+		credit:   make([]int, len(priority.Levels)),
+		capacity: capacity,
+	}
+	for i := range q.levels {
+		q.levels[i] = &level{tasks: make(map[string][]Task)}
+	}
+	q.nonEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues task. When the tenant's queue for the task's priority is full
+// it waits for room if wait is set, and otherwise reports false.
+func (q *fairQueue) push(task Task, wait bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l := q.levels[priority.Index(task.Priority)]
+	for len(l.tasks[task.TenantID]) >= q.capacity {
+		if !wait || q.closed {
+			return false
+		}
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+
+	if len(l.tasks[task.TenantID]) == 0 {
+		l.order = append(l.order, task.TenantID)
+	}
+	l.tasks[task.TenantID] = append(l.tasks[task.TenantID], task)
+	q.nonEmpty.Signal()
+	return true
+}
+
+// pop waits for the next task. Critical tasks preempt everything else; the
+// other priorities are served by smooth weighted round robin so low priority
+// work keeps moving under a high priority flood. It reports false once the
+// queue is closed.
+func (q *fairQueue) pop() (Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return Task{}, false
+		}
+		if i := q.nextLevel(); i >= 0 {
+			task := q.levels[i].take()
+			q.notFull.Broadcast()
+			return task, true
+		}
+		q.nonEmpty.Wait()
+	}
+}
+
+func (q *fairQueue) nextLevel() int {
+	if len(q.levels[0].order) > 0 {
+		return 0
+	}
+
+	best, total := -1, 0
+	for i := 1; i < len(q.levels); i++ {
+		if len(q.levels[i].order) == 0 {
+			continue
+		}
+		w := weights[priority.Levels[i]]
+		q.credit[i] += w
+		total += w
+		if best < 0 || q.credit[i] > q.credit[best] {
+			best = i
+		}
+	}
+	if best >= 0 {
+		q.credit[best] -= total
+	}
+	return best
+}
+
+// take removes the oldest task of the next tenant in turn.
+func (l *level) take() Task {
+	tenantID := l.order[0]
+	l.order = l.order[1:]
+
+	tasks := l.tasks[tenantID]
+	task := tasks[0]
+	if len(tasks) == 1 {
+		delete(l.tasks, tenantID)
+	} else {
+		l.tasks[tenantID] = tasks[1:]
+		l.order = append(l.order, tenantID)
+	}
+	return task
+}
+
+// len is the number of queued tasks.
+func (q *fairQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, l := range q.levels {
+		for _, tasks := range l.tasks {
+			n += len(tasks)
+		}
+	}
+	return n
+}
+
+func (q *fairQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.nonEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
@@ -0,0 +1,109 @@
+package workerpool
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lazypanda2004/notification-system/internal/priority"
+)
+
+func TestFairQueueOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// push are "<id>@<tenant>" with the priority named by the first
+		// letter of the id: c, h, n or l.
+		push []string
+		want []string // ids in pop order
+	}{
+		{
+			name: "critical preempts",
+			push: []string{"l1@a", "n1@a", "h1@a", "c1@a"},
+			want: []string{"c1", "h1", "n1", "l1"},
+		},
+		{
+			name: "priorities share by weight",
+			push: []string{"h1@a", "h2@a", "h3@a", "h4@a", "h5@a", "n1@a", "n2@a", "n3@a", "l1@a", "l2@a"},
+			want: []string{"h1", "n1", "h2", "l1", "h3", "n2", "h4", "h5", "n3", "l2"},
+		},
+		{
+			name: "low priority moves under a flood",
+			push: []string{"h1@a", "h2@a", "h3@a", "h4@a", "h5@a", "h6@a", "h7@a", "h8@a", "l1@a"},
+			want: []string{"h1", "h2", "l1", "h3", "h4", "h5", "h6", "h7", "h8"},
+		},
+		{
+			name: "tenants take turns",
+			push: []string{"n1@a", "n2@a", "n3@a", "n4@b", "n5@c", "n6@b"},
+			want: []string{"n1", "n4", "n5", "n2", "n6", "n3"},
+		},
+		{
+			name: "tenants take turns within each priority",
+			push: []string{"h1@a", "h2@a", "c1@b", "h3@b", "c2@a"},
+			want: []string{"c1", "c2", "h1", "h3", "h2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newFairQueue(100)
+			for _, spec := range tt.push {
+				if !q.push(task(spec), false) {
+					t.Fatalf("push %s: queue full", spec)
+				}
+			}
+			var got []string
+			for q.len() > 0 {
+				task, ok := q.pop()
+				if !ok {
+					t.Fatal("pop: queue closed")
+				}
+				got = append(got, task.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pop order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairQueueCapacity(t *testing.T) {
+	tests := []struct {
+		name string
+		push []string
+		want []bool // accepted
+	}{
+		{"per tenant", []string{"n1@a", "n2@a", "n3@a", "n4@b"}, []bool{true, true, false, true}},
+		{"per priority", []string{"n1@a", "n2@a", "h1@a", "c1@a", "n3@a"}, []bool{true, true, true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newFairQueue(2)
+			for i, spec := range tt.push {
+				if got := q.push(task(spec), false); got != tt.want[i] {
+					t.Errorf("push %s = %v, want %v", spec, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFairQueueClose(t *testing.T) {
+	q := newFairQueue(1)
+	q.push(task("n1@a"), false)
+
+	done := make(chan bool)
+	go func() { done <- q.push(task("n2@a"), true) }()
+	q.close()
+	if <-done {
+		t.Error("waiting push after close = true, want false")
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("pop after close = true, want false")
+	}
+}
+
+// task builds a task from "<id>@<tenant>", see TestFairQueueOrder.
+func task(spec string) Task {
+	id, tenantID, _ := strings.Cut(spec, "@")
+	p := map[byte]string{'c': priority.Critical, 'h': priority.High, 'n': priority.Normal, 'l': priority.Low}[id[0]]
+	return Task{ID: id, TenantID: tenantID, Priority: p}
+}
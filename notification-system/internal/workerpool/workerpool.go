@@ -2,112 +2,490 @@ package workerpool
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/deadletter"
+	"github.com/lazypanda2004/notification-system/internal/history"
+	"github.com/lazypanda2004/notification-system/internal/mail"
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+	"github.com/lazypanda2004/notification-system/internal/status"
+	"github.com/lazypanda2004/notification-system/internal/templates"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/lazypanda2004/notification-system/notifier"
+)
+
+const (
+	maxAttempts  = 3
+	retryBackoff = time.Second
+	// A remote side that asks for a longer wait fails the attempt instead,
+	// so the worker moves on to the fallback step.
+	maxRetryWait = 30 * time.Second
 )
 
 type Task struct {
-	UserID    string
-	Type      string 
-	Recipient string 
-	Message   string 
+	ID              string                  `json:"notification_id"`
+	TenantID        string                  `json:"tenant_id"`
+	UserID          string                  `json:"user_id"`
+	Type            string                  `json:"type"`
+	Recipient       string                  `json:"recipient"`
+	Message         string                  `json:"message"`
+	TemplateID      string                  `json:"template_id"`
+	TemplateVersion int32                   `json:"template_version"`
+	Variables       map[string]string       `json:"variables"`
+	Subject         string                  `json:"subject"`
+	From            string                  `json:"from"`
+	ReplyTo         string                  `json:"reply_to"`
+	Cc              []string                `json:"cc"`
+	Bcc             []string                `json:"bcc"`
+	Attachments     []mail.Attachment       `json:"attachments"`
+	TextMessage     string                  `json:"text_message"`
+	Title           string                  `json:"title"`
+	Badge           int32                   `json:"badge"`
+	Data            map[string]string       `json:"data"`
+	CollapseKey     string                  `json:"collapse_key"`
+	PushTTLSeconds  int64                   `json:"push_ttl_seconds"`
+	Category        string                  `json:"category"`
+	Fallback        []notifier.FallbackStep `json:"fallback"`
+	TimeoutSeconds  int64                   `json:"timeout_seconds"`
+	Priority        string                  `json:"priority"`
+	ExpiresAt       int64                   `json:"expires_at"`
 }
 
+// String identifies the task for logs. The message, variables and data are
+// left out since they may carry one-time codes or personal data.
+func (t Task) String() string {
+	return fmt.Sprintf("{ID:%s TenantID:%s UserID:%s Type:%s Recipient:%s TemplateID:%s Priority:%s Fallback:%d}",
+		t.ID, t.TenantID, t.UserID, t.Type, t.Recipient, t.TemplateID, t.Priority, len(t.Fallback))
+}
 
 type WorkerPool struct {
-	taskChan chan Task
+	queue    *fairQueue
+	taskChan chan Task // hands the dispatched task to a free worker
 	workers  int
 	ctx      context.Context
 	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	stops  []chan struct{} // one per running worker
+	nextID int
+
+	templates *templates.Store
+	notifiers map[string]notifier.Notifier
+	status    *status.Store
+	tenants   *tenant.Registry
+	smtp      *tenant.SMTPAccount
+	secrets   *secrets.Store
+	dead      *deadletter.Writer
+	history   *history.Store
 }
 
 func NewWorkerPool(workerCount int) *WorkerPool {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &WorkerPool{
-		taskChan: make(chan Task, 100), // buffered channel
+		queue:    newFairQueue(100),
+		taskChan: make(chan Task),
 		workers:  workerCount,
 		ctx:      ctx,
 		cancel:   cancel,
+
+		notifiers: make(map[string]notifier.Notifier),
 	}
 }
 
+// UseTemplates lets the pool render tasks that reference a template.
+func (wp *WorkerPool) UseTemplates(store *templates.Store) {
+	wp.templates = store
+}
+
+// UseStatus makes the pool record the outcome of every task.
+func (wp *WorkerPool) UseStatus(store *status.Store) {
+	wp.status = store
+}
+
+// UseTenants lets tenants send email through their own SMTP account.
+func (wp *WorkerPool) UseTenants(reg *tenant.Registry) {
+	wp.tenants = reg
+}
+
+// UseSMTP sets the mail relay for tenants without their own, nil for none.
+// Passwords are secret references resolved through store on every send, so
+// a rotated password applies to the next email without restarting the pool.
+func (wp *WorkerPool) UseSMTP(account *tenant.SMTPAccount, store *secrets.Store) {
+	wp.smtp = account
+	wp.secrets = store
+}
+
+// UseDeadLetters keeps tasks that failed on every channel in the
+// dead-letter topic for a later replay.
+func (wp *WorkerPool) UseDeadLetters(w *deadletter.Writer) {
+	wp.dead = w
+}
+
+// UseHistory keeps the outcome of every task in the notification history.
+func (wp *WorkerPool) UseHistory(store *history.Store) {
+	wp.history = store
+}
+
+// Register routes tasks of the given type to n. Call before Start.
+func (wp *WorkerPool) Register(taskType string, n notifier.Notifier) {
+	wp.notifiers[taskType] = n
+}
+
+// Handles reports whether the pool can deliver on channel.
+func (wp *WorkerPool) Handles(channel string) bool {
+	_, ok := wp.notifiers[channel]
+	return ok || channel == "email"
+}
+
 // Start launches the workers
 func (wp *WorkerPool) Start() {
-	for i := range wp.workers {
-		go wp.worker(i)
+	go wp.dispatch()
+	wp.Resize(wp.workers)
+}
+
+// Resize grows or shrinks the running pool to n workers. Stopped workers
+// finish their current task first and queued tasks stay queued, so nothing
+// is dropped.
+func (wp *WorkerPool) Resize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("a pool needs at least one worker, got %d", n)
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	for len(wp.stops) < n {
+		stop := make(chan struct{})
+		wp.stops = append(wp.stops, stop)
+		go wp.worker(wp.nextID, stop)
+		wp.nextID++
+	}
+	for len(wp.stops) > n {
+		last := len(wp.stops) - 1
+		close(wp.stops[last])
+		wp.stops = wp.stops[:last]
 	}
+	wp.workers = n
+	return nil
+}
+
+// Size is the number of running workers.
+func (wp *WorkerPool) Size() int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return len(wp.stops)
+}
+
+// Queued is the number of tasks waiting for a worker.
+func (wp *WorkerPool) Queued() int {
+	return wp.queue.len()
 }
 
 // Stop gracefully shuts down the workers
 func (wp *WorkerPool) Stop() {
 	wp.cancel()
-	close(wp.taskChan)
+	wp.queue.close()
 }
 
+// Submit queues task by its priority and tenant. It blocks while the
+// tenant's queue for that priority is full.
 func (wp *WorkerPool) Submit(task Task) {
-	wp.taskChan <- task
+	wp.queue.push(task, true)
+}
+
+// TrySubmit is Submit without blocking. It reports false if the task was not
+// queued because the tenant's queue is full.
+func (wp *WorkerPool) TrySubmit(task Task) bool {
+	return wp.queue.push(task, false)
+}
+
+// dispatch feeds the workers in the order of the fair queue.
+func (wp *WorkerPool) dispatch() {
+	for {
+		task, ok := wp.queue.pop()
+		if !ok {
+			return
+		}
+
+		select {
+		case <-wp.ctx.Done():
+			return
+		case wp.taskChan <- task:
+		}
+	}
 }
 
-func (wp *WorkerPool) worker(id int) {
+func (wp *WorkerPool) worker(id int, stop <-chan struct{}) {
 	log.Printf("Worker %d started", id)
 	for {
 		select {
 		case <-wp.ctx.Done():
 			log.Printf("Worker %d shutting down", id)
 			return
+		case <-stop:
+			log.Printf("Worker %d stopped, pool shrunk", id)
+			return
 		case task := <-wp.taskChan:
 			wp.process(task, id)
 		}
 	}
 }
 
-
 func (wp *WorkerPool) process(task Task, workerID int) {
 	log.Printf("Worker %d processing task: %+v", workerID, task)
+	started := time.Now()
+
+	// The requested channel is the first step of the fallback chain.
+	first := notifier.FallbackStep{Channel: task.Type, Recipient: task.Recipient, TimeoutSeconds: task.TimeoutSeconds}
+	steps := append([]notifier.FallbackStep{first}, task.Fallback...)
+
+	var failures []string
+	attempt := task
+	for i, step := range steps {
+		attempt = task
+		attempt.Type, attempt.Recipient = step.Channel, step.Recipient
+
+		if task.ExpiresAt > 0 && time.Now().Unix() >= task.ExpiresAt {
+			log.Printf("Worker %d: Notification %s expired before delivery", workerID, task.ID)
+			wp.record(attempt, status.Expired, "expired before delivery", "", started)
+			return
+		}
+
+		response, err := wp.send(&attempt, time.Duration(step.TimeoutSeconds)*time.Second, workerID)
+		if err == nil {
+			reason := ""
+			if i > 0 {
+				reason = "fallback after " + strings.Join(failures, "; ")
+			}
+			wp.record(attempt, status.Delivered, reason, response, started)
+			return
+		}
+
+		log.Printf("Worker %d: Failed to send %s to %s: %v", workerID, step.Channel, step.Recipient, err)
+		failures = append(failures, step.Channel+": "+err.Error())
+		if i+1 < len(steps) {
+			log.Printf("Worker %d: Notification %s falling back to %s", workerID, task.ID, steps[i+1].Channel)
+		}
+	}
+	reason := strings.Join(failures, "; ")
+	wp.record(attempt, status.Failed, reason, "", started)
+	if wp.dead != nil {
+		if err := wp.dead.Publish(wp.ctx, task.UserID, task, reason); err != nil {
+			log.Printf("Worker %d: Failed to dead-letter %s: %v", workerID, task.ID, err)
+		}
+	}
+}
+
+// send delivers task on its channel and returns the provider's response. A
+// positive timeout bounds the delivery including retries.
+func (wp *WorkerPool) send(task *Task, timeout time.Duration, workerID int) (string, error) {
+	if task.TemplateID != "" {
+		if err := wp.render(task); err != nil {
+			return "", fmt.Errorf("cannot render template: %w", err)
+		}
+	}
+
+	ctx, response := notifier.WithResponse(taskContext(wp.ctx, *task))
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	switch task.Type {
-	case "email":
-		wp.sendEmail(task.Recipient, task.Message, workerID)
+	if task.Type == "email" {
+		return wp.sendEmail(ctx, *task, workerID)
+	}
+	n, ok := wp.notifiers[task.Type]
+	if !ok {
+		return "", fmt.Errorf("unknown task type: %s", task.Type)
+	}
+	if err := wp.deliver(ctx, n, *task, workerID); err != nil {
+		return "", err
+	}
+	log.Printf("Worker %d: %s sent to %s", workerID, task.Type, task.Recipient)
+	return response.String(), nil
+}
 
-	case "sms":
-		wp.sendSMS(task.Recipient, task.Message, workerID)
+func (wp *WorkerPool) record(task Task, state, reason, response string, started time.Time) {
+	wp.recordHistory(task, state, reason, response, started)
+	if wp.status == nil {
+		tenant.Count(taskContext(wp.ctx, task), state) // Record counts it otherwise
+		return
+	}
+	err := wp.status.Record(taskContext(wp.ctx, task), status.Status{
+		NotificationID: task.ID,
+		UserID:         task.UserID,
+		State:          state,
+		Channel:        task.Type,
+		Reason:         reason,
+	})
+	if err != nil {
+		log.Printf("Failed to record status of %s: %v", task.ID, err)
+	}
+}
 
-	default:
-		log.Printf("Worker %d: Unknown task type: %s", workerID, task.Type)
+// recordHistory keeps the outcome with a hash of the rendered content.
+func (wp *WorkerPool) recordHistory(task Task, state, reason, response string, started time.Time) {
+	if wp.history == nil {
+		return
+	}
+	err := wp.history.Record(taskContext(wp.ctx, task), history.Entry{
+		NotificationID:   task.ID,
+		UserID:           task.UserID,
+		Channel:          task.Type,
+		Recipient:        task.Recipient,
+		Status:           state,
+		Reason:           reason,
+		TemplateID:       task.TemplateID,
+		ContentHash:      history.Hash(task.Subject, task.Title, task.Message, task.TextMessage),
+		ProviderResponse: response,
+		StartedAt:        started,
+	})
+	if err != nil {
+		log.Printf("Failed to record history of %s: %v", task.ID, err)
 	}
 }
 
+// deliver calls n, retrying with exponential backoff while the error is
+// retryable. A Retry-After from the remote side overrides the backoff, up to
+// maxRetryWait.
+func (wp *WorkerPool) deliver(ctx context.Context, n notifier.Notifier, task Task, workerID int) error {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := n.Notify(ctx, toNotification(task))
+		if err == nil {
+			return nil
+		}
+		retry, after := notifier.IsRetryable(err)
+		if !retry || attempt == maxAttempts {
+			return err
+		}
 
+		wait := backoff
+		if after > maxRetryWait {
+			return fmt.Errorf("retry asked for in %s: %w", after, err)
+		} else if after > 0 {
+			wait = after
+		}
+		log.Printf("Worker %d: Attempt %d for %s failed, retrying in %s: %v", workerID, attempt, task.ID, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
 
-func (wp *WorkerPool) sendSMS(to, message string, workerID int) {
-	// Replace with actual SMS API logic
-	log.Printf("Worker %d: SMS sent to %s - Message: %s", workerID, to, message)
+// taskContext scopes ctx to the tenant of task, for the tenant's templates,
+// endpoints, devices and status records.
+func taskContext(ctx context.Context, task Task) context.Context {
+	return tenant.WithTenant(ctx, task.TenantID)
 }
 
-func (wp *WorkerPool) sendEmail(to, body string, workerID int) {
-	Username := "hrushikeshkareddy2004@gmail.com"
-	password := "gigivczkykdbolms"
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-	subject := "Notification"
+func toNotification(task Task) notifier.Notification {
+	return notifier.Notification{
+		ID:        task.ID,
+		UserID:    task.UserID,
+		Type:      task.Type,
+		Recipient: task.Recipient,
+		Message:   task.Message,
 
-	auth := smtp.PlainAuth("", Username, password, smtpHost)
+		Title:       task.Title,
+		Badge:       task.Badge,
+		Data:        task.Data,
+		CollapseKey: task.CollapseKey,
+		PushTTL:     time.Duration(task.PushTTLSeconds) * time.Second,
+	}
+}
 
-	msg := []byte("To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
-		"\r\n" + body + "\r\n")
+// render replaces the task message with its rendered template. Email keeps
+// the HTML body when the template has one and falls back to the text body.
+func (wp *WorkerPool) render(task *Task) error {
+	if wp.templates == nil {
+		return errors.New("templates are not enabled")
+	}
 
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, Username, []string{to}, msg)
+	out, err := wp.templates.Render(taskContext(wp.ctx, *task), task.TemplateID, int(task.TemplateVersion), task.Type, task.Variables)
 	if err != nil {
-		log.Printf("Worker %d: Failed to send email to %s: %v", workerID, to, err)
-		return
+		return err
 	}
 
-	log.Printf("Worker %d: Email sent to %s", workerID, to)
+	task.Message = out.Text
+	if task.Type == "email" {
+		if out.HTML != "" {
+			task.Message = out.HTML
+			task.TextMessage = out.Text
+		}
+		if out.Subject != "" {
+			task.Subject = out.Subject
+		}
+	}
+	return nil
 }
 
+func (wp *WorkerPool) sendEmail(ctx context.Context, task Task, workerID int) (string, error) {
+	account := wp.smtp
+	if cfg := wp.tenants.Get(task.TenantID); cfg != nil && cfg.SMTP != nil {
+		account = cfg.SMTP
+	}
+	if account == nil || wp.secrets == nil {
+		return "", errors.New("no SMTP account configured")
+	}
+	password, err := wp.secrets.Get(account.Password)
+	if err != nil {
+		return "", fmt.Errorf("smtp password: %w", err)
+	}
+	from := account.From
+	if from == "" {
+		from = account.Username
+	}
+
+	auth := smtp.PlainAuth("", account.Username, password.Reveal(), account.Host)
+
+	msg := &mail.Message{
+		From:        task.From,
+		ReplyTo:     task.ReplyTo,
+		To:          []string{task.Recipient},
+		Cc:          task.Cc,
+		Bcc:         task.Bcc,
+		Subject:     task.Subject,
+		HTML:        task.Message,
+		Text:        task.TextMessage,
+		Attachments: task.Attachments,
+	}
+	if msg.From == "" {
+		msg.From = from
+	}
+	if msg.Subject == "" {
+		msg.Subject = "Notification"
+	}
+	if task.TextMessage == "" && !looksLikeHTML(task.Message) {
+		msg.HTML, msg.Text = "", task.Message
+	}
+
+	data, err := msg.Bytes()
+	if err != nil {
+		return "", err
+	}
 
+	err = mail.Send(ctx, net.JoinHostPort(account.Host, account.Port), auth, from, msg.Recipients(), data)
+	if err != nil {
+		return "", err
+	}
 
+	log.Printf("Worker %d: Email sent to %s", workerID, task.Recipient)
+	return "accepted by " + account.Host, nil
+}
+
+func looksLikeHTML(body string) bool {
+	return strings.Contains(body, "<") && strings.Contains(body, ">")
+}
@@ -0,0 +1,117 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/notifier"
+)
+
+// failing fails every call with err and counts them.
+type failing struct {
+	err   error
+	calls int
+}
+
+func (f *failing) Notify(ctx context.Context, n notifier.Notification) error {
+	f.calls++
+	return f.err
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"not retryable", errors.New("rejected"), 1},
+		{"short Retry-After is honoured", &notifier.RetryableError{Err: errors.New("busy"), RetryAfter: 10 * time.Millisecond}, maxAttempts},
+		{"long Retry-After fails at once", &notifier.RetryableError{Err: errors.New("busy"), RetryAfter: 24 * time.Hour}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &failing{err: tt.err}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := (&WorkerPool{}).deliver(ctx, n, Task{ID: "n1"}, 1)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("deliver = %v, want %v", err, tt.err)
+			}
+			if n.calls != tt.wantCalls {
+				t.Errorf("Notify called %d times, want %d", n.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// hanging blocks until the delivery is given up on.
+type hanging struct{}
+
+func (hanging) Notify(ctx context.Context, n notifier.Notification) error {
+	<-ctx.Done()
+	return &notifier.RetryableError{Err: ctx.Err()}
+}
+
+// counting accepts every call and counts them.
+type counting struct{ calls atomic.Int32 }
+
+func (c *counting) Notify(ctx context.Context, n notifier.Notification) error {
+	c.calls.Add(1)
+	return nil
+}
+
+func TestStepTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		task Task
+	}{
+		{
+			name: "first channel",
+			task: Task{Type: "slow", TimeoutSeconds: 1, Fallback: []notifier.FallbackStep{{Channel: "fast"}}},
+		},
+		{
+			name: "fallback step",
+			task: Task{Type: "fast", Recipient: "reject", Fallback: []notifier.FallbackStep{
+				{Channel: "slow", TimeoutSeconds: 1}, {Channel: "fast"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wp := NewWorkerPool(1)
+			defer wp.Stop()
+			fast := &counting{}
+			wp.Register("slow", hanging{})
+			wp.Register("fast", notifierFunc(func(ctx context.Context, n notifier.Notification) error {
+				if n.Recipient == "reject" {
+					return errors.New("rejected")
+				}
+				return fast.Notify(ctx, n)
+			}))
+
+			done := make(chan struct{})
+			go func() {
+				wp.process(tt.task, 1)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("process still running, want the slow step given up after its timeout")
+			}
+			if fast.calls.Load() != 1 {
+				t.Errorf("delivered %d times on the last step, want 1", fast.calls.Load())
+			}
+		})
+	}
+}
+
+type notifierFunc func(ctx context.Context, n notifier.Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, n notifier.Notification) error {
+	return f(ctx, n)
+}
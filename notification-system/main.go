@@ -1,52 +1,534 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/lazypanda2004/notification-system/cmd/loadbalancer"
-	"github.com/lazypanda2004/notification-system/internal/workerpool"
+	"github.com/lazypanda2004/notification-system/internal/auth"
+	"github.com/lazypanda2004/notification-system/internal/config"
+	"github.com/lazypanda2004/notification-system/internal/contacts"
+	"github.com/lazypanda2004/notification-system/internal/deadletter"
+	"github.com/lazypanda2004/notification-system/internal/history"
+	"github.com/lazypanda2004/notification-system/internal/outbox"
+	"github.com/lazypanda2004/notification-system/internal/preferences"
+	"github.com/lazypanda2004/notification-system/internal/push"
+	"github.com/lazypanda2004/notification-system/internal/queue"
 	"github.com/lazypanda2004/notification-system/internal/redis"
-	"github.com/lazypanda2004/notification-system/server"
+	"github.com/lazypanda2004/notification-system/internal/scheduler"
+	"github.com/lazypanda2004/notification-system/internal/secrets"
+	"github.com/lazypanda2004/notification-system/internal/sms"
+	"github.com/lazypanda2004/notification-system/internal/status"
+	"github.com/lazypanda2004/notification-system/internal/templates"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/lazypanda2004/notification-system/internal/webhooks"
+	"github.com/lazypanda2004/notification-system/internal/workerpool"
+	"github.com/lazypanda2004/notification-system/notifier"
 	pb "github.com/lazypanda2004/notification-system/proto"
+	"github.com/lazypanda2004/notification-system/server"
 	"google.golang.org/grpc"
+
+	// database/sql drivers for the notification history.
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 const (
-	grpcPort    = ":50051"
+	grpcPort  = ":50051"
+	redisAddr = "localhost:6379"
+
+	// Message broker carrying notifications to the load balancer:
+	// "kafka", "redis" (Redis Streams on redisAddr) or "nats" (JetStream).
+	// Overridden with -broker.
+	broker      = queue.BrokerKafka
 	kafkaBroker = "localhost:9092"
-	kafkaTopic  = "notifications"
-	redisAddr   = "localhost:6379"
-	rateLimit   = 100
-	timeWindow  = 1 * time.Minute
+	natsURL     = "nats://localhost:4222"
+	queueTopic  = "notifications"
+	// With an outbox file accepted notifications are committed to it and
+	// relayed to the broker in the background, so the API keeps accepting
+	// them while the broker is down. Empty publishes to the broker directly.
+	// Overridden with -outbox.
+	outboxFile = ""
+
+	// Notification history: "sqlite" with a file name, or "pgx" with a
+	// Postgres connection string. Empty driver turns it off. Tenants may set
+	// their own retention in tenantsFile.
+	historyDriver        = "sqlite"
+	historyDSN           = "history.db"
+	historyRetention     = 90 * 24 * time.Hour
+	historyPruneInterval = time.Hour
+
+	// Defaults of the settings in configFile, which is reloaded on SIGHUP
+	// and when it changes, see config.example.json. Rate limits, pool sizes
+	// and provider settings can be changed that way without a restart.
+	configFile         = "config.json"
+	configPollInterval = 5 * time.Second
+	rateLimit          = 100
+	timeWindow         = 1 * time.Minute
+	workersPerPool     = 8
+
+	// Tenants with their own limits and provider accounts, see
+	// tenants.example.json. Without the file only the default tenant exists.
+	tenantsFile = "tenants.json"
+
+	// Credentials are secret references: "env:NAME", "file:/path" or
+	// "keystore:name", see internal/secrets. With
+	// $NOTIFICATION_KEYSTORE_PASSPHRASE set, the keystore is opened on the
+	// first keystore: reference; edit it with cmd/keystore.
+	// Rotated secrets are picked up every secretsReloadInterval.
+	keystoreFile          = "keystore.json"
+	secretsReloadInterval = 30 * time.Second
+
+	// Default mail relay, tenants may configure their own.
+	smtpHost        = "smtp.gmail.com"
+	smtpPort        = "587"
+	smtpUsername    = "hrushikeshkareddy2004@gmail.com"
+	smtpPasswordRef = "env:SMTP_PASSWORD"
+
+	// gRPC API security. Without a certificate the API is served in
+	// plaintext; with a client CA every caller needs a certificate signed by
+	// it. Callers authenticate with an API key from apiKeysFile (generate one
+	// with cmd/apikey) or with a JWT signed with the jwtSecretRef secret.
+	tlsCertFile     = ""
+	tlsKeyFile      = ""
+	tlsClientCAFile = ""
+	apiKeysFile     = "api_keys.json"
+	jwtIssuer       = "notification-system"
+	jwtSecretRef    = "env:NOTIFICATION_JWT_SECRET"
+	// Skips authentication and trusts the x-tenant-id header. Local
+	// development only.
+	allowUnauthenticated = false
+
+	// What recurring schedules do with runs missed during downtime, unless
+	// the schedule sets its own policy.
+	missedRunPolicy = scheduler.MissedRunOnce
+
+	// SMS provider, defaults to the mock gateway from cmd/smsgateway.
+	smsProviderURL  = "http://localhost:8089"
+	smsAccountSID   = "AC_local"
+	smsAuthToken    = "local-token" // secret reference
+	smsFrom         = "+15550000000"
+	smsSegmentPrice = 0.0079
+	smsMaxSegments  = 10
+	callbackAddr    = ":8080"
+	smsCallbackURL  = "http://localhost:8080/callbacks/sms"
+	webhookTimeout  = 5 * time.Second
+	chatTimeout     = 5 * time.Second
+
+	// Push providers. Point the base URLs at a local stand-in for testing.
+	fcmBaseURL     = "https://fcm.googleapis.com"
+	fcmProjectID   = "notification-system"
+	fcmAccessToken = "" // secret references
+	apnsBaseURL    = "https://api.push.apple.com"
+	apnsTopic      = "com.example.notifications"
+	apnsAuthToken  = ""
+	pushTimeout    = 10 * time.Second
+
+	// Per-tenant metrics, on an internal address only; every tenant's
+	// numbers are shown to whoever can reach it.
+	metricsAddr = "localhost:9090"
 )
 
 func main() {
+	embedded := flag.Bool("embedded", false, "run in one process without a broker and Redis, for development")
+	brokerName := flag.String("broker", broker, "message broker: kafka, redis or nats")
+	outboxPath := flag.String("outbox", outboxFile, "file that holds notifications until the broker takes them, empty for none")
+	flag.Parse()
+
 	listener, err := net.Listen("tcp", grpcPort)
 	if err != nil {
 		log.Fatalf("Failed to listen grpc on port %s: %v", grpcPort, err)
 	}
-	grpcServer := grpc.NewServer()
+	tenants, err := tenant.LoadRegistry(tenantsFile)
+	if err != nil {
+		log.Fatalf("Failed to load tenants: %v", err)
+	}
 
-	notificationServer := server.NewNotificationServer([]string{kafkaBroker}, kafkaTopic)
+	var keystorePath string
+	passphrase := secrets.New(os.Getenv("NOTIFICATION_KEYSTORE_PASSPHRASE"))
+	if !passphrase.Empty() {
+		keystorePath = keystoreFile
+	}
+	secretStore := secrets.NewStore(keystorePath, passphrase)
+	secret := func(ref string) *secrets.Value {
+		v, err := secretStore.Value(ref)
+		if err != nil {
+			log.Fatalf("Failed to resolve secret: %v", err)
+		}
+		return v
+	}
+	go secretStore.Watch(context.Background(), secretsReloadInterval)
+
+	reloader, err := config.NewReloader(configFile, config.Config{
+		RateLimit:  rateLimit,
+		TimeWindow: config.Duration{Duration: timeWindow},
+		Workers:    workersPerPool,
+		SMS: config.SMS{
+			ProviderURL:     smsProviderURL,
+			PricePerSegment: smsSegmentPrice,
+			MaxSegments:     smsMaxSegments,
+		},
+		Push: config.Push{
+			FCMBaseURL:   fcmBaseURL,
+			FCMProjectID: fcmProjectID,
+			APNsBaseURL:  apnsBaseURL,
+			APNsTopic:    apnsTopic,
+			Timeout:      config.Duration{Duration: pushTimeout},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg := reloader.Current()
+	var opts []grpc.ServerOption
+	if tlsCertFile != "" {
+		creds, err := auth.ServerTLS(tlsCertFile, tlsKeyFile, tlsClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		log.Printf("Warning: gRPC API is served without TLS")
+	}
+	if allowUnauthenticated {
+		log.Printf("Warning: gRPC API accepts unauthenticated calls")
+		unary, stream := server.TenantInterceptors(tenants)
+		opts = append(opts, grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+	} else {
+		keys, err := auth.LoadKeys(apiKeysFile)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		authenticator := &auth.Authenticator{Keys: keys, JWTIssuer: jwtIssuer}
+		authenticator.JWTSecret, err = secretStore.Value(jwtSecretRef)
+		if errors.Is(err, secrets.ErrNotFound) {
+			log.Printf("JWT authentication disabled: %v", err)
+		} else if err != nil {
+			log.Fatalf("Failed to resolve JWT secret: %v", err)
+		}
+		if keys.Len() == 0 && authenticator.JWTSecret.Get().Empty() {
+			log.Printf("Warning: no API keys or JWT secret configured, every call will be rejected")
+		}
+		unary, stream := server.AuthInterceptors(authenticator, tenants)
+		opts = append(opts, grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+	}
+	grpcServer := grpc.NewServer(opts...)
+
+	// --- Queue and rate limiter ---
+	// Embedded mode keeps both in memory. Everything else that needs Redis
+	// or a broker is left out: scheduled delivery, templates, preferences,
+	// status, contacts, webhooks, push devices and dead letters.
+	var (
+		notificationQueue queue.Queue
+		limiter           *redis.Limiter
+	)
+	if *embedded {
+		log.Printf("Warning: running embedded, queued notifications are lost on exit and Redis backed features are off")
+		notificationQueue = queue.NewMemory()
+		limiter = redis.NewLimiterWithStore(redis.NewMemoryStore(), cfg.RateLimit, cfg.TimeWindow.Duration)
+	} else {
+		brokerAddr := map[string]string{
+			queue.BrokerKafka: kafkaBroker,
+			queue.BrokerRedis: redisAddr,
+			queue.BrokerNATS:  natsURL,
+		}[*brokerName]
+		notificationQueue, err = queue.Open(*brokerName, brokerAddr)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", *brokerName, err)
+		}
+		log.Printf("Using %s as message broker", *brokerName)
+		if *outboxPath != "" {
+			notificationQueue, err = outbox.Open(*outboxPath, notificationQueue)
+			if err != nil {
+				log.Fatalf("Failed to open outbox: %v", err)
+			}
+		}
+		limiter = redis.NewLimiter(redisAddr, cfg.RateLimit, cfg.TimeWindow.Duration)
+	}
 	defer func() {
-		if err := notificationServer.Close(); err != nil {
-			log.Printf("Error closing Kafka producer: %v", err)
+		if err := notificationQueue.Close(); err != nil {
+			log.Printf("Error closing queue: %v", err)
 		}
 	}()
+	limiter.UseTenants(tenants)
+
+	notificationServer := server.NewNotificationServer(notificationQueue, queueTopic)
 	pb.RegisterNotificationServiceServer(grpcServer, notificationServer)
 
-	limiter := redis.NewLimiter(redisAddr, rateLimit, timeWindow)
+	var (
+		templateStore   *templates.Store
+		prefsStore      *preferences.Store
+		statusStore     *status.Store
+		contactStore    *contacts.Store
+		webhookRegistry *webhooks.Registry
+		deviceRegistry  *push.Registry
+		deadLetters     *deadletter.Writer
+		deadLetterQueue queue.Queue
+	)
+	if !*embedded {
+		// --- Scheduler for delayed notifications ---
+		sched := scheduler.NewScheduler(redisAddr, notificationServer)
+		notificationServer.SetScheduler(sched)
+		go func() {
+			if err := sched.Start(context.Background()); err != nil {
+				log.Fatalf("Scheduler error: %v", err)
+			}
+		}()
+
+		cronSched := scheduler.NewCronScheduler(redisAddr, notificationServer, server.Occurrence, missedRunPolicy)
+		notificationServer.SetCronScheduler(cronSched)
+		go func() {
+			if err := cronSched.Start(context.Background()); err != nil {
+				log.Fatalf("Cron scheduler error: %v", err)
+			}
+		}()
 
-	pool1 := workerpool.NewWorkerPool(8)
-	pool2 := workerpool.NewWorkerPool(8)
+		templateStore = templates.NewStore(redisAddr)
+		prefsStore = preferences.NewStore(redisAddr)
+		statusStore = status.NewStore(redisAddr)
+		contactStore = contacts.NewStore(redisAddr)
+		webhookRegistry = webhooks.NewRegistry(redisAddr)
+		deviceRegistry = push.NewRegistry(redisAddr)
+
+		// Notifications that failed on every channel, replayed through the
+		// AdminService.
+		deadLetterQueue = notificationQueue
+		deadLetters = deadletter.NewWriter(deadLetterQueue, deadletter.Topic(queueTopic))
+	}
+	notificationServer.SetTemplateStore(templateStore)
+	notificationServer.SetPreferenceStore(prefsStore)
+	notificationServer.SetStatusStore(statusStore)
+	notificationServer.SetContactStore(contactStore)
+	notificationServer.SetWebhookRegistry(webhookRegistry)
+	notificationServer.SetDeviceRegistry(deviceRegistry)
+
+	// --- Notification history ---
+	var historyStore *history.Store
+	if historyDriver != "" {
+		historyStore, err = history.Open(historyDriver, historyDSN)
+		if err != nil {
+			log.Fatalf("Failed to open notification history: %v", err)
+		}
+		defer historyStore.Close()
+
+		retention := history.Retention{Default: historyRetention, Tenants: make(map[string]time.Duration)}
+		for _, t := range tenants.All() {
+			if t.HistoryRetentionDays > 0 {
+				retention.Tenants[t.ID] = time.Duration(t.HistoryRetentionDays) * 24 * time.Hour
+			}
+		}
+		go historyStore.Retain(context.Background(), retention, historyPruneInterval)
+	}
+	notificationServer.SetHistoryStore(historyStore)
+
+	pool1 := workerpool.NewWorkerPool(cfg.Workers)
+	pool2 := workerpool.NewWorkerPool(cfg.Workers)
+	pool1.UseTemplates(templateStore)
+	pool2.UseTemplates(templateStore)
+	pool1.UseStatus(statusStore)
+	pool2.UseStatus(statusStore)
+	pool1.UseTenants(tenants)
+	pool2.UseTenants(tenants)
+	pool1.UseDeadLetters(deadLetters)
+	pool2.UseDeadLetters(deadLetters)
+	pool1.UseHistory(historyStore)
+	pool2.UseHistory(historyStore)
+	// Passwords are resolved on every send; resolve them now as well so a
+	// missing one stops the startup instead of the first email. Without a
+	// password for the default relay only tenants with their own account
+	// can send email.
+	var defaultSMTP *tenant.SMTPAccount
+	if smtpHost != "" {
+		_, err := secretStore.Value(smtpPasswordRef)
+		if errors.Is(err, secrets.ErrNotFound) {
+			log.Printf("Default mail relay disabled: %v", err)
+		} else if err != nil {
+			log.Fatalf("Failed to resolve SMTP password: %v", err)
+		} else {
+			defaultSMTP = &tenant.SMTPAccount{Host: smtpHost, Port: smtpPort, Username: smtpUsername, Password: smtpPasswordRef}
+		}
+	}
+	pool1.UseSMTP(defaultSMTP, secretStore)
+	pool2.UseSMTP(defaultSMTP, secretStore)
+	for _, t := range tenants.All() {
+		if t.SMTP != nil {
+			secret(t.SMTP.Password)
+		}
+	}
+
+	smsProvider := sms.NewHTTPProvider(cfg.SMS.ProviderURL, smsAccountSID, secret(smsAuthToken))
+	smsProvider.Reconfigure(cfg.SMS.ProviderURL, cfg.SMS.PricePerSegment, cfg.SMS.MaxSegments)
+	smsProviders := []*sms.HTTPProvider{smsProvider}
+	smsNotifier := &notifier.TenantRouter{
+		Default: &notifier.SMSNotifier{Provider: smsProvider, From: smsFrom, StatusCallback: smsCallbackURL},
+		Tenants: make(map[string]notifier.Notifier),
+	}
+	// Tenants with their own provider account get their own status callback,
+	// signed with their auth token.
+	smsCallbacks := map[string]*secrets.Value{"": smsProvider.AuthToken}
+	for _, t := range tenants.All() {
+		if t.SMS == nil {
+			continue
+		}
+		p := sms.NewHTTPProvider(cfg.SMS.ProviderURL, t.SMS.AccountSID, secret(t.SMS.AuthToken))
+		p.Reconfigure(cfg.SMS.ProviderURL, cfg.SMS.PricePerSegment, cfg.SMS.MaxSegments)
+		smsProviders = append(smsProviders, p)
+		smsNotifier.Tenants[t.ID] = &notifier.SMSNotifier{Provider: p, From: t.SMS.From, StatusCallback: smsCallbackURL + "/" + t.ID}
+		smsCallbacks["/"+t.ID] = p.AuthToken
+	}
+	pool1.Register("sms", smsNotifier)
+	pool2.Register("sms", smsNotifier)
+
+	// Chat rooms, the recipient is the room's incoming-webhook URL.
+	slack := notifier.NewSlackNotifier(chatTimeout)
+	discord := notifier.NewDiscordNotifier(chatTimeout)
+	teams := notifier.NewTeamsNotifier(chatTimeout)
+	fcmToken, apnsToken := secret(fcmAccessToken), secret(apnsAuthToken)
+	pushConfig := func(c config.Config) push.Config {
+		return push.Config{
+			FCMBaseURL:     c.Push.FCMBaseURL,
+			FCMProjectID:   c.Push.FCMProjectID,
+			FCMAccessToken: fcmToken,
+			APNsBaseURL:    c.Push.APNsBaseURL,
+			APNsTopic:      c.Push.APNsTopic,
+			APNsAuthToken:  apnsToken,
+		}
+	}
+	pushClient := push.NewClient(pushConfig(cfg), cfg.Push.Timeout.Duration)
+	pushNotifier := &notifier.PushNotifier{
+		Devices: deviceRegistry,
+		Client:  pushClient,
+	}
+
+	for _, pool := range []*workerpool.WorkerPool{pool1, pool2} {
+		pool.Register("slack", slack)
+		pool.Register("discord", discord)
+		pool.Register("teams", teams)
+	}
+	// Webhook endpoints and push devices are looked up in Redis.
+	if !*embedded {
+		webhookNotifier := notifier.NewWebhookNotifier(webhookRegistry, webhookTimeout)
+		for _, pool := range []*workerpool.WorkerPool{pool1, pool2} {
+			pool.Register("webhook", webhookNotifier)
+			pool.Register("push", pushNotifier)
+		}
+	}
 	pool1.Start()
 	pool2.Start()
 
+	pb.RegisterAdminServiceServer(grpcServer, server.NewAdminServer(notificationServer, limiter,
+		[]*workerpool.WorkerPool{pool1, pool2}, deadLetterQueue, deadletter.Topic(queueTopic)))
+
+	// --- Config reload ---
+	reloader.OnChange("rate limiter", func(c config.Config) error {
+		return limiter.SetPolicy(c.RateLimit, c.TimeWindow.Duration)
+	})
+	reloader.OnChange("worker pools", func(c config.Config) error {
+		for _, pool := range []*workerpool.WorkerPool{pool1, pool2} {
+			if err := pool.Resize(c.Workers); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	reloader.OnChange("sms providers", func(c config.Config) error {
+		for _, p := range smsProviders {
+			p.Reconfigure(c.SMS.ProviderURL, c.SMS.PricePerSegment, c.SMS.MaxSegments)
+		}
+		return nil
+	})
+	reloader.OnChange("push provider", func(c config.Config) error {
+		pushClient.Reconfigure(pushConfig(c), c.Push.Timeout.Duration)
+		return nil
+	})
+	go reloader.Watch(context.Background(), configPollInterval)
+
+	// --- Provider callbacks ---
+	// The worker records an SMS as delivered once the provider accepts it;
+	// a later report that it did not arrive turns that into a failure.
+	onSMSStatus := func(u sms.StatusUpdate) {
+		log.Printf("SMS %s to %s is %s %s", u.MessageID, u.To, u.Status, u.ErrorCode)
+		if !u.Failed() || u.NotificationID == "" {
+			return
+		}
+		ctx := tenant.WithTenant(context.Background(), u.TenantID)
+		reason := "provider reported " + u.Status
+		if u.ErrorCode != "" {
+			reason += " (error " + u.ErrorCode + ")"
+		}
+		if statusStore != nil {
+			err := statusStore.Record(ctx, status.Status{
+				NotificationID: u.NotificationID,
+				UserID:         u.UserID,
+				State:          status.Failed,
+				Channel:        "sms",
+				Reason:         reason,
+			})
+			if err != nil {
+				log.Printf("Failed to record status of %s: %v", u.NotificationID, err)
+			}
+		}
+		if historyStore != nil {
+			err := historyStore.Record(ctx, history.Entry{
+				NotificationID:   u.NotificationID,
+				UserID:           u.UserID,
+				Channel:          "sms",
+				Recipient:        u.To,
+				Status:           status.Failed,
+				Reason:           reason,
+				ProviderResponse: "id " + u.MessageID + ", status " + u.Status,
+			})
+			if err != nil {
+				log.Printf("Failed to record history of %s: %v", u.NotificationID, err)
+			}
+		}
+	}
+	callbacks := http.NewServeMux()
+	for suffix, token := range smsCallbacks {
+		handle := onSMSStatus
+		if suffix != "" {
+			// A tenant's own account can only report on that tenant.
+			tenantID := suffix[1:]
+			handle = func(u sms.StatusUpdate) {
+				u.TenantID = tenantID
+				onSMSStatus(u)
+			}
+		}
+		callbacks.Handle("/callbacks/sms"+suffix, sms.CallbackHandler(token, smsCallbackURL+suffix, handle))
+	}
+	go func() {
+		if err := http.ListenAndServe(callbackAddr, callbacks); err != nil {
+			log.Fatalf("Callback server error: %v", err)
+		}
+	}()
+
+	// --- Internal metrics ---
+	internal := http.NewServeMux()
+	internal.Handle("/metrics/tenants", tenant.MetricsHandler())
+	go func() {
+		if err := http.ListenAndServe(metricsAddr, internal); err != nil {
+			log.Fatalf("Metrics server error: %v", err)
+		}
+	}()
+
 	// --- Load balancer ---
 	go func() {
-		err := loadbalancer.Start([]string{kafkaBroker}, kafkaTopic, limiter, []*workerpool.WorkerPool{pool1, pool2})
+		err := loadbalancer.Start(context.Background(), loadbalancer.Config{
+			Queue:       notificationQueue,
+			Topic:       queueTopic,
+			Limiter:     limiter,
+			Pools:       []*workerpool.WorkerPool{pool1, pool2},
+			Preferences: prefsStore,
+			Status:      statusStore,
+			Contacts:    contactStore,
+			History:     historyStore,
+		})
 		if err != nil {
 			log.Fatalf("Load balancer error: %v", err)
 		}
@@ -0,0 +1,244 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chat notifiers post to incoming-webhook URLs of chat platforms. The
+// notification recipient is the incoming-webhook URL of the room. Since any
+// caller can name it, only https URLs on the platform's own hosts are
+// posted to, so a notification cannot reach internal addresses.
+
+// SlackNotifier posts Block Kit messages to Slack incoming webhooks.
+type SlackNotifier struct{ chatClient }
+
+// DiscordNotifier posts embeds to Discord webhooks.
+type DiscordNotifier struct{ chatClient }
+
+// TeamsNotifier posts Adaptive Cards to Microsoft Teams incoming webhooks.
+type TeamsNotifier struct{ chatClient }
+
+func NewSlackNotifier(timeout time.Duration) *SlackNotifier {
+	return &SlackNotifier{newChatClient("slack", timeout, "hooks.slack.com")}
+}
+
+func NewDiscordNotifier(timeout time.Duration) *DiscordNotifier {
+	return &DiscordNotifier{newChatClient("discord", timeout, "discord.com")}
+}
+
+func NewTeamsNotifier(timeout time.Duration) *TeamsNotifier {
+	return &TeamsNotifier{newChatClient("teams", timeout, "*.webhook.office.com")}
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := map[string]any{
+		"text": n.Message, // fallback for notifications and clients without blocks
+		"blocks": []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": truncate(n.Message, 3000)},
+			},
+			map[string]any{
+				"type": "context",
+				"elements": []any{
+					map[string]any{"type": "mrkdwn", "text": "Notification " + n.ID},
+				},
+			},
+		},
+	}
+	return s.post(ctx, n.Recipient, payload)
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := map[string]any{
+		"embeds": []any{
+			map[string]any{
+				"description": truncate(n.Message, 4096),
+				"timestamp":   time.Now().UTC().Format(time.RFC3339),
+				"footer":      map[string]any{"text": "Notification " + n.ID},
+			},
+		},
+	}
+	// Without wait=true Discord answers 204 before the message is stored.
+	u, err := url.Parse(n.Recipient)
+	if err != nil {
+		return fmt.Errorf("discord: invalid webhook url: %w", err)
+	}
+	q := u.Query()
+	q.Set("wait", "true")
+	u.RawQuery = q.Encode()
+	return d.post(ctx, u.String(), payload)
+}
+
+func (t *TeamsNotifier) Notify(ctx context.Context, n Notification) error {
+	payload := map[string]any{
+		"type": "message",
+		"attachments": []any{
+			map[string]any{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []any{
+						map[string]any{"type": "TextBlock", "text": n.Message, "wrap": true},
+						map[string]any{"type": "TextBlock", "text": "Notification " + n.ID, "isSubtle": true, "size": "Small"},
+					},
+				},
+			},
+		},
+	}
+	return t.post(ctx, n.Recipient, payload)
+}
+
+// A rate-limit window announced by the platform is honored for at most
+// this long.
+const maxRateLimitWindow = time.Minute
+
+// chatClient posts JSON and honors the platform's rate-limit headers: a
+// 429 with Retry-After, and Discord's X-RateLimit-Remaining /
+// X-RateLimit-Reset-After. Posts to that URL fail with a RetryableError
+// until the window resets, so no worker is held while it is closed.
+type chatClient struct {
+	platform string
+	hosts    []string // webhook hosts; "*." matches any subdomain
+	client   *http.Client
+
+	mu          sync.Mutex
+	blockedTill map[string]time.Time
+}
+
+func newChatClient(platform string, timeout time.Duration, hosts ...string) chatClient {
+	return chatClient{
+		platform: platform,
+		hosts:    hosts,
+		client: &http.Client{
+			Timeout: timeout,
+			// A redirect could lead off the platform's hosts.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		blockedTill: make(map[string]time.Time),
+	}
+}
+
+func (c *chatClient) post(ctx context.Context, webhookURL string, payload any) error {
+	if webhookURL == "" {
+		return fmt.Errorf("%s: no webhook url", c.platform)
+	}
+	if err := c.checkURL(webhookURL); err != nil {
+		return err
+	}
+	if err := c.checkWindow(webhookURL); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &RetryableError{Err: fmt.Errorf("%s: %w", c.platform, err)}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	c.trackRateLimit(webhookURL, resp)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		Respond(ctx, "%s: status %d", c.platform, resp.StatusCode)
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &RetryableError{
+			Err:        fmt.Errorf("%s: status %d", c.platform, resp.StatusCode),
+			RetryAfter: retryAfter(resp.Header),
+		}
+	default:
+		return fmt.Errorf("%s: status %d", c.platform, resp.StatusCode)
+	}
+}
+
+// checkURL accepts only https URLs on the hosts of the platform.
+func (c *chatClient) checkURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("%s: invalid webhook url: %w", c.platform, err)
+	}
+	if u.Scheme != "https" || u.User != nil || (u.Port() != "" && u.Port() != "443") {
+		return fmt.Errorf("%s: webhook url must be https on the default port", c.platform)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range c.hosts {
+		if host == h || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: webhook host %s is not allowed", c.platform, host)
+}
+
+// checkWindow fails with a RetryableError while the rate-limit window of
+// webhookURL is closed.
+func (c *chatClient) checkWindow(webhookURL string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wait := time.Until(c.blockedTill[webhookURL])
+	if wait <= 0 {
+		delete(c.blockedTill, webhookURL)
+		return nil
+	}
+	return &RetryableError{
+		Err:        fmt.Errorf("%s: rate limited", c.platform),
+		RetryAfter: wait,
+	}
+}
+
+func (c *chatClient) trackRateLimit(webhookURL string, resp *http.Response) {
+	var until time.Time
+	if resp.StatusCode == http.StatusTooManyRequests {
+		until = time.Now().Add(retryAfter(resp.Header))
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if secs, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+			reset := time.Now().Add(time.Duration(secs * float64(time.Second)))
+			if reset.After(until) {
+				until = reset
+			}
+		}
+	}
+	if until.IsZero() {
+		return
+	}
+	if limit := time.Now().Add(maxRateLimitWindow); until.After(limit) {
+		until = limit
+	}
+
+	c.mu.Lock()
+	c.blockedTill[webhookURL] = until
+	c.mu.Unlock()
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
@@ -1,10 +1,13 @@
 package notifier
 
-import "log"
+import (
+	"context"
+	"log"
+)
 
 type EmailNotifier struct{}
 
-func (e *EmailNotifier) Notify(n Notification) error {
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
 	log.Printf("[EMAIL] To: %s | Msg: %s\n", n.Recipient, n.Message)
 	return nil
 }
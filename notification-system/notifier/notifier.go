@@ -1,12 +1,33 @@
 package notifier
 
+import (
+	"context"
+	"time"
+)
+
 type Notification struct {
+	ID        string
 	UserID    string
 	Type      string
 	Recipient string
 	Message   string
+
+	// Push only.
+	Title       string
+	Badge       int32
+	Data        map[string]string
+	CollapseKey string
+	PushTTL     time.Duration
+}
+
+// FallbackStep is a channel to try when delivery on the previous one failed
+// permanently. An empty Recipient lets the channel pick one.
+type FallbackStep struct {
+	Channel        string `json:"channel"`
+	Recipient      string `json:"recipient"`
+	TimeoutSeconds int64  `json:"timeout_seconds"`
 }
 
 type Notifier interface {
-	Notify(notification Notification) error
+	Notify(ctx context.Context, notification Notification) error
 }
@@ -0,0 +1,77 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/push"
+)
+
+// PushNotifier sends to every device registered for the user, or only to the
+// device token given as recipient. Tokens the provider rejects as invalid
+// are pruned from the registry.
+type PushNotifier struct {
+	Devices *push.Registry
+	Client  *push.Client
+}
+
+func (p *PushNotifier) Notify(ctx context.Context, n Notification) error {
+	devices, err := p.Devices.List(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	if n.Recipient != "" {
+		var only []*push.Device
+		for _, d := range devices {
+			if d.Token == n.Recipient {
+				only = append(only, d)
+			}
+		}
+		devices = only
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("user %s has no registered push devices", n.UserID)
+	}
+
+	msg := push.Message{
+		Title:       n.Title,
+		Body:        n.Message,
+		Badge:       n.Badge,
+		Data:        n.Data,
+		CollapseKey: n.CollapseKey,
+		TTL:         n.PushTTL,
+	}
+
+	delivered := 0
+	var lastErr error
+	for _, d := range devices {
+		err := p.Client.Send(ctx, d, msg)
+		if err == nil {
+			delivered++
+			continue
+		}
+		lastErr = err
+		if errors.Is(err, push.ErrInvalidToken) {
+			log.Printf("[PUSH] Pruning invalid %s token for user %s: %v", d.Platform, n.UserID, err)
+			if _, err := p.Devices.Unregister(ctx, n.UserID, d.Token); err != nil {
+				log.Printf("[PUSH] Failed to prune token for user %s: %v", n.UserID, err)
+			}
+			continue
+		}
+		log.Printf("[PUSH] Failed to send to %s device of user %s: %v", d.Platform, n.UserID, err)
+	}
+
+	if delivered > 0 {
+		log.Printf("[PUSH] Delivered to %d of %d device(s) of user %s", delivered, len(devices), n.UserID)
+		Respond(ctx, "delivered to %d of %d device(s)", delivered, len(devices))
+		return nil
+	}
+
+	var pe *push.Error
+	if errors.As(lastErr, &pe) && pe.Retryable {
+		return &RetryableError{Err: lastErr, RetryAfter: pe.RetryAfter}
+	}
+	return lastErr
+}
@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Response collects what the providers answered to one delivery, e.g. a
+// message id, for the notification history. It lasts over the retries of
+// the delivery, so a notifier sending to several targets can remember the
+// ones already done.
+type Response struct {
+	mu    sync.Mutex
+	parts []string
+	done  map[string]error
+}
+
+type responseKey struct{}
+
+// WithResponse returns a context in which notifiers report to the returned
+// Response.
+func WithResponse(ctx context.Context) (context.Context, *Response) {
+	r := &Response{}
+	return context.WithValue(ctx, responseKey{}, r), r
+}
+
+// Respond adds to the Response of ctx, if there is one.
+func Respond(ctx context.Context, format string, args ...any) {
+	r, ok := ctx.Value(responseKey{}).(*Response)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parts = append(r.parts, fmt.Sprintf(format, args...))
+}
+
+// MarkDone records in the Response of ctx that target, e.g. an endpoint id,
+// is not to be tried again: it got the notification, or failed with an
+// error that is not retryable.
+func MarkDone(ctx context.Context, target string, err error) {
+	r, ok := ctx.Value(responseKey{}).(*Response)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done == nil {
+		r.done = make(map[string]error)
+	}
+	r.done[target] = err
+}
+
+// Done reports whether an earlier attempt of the delivery marked target
+// done, and with which error.
+func Done(ctx context.Context, target string) (bool, error) {
+	r, ok := ctx.Value(responseKey{}).(*Response)
+	if !ok {
+		return false, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err, done := r.done[target]
+	return done, err
+}
+
+func (r *Response) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.parts, "; ")
+}
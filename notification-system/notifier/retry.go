@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryableError marks a delivery failure that may succeed if attempted
+// again, such as a 5xx or 429 response. RetryAfter is the delay the remote
+// side asked for, if any.
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf("retryable: %v", e.Err)
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err is worth retrying and how long the remote
+// side asked to wait.
+func IsRetryable(err error) (bool, time.Duration) {
+	var re *RetryableError
+	if errors.As(err, &re) {
+		return true, re.RetryAfter
+	}
+	return false, 0
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -1,10 +1,43 @@
 package notifier
 
-import "log"
+import (
+	"context"
+	"errors"
+	"log"
 
-type SMSNotifier struct{}
+	"github.com/lazypanda2004/notification-system/internal/sms"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
 
-func (s *SMSNotifier) Notify(n Notification) error {
-	log.Printf("[SMS] To: %s | Msg: %s\n", n.Recipient, n.Message)
+// SMSNotifier delivers through an SMS provider. Without a provider it only
+// logs the message.
+type SMSNotifier struct {
+	Provider       sms.Provider
+	From           string
+	StatusCallback string
+}
+
+func (s *SMSNotifier) Notify(ctx context.Context, n Notification) error {
+	if s.Provider == nil {
+		log.Printf("[SMS] To: %s | Msg: %s\n", n.Recipient, n.Message)
+		return nil
+	}
+
+	res, err := s.Provider.Send(ctx, sms.Message{
+		To:             n.Recipient,
+		From:           s.From,
+		Body:           n.Message,
+		StatusCallback: sms.CallbackURL(s.StatusCallback, n.ID, n.UserID, tenant.FromContext(ctx)),
+	})
+	var pe *sms.ProviderError
+	if errors.As(err, &pe) && pe.Retryable {
+		return &RetryableError{Err: err}
+	} else if err != nil {
+		return err
+	}
+
+	log.Printf("[SMS] To: %s | id %s, status %s, %d %s segment(s), cost %.4f",
+		n.Recipient, res.ID, res.Status, res.Segmentation.Segments, res.Segmentation.Encoding, res.Cost)
+	Respond(ctx, "id %s, status %s, %d segment(s)", res.ID, res.Status, res.Segmentation.Segments)
 	return nil
 }
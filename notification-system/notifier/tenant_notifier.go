@@ -0,0 +1,22 @@
+package notifier
+
+import (
+	"context"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+)
+
+// TenantRouter sends through a tenant's own notifier when it has one, such
+// as an SMS notifier on the tenant's provider account, and through Default
+// otherwise.
+type TenantRouter struct {
+	Default Notifier
+	Tenants map[string]Notifier
+}
+
+func (r *TenantRouter) Notify(ctx context.Context, n Notification) error {
+	if t, ok := r.Tenants[tenant.FromContext(ctx)]; ok {
+		return t.Notify(ctx, n)
+	}
+	return r.Default.Notify(ctx, n)
+}
@@ -0,0 +1,143 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/webhooks"
+)
+
+// WebhookNotifier POSTs notifications as JSON to registered endpoints. The
+// recipient is an endpoint id; an empty recipient delivers to every endpoint
+// of the user. A retry only goes to the endpoints that have not accepted the
+// notification yet.
+type WebhookNotifier struct {
+	Endpoints *webhooks.Registry
+	Timeout   time.Duration
+
+	client *http.Client
+}
+
+func NewWebhookNotifier(endpoints *webhooks.Registry, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{
+		Endpoints: endpoints,
+		Timeout:   timeout,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+type webhookPayload struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	var endpoints []*webhooks.Endpoint
+	if n.Recipient != "" {
+		e, err := w.Endpoints.Get(ctx, n.Recipient)
+		if err != nil {
+			return err
+		}
+		if e.UserID != n.UserID {
+			return fmt.Errorf("webhook endpoint %s does not belong to user %s", e.ID, n.UserID)
+		}
+		endpoints = append(endpoints, e)
+	} else {
+		list, err := w.Endpoints.List(ctx, n.UserID)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return fmt.Errorf("user %s has no webhook endpoints", n.UserID)
+		}
+		endpoints = list
+	}
+
+	var (
+		errs       []error
+		retryable  bool
+		retryAfter time.Duration
+	)
+	for _, e := range endpoints {
+		if done, err := Done(ctx, e.ID); done {
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		err := w.post(ctx, e, n)
+		retry, after := IsRetryable(err)
+		if !retry {
+			MarkDone(ctx, e.ID, err)
+		}
+		if err == nil {
+			continue
+		}
+		errs = append(errs, err)
+		if retry {
+			retryable, retryAfter = true, max(retryAfter, after)
+		}
+	}
+	switch {
+	case len(errs) == 0:
+		return nil
+	case retryable:
+		return &RetryableError{Err: errors.Join(errs...), RetryAfter: retryAfter}
+	default:
+		return errors.Join(errs...)
+	}
+}
+
+func (w *WebhookNotifier) post(ctx context.Context, e *webhooks.Endpoint, n Notification) error {
+	now := time.Now()
+	body, err := json.Marshal(webhookPayload{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Message:   n.Message,
+		Timestamp: now.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhooks.IDHeader, n.ID)
+	req.Header.Set(webhooks.TimestampHeader, fmt.Sprint(now.Unix()))
+	req.Header.Set(webhooks.SignatureHeader, webhooks.Sign(e.Secrets(now), now, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// Timeouts and connection errors are transient from our side.
+		return &RetryableError{Err: fmt.Errorf("webhook %s: %w", e.ID, err)}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		Respond(ctx, "webhook %s: status %d", e.ID, resp.StatusCode)
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return &RetryableError{
+			Err:        fmt.Errorf("webhook %s: status %d", e.ID, resp.StatusCode),
+			RetryAfter: retryAfter(resp.Header),
+		}
+	default:
+		return fmt.Errorf("webhook %s: status %d", e.ID, resp.StatusCode)
+	}
+}
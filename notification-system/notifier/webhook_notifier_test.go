@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lazypanda2004/notification-system/internal/webhooks"
+)
+
+func TestWebhookRetriesOnlyFailedEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses are the responses of each endpoint, one per request; the
+		// last one repeats.
+		statuses      [][]int
+		wantRequests  []int
+		wantErr       bool
+		wantRetryable bool
+	}{
+		{
+			name:         "all accept",
+			statuses:     [][]int{{200}, {204}},
+			wantRequests: []int{1, 1},
+		},
+		{
+			name:          "one fails, then recovers",
+			statuses:      [][]int{{200}, {503, 200}},
+			wantRequests:  []int{1, 2},
+			wantRetryable: true,
+		},
+		{
+			name:          "one rejects for good",
+			statuses:      [][]int{{400}, {503, 200}},
+			wantRequests:  []int{1, 2},
+			wantErr:       true,
+			wantRetryable: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			reg := webhooks.NewRegistry(miniredis.RunT(t).Addr())
+
+			var mu sync.Mutex
+			requests := make([]int, len(tt.statuses))
+			for i, statuses := range tt.statuses {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					n := requests[i]
+					requests[i]++
+					mu.Unlock()
+					w.WriteHeader(statuses[min(n, len(statuses)-1)])
+				}))
+				t.Cleanup(srv.Close)
+				if _, err := reg.Register(ctx, "alice", srv.URL); err != nil {
+					t.Fatalf("Register: %v", err)
+				}
+			}
+
+			w := NewWebhookNotifier(reg, time.Second)
+			ctx, _ = WithResponse(ctx)
+			n := Notification{ID: "n1", UserID: "alice", Type: "webhook", Message: "hi"}
+
+			// The first attempt, and one retry if it asks for one.
+			err := w.Notify(ctx, n)
+			retry, _ := IsRetryable(err)
+			if retry != tt.wantRetryable {
+				t.Fatalf("first attempt = %v, want retryable %v", err, tt.wantRetryable)
+			}
+			if retry {
+				err = w.Notify(ctx, n)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify = %v, want error %v", err, tt.wantErr)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for i, want := range tt.wantRequests {
+				if requests[i] != want {
+					t.Errorf("endpoint %d got %d requests, want %d", i, requests[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/lazypanda2004/notification-system/internal/deadletter"
+	"github.com/lazypanda2004/notification-system/internal/queue"
+	"github.com/lazypanda2004/notification-system/internal/redis"
+	"github.com/lazypanda2004/notification-system/internal/status"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/lazypanda2004/notification-system/internal/workerpool"
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+const (
+	defaultInspectLimit = 100
+	defaultReplayLimit  = 100
+)
+
+// AdminServer implements AdminService. Queue operations act on the caller's
+// tenant; pausing channels, resizing pools and replaying dead letters affect
+// every tenant and are reserved for callers of the default tenant.
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	notifications   *NotificationServer // republishes requeued and replayed tasks
+	limiter         *redis.Limiter
+	pools           []*workerpool.WorkerPool
+	deadLetters     queue.Queue // nil when dead letters are off
+	deadLetterTopic string
+}
+
+func NewAdminServer(notifications *NotificationServer, limiter *redis.Limiter, pools []*workerpool.WorkerPool, deadLetters queue.Queue, deadLetterTopic string) *AdminServer {
+	return &AdminServer{
+		notifications:   notifications,
+		limiter:         limiter,
+		pools:           pools,
+		deadLetters:     deadLetters,
+		deadLetterTopic: deadLetterTopic,
+	}
+}
+
+const notOperator = "Only callers of the default tenant can do this"
+
+func isOperator(ctx context.Context) bool {
+	return tenant.FromContext(ctx) == tenant.Default
+}
+
+func (a *AdminServer) ListQueues(ctx context.Context, req *pb.ListQueuesRequest) (*pb.ListQueuesResponse, error) {
+	tenants := []string{tenant.FromContext(ctx)}
+	if req.AllTenants {
+		if !isOperator(ctx) {
+			return nil, grpcstatus.Error(codes.PermissionDenied, notOperator)
+		}
+		var err error
+		tenants, err = a.limiter.QueuedTenants(ctx)
+		if err != nil {
+			log.Printf("Failed to list tenants with queued tasks: %v", err)
+			return nil, err
+		}
+		sort.Strings(tenants)
+	}
+
+	var out []*pb.QueueInfo
+	for _, id := range tenants {
+		tctx := tenant.WithTenant(ctx, id)
+		users, err := a.limiter.QueuedUsers(tctx)
+		if err != nil {
+			log.Printf("Failed to list queued users of tenant %s: %v", id, err)
+			return nil, err
+		}
+		sort.Strings(users)
+		for _, userID := range users {
+			depth, err := a.limiter.QueueDepth(tctx, userID)
+			if err != nil || depth == 0 {
+				continue
+			}
+			out = append(out, &pb.QueueInfo{TenantId: id, UserId: userID, Depth: depth})
+		}
+	}
+	return &pb.ListQueuesResponse{Queues: out}, nil
+}
+
+func (a *AdminServer) InspectQueue(ctx context.Context, req *pb.UserQueueRequest) (*pb.InspectQueueResponse, error) {
+	if req.UserId == "" {
+		return &pb.InspectQueueResponse{Success: false, Message: "user_id is required"}, nil
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultInspectLimit
+	}
+
+	depth, err := a.limiter.QueueDepth(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to get queue depth of user %s: %v", req.UserId, err)
+		return &pb.InspectQueueResponse{Success: false, Message: "Failed to read queue"}, nil
+	}
+	tasks, err := a.limiter.PeekQueue(ctx, req.UserId, limit)
+	if err != nil {
+		log.Printf("Failed to read queue of user %s: %v", req.UserId, err)
+		return &pb.InspectQueueResponse{Success: false, Message: "Failed to read queue"}, nil
+	}
+
+	out := make([]*pb.QueuedNotification, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, &pb.QueuedNotification{
+			NotificationId: t.ID,
+			Type:           t.Type,
+			Recipient:      t.Recipient,
+			Priority:       t.Priority,
+			Category:       t.Category,
+			ExpiresAt:      t.ExpiresAt,
+		})
+	}
+	return &pb.InspectQueueResponse{Success: true, Depth: depth, Notifications: out}, nil
+}
+
+// PurgeQueue drops the user's queued tasks and reports them as cancelled.
+func (a *AdminServer) PurgeQueue(ctx context.Context, req *pb.UserQueueRequest) (*pb.AdminResponse, error) {
+	if req.UserId == "" {
+		return &pb.AdminResponse{Success: false, Message: "user_id is required"}, nil
+	}
+	tasks, err := a.limiter.PurgeQueue(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to purge queue of user %s: %v", req.UserId, err)
+		return &pb.AdminResponse{Success: false, Message: "Failed to purge queue"}, nil
+	}
+	for _, t := range tasks {
+		a.notifications.recordStatus(ctx, t.ID, t.UserID, t.Type, status.Cancelled)
+	}
+	log.Printf("Purged %d queued tasks of user %s", len(tasks), req.UserId)
+	return &pb.AdminResponse{Success: true, Message: fmt.Sprintf("Purged %d notifications", len(tasks)), Count: int64(len(tasks))}, nil
+}
+
+// RequeueQueue publishes the user's queued tasks again, so they go through
+// preferences, recipient resolution and the rate limit afresh. Combine with
+// ResetRateLimit to let them through right away. Only the tasks queued when
+// it is called are requeued: while the user is still limited the load
+// balancer queues them again, and those must not be picked up once more.
+func (a *AdminServer) RequeueQueue(ctx context.Context, req *pb.UserQueueRequest) (*pb.AdminResponse, error) {
+	if req.UserId == "" {
+		return &pb.AdminResponse{Success: false, Message: "user_id is required"}, nil
+	}
+
+	depth, err := a.limiter.QueueDepth(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to read queue depth of user %s: %v", req.UserId, err)
+		return &pb.AdminResponse{Success: false, Message: "Failed to read queue"}, nil
+	}
+	var n int64
+	for range depth {
+		task, err := a.limiter.PopQueuedTask(ctx, req.UserId)
+		if task == nil && err != nil {
+			log.Printf("Failed to pop queued task of user %s: %v", req.UserId, err)
+			return &pb.AdminResponse{Success: false, Message: "Failed to read queue", Count: n}, nil
+		}
+		if task == nil {
+			break
+		}
+		if errors.Is(err, redis.ErrExpired) {
+			a.notifications.recordStatus(ctx, task.ID, task.UserID, task.Type, status.Expired)
+			continue
+		}
+
+		data, err := json.Marshal(task)
+		if err == nil {
+			err = a.notifications.Publish(ctx, task.UserID, data)
+		}
+		if err != nil {
+			log.Printf("Failed to requeue notification %s: %v", task.ID, err)
+			if err := a.limiter.PushFront(ctx, *task); err != nil {
+				log.Printf("Failed to put notification %s back: %v", task.ID, err)
+			}
+			return &pb.AdminResponse{Success: false, Message: "Failed to publish notification", Count: n}, nil
+		}
+		a.notifications.recordStatus(ctx, task.ID, task.UserID, task.Type, status.Queued)
+		n++
+	}
+	log.Printf("Requeued %d tasks of user %s", n, req.UserId)
+	return &pb.AdminResponse{Success: true, Message: fmt.Sprintf("Requeued %d notifications", n), Count: n}, nil
+}
+
+func (a *AdminServer) ResetRateLimit(ctx context.Context, req *pb.UserQueueRequest) (*pb.AdminResponse, error) {
+	if req.UserId == "" {
+		return &pb.AdminResponse{Success: false, Message: "user_id is required"}, nil
+	}
+	if err := a.limiter.ResetRateLimit(ctx, req.UserId); err != nil {
+		log.Printf("Failed to reset rate limit of user %s: %v", req.UserId, err)
+		return &pb.AdminResponse{Success: false, Message: "Failed to reset rate limit"}, nil
+	}
+	return &pb.AdminResponse{Success: true, Message: "Rate limit reset"}, nil
+}
+
+func (a *AdminServer) ListChannels(ctx context.Context, req *pb.ListChannelsRequest) (*pb.ListChannelsResponse, error) {
+	paused, err := a.limiter.PausedChannels(ctx)
+	if err != nil {
+		log.Printf("Failed to list paused channels: %v", err)
+		return nil, err
+	}
+	parked, err := a.limiter.ParkedChannels(ctx)
+	if err != nil {
+		log.Printf("Failed to list parked channels: %v", err)
+		return nil, err
+	}
+
+	states := make(map[string]*pb.ChannelState)
+	for _, c := range paused {
+		states[c] = &pb.ChannelState{Channel: c, Paused: true}
+	}
+	for c, n := range parked {
+		if states[c] == nil {
+			states[c] = &pb.ChannelState{Channel: c}
+		}
+		states[c].Parked = n
+	}
+
+	out := make([]*pb.ChannelState, 0, len(states))
+	for _, st := range states {
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Channel < out[j].Channel })
+	return &pb.ListChannelsResponse{Channels: out}, nil
+}
+
+// PauseChannel parks new tasks of the channel until it is resumed, e.g.
+// during a provider outage. Tasks already in the pools are still sent.
+func (a *AdminServer) PauseChannel(ctx context.Context, req *pb.ChannelRequest) (*pb.AdminResponse, error) {
+	if resp := a.checkChannel(ctx, req.Channel); resp != nil {
+		return resp, nil
+	}
+	if err := a.limiter.PauseChannel(ctx, req.Channel); err != nil {
+		log.Printf("Failed to pause %s: %v", req.Channel, err)
+		return &pb.AdminResponse{Success: false, Message: "Failed to pause channel"}, nil
+	}
+	log.Printf("Channel %s paused", req.Channel)
+	return &pb.AdminResponse{Success: true, Message: "Channel paused"}, nil
+}
+
+func (a *AdminServer) ResumeChannel(ctx context.Context, req *pb.ChannelRequest) (*pb.AdminResponse, error) {
+	if resp := a.checkChannel(ctx, req.Channel); resp != nil {
+		return resp, nil
+	}
+	if err := a.limiter.ResumeChannel(ctx, req.Channel); err != nil {
+		log.Printf("Failed to resume %s: %v", req.Channel, err)
+		return &pb.AdminResponse{Success: false, Message: "Failed to resume channel"}, nil
+	}
+	log.Printf("Channel %s resumed", req.Channel)
+	return &pb.AdminResponse{Success: true, Message: "Channel resumed, parked notifications will be sent"}, nil
+}
+
+func (a *AdminServer) checkChannel(ctx context.Context, channel string) *pb.AdminResponse {
+	if !isOperator(ctx) {
+		return &pb.AdminResponse{Success: false, Message: notOperator}
+	}
+	if len(a.pools) == 0 || !a.pools[0].Handles(channel) {
+		return &pb.AdminResponse{Success: false, Message: fmt.Sprintf("Unknown channel %q", channel)}
+	}
+	return nil
+}
+
+func (a *AdminServer) ListPools(ctx context.Context, req *pb.ListPoolsRequest) (*pb.ListPoolsResponse, error) {
+	return &pb.ListPoolsResponse{Success: true, Pools: a.poolInfo()}, nil
+}
+
+func (a *AdminServer) ResizePool(ctx context.Context, req *pb.ResizePoolRequest) (*pb.ListPoolsResponse, error) {
+	if !isOperator(ctx) {
+		return &pb.ListPoolsResponse{Success: false, Message: notOperator}, nil
+	}
+	if req.Pool < 0 || int(req.Pool) >= len(a.pools) {
+		return &pb.ListPoolsResponse{Success: false, Message: fmt.Sprintf("No pool %d", req.Pool)}, nil
+	}
+	if err := a.pools[req.Pool].Resize(int(req.Workers)); err != nil {
+		return &pb.ListPoolsResponse{Success: false, Message: err.Error()}, nil
+	}
+	log.Printf("Pool %d resized to %d workers", req.Pool, req.Workers)
+	return &pb.ListPoolsResponse{Success: true, Message: "Pool resized", Pools: a.poolInfo()}, nil
+}
+
+func (a *AdminServer) poolInfo() []*pb.PoolInfo {
+	out := make([]*pb.PoolInfo, 0, len(a.pools))
+	for i, p := range a.pools {
+		out = append(out, &pb.PoolInfo{Pool: int32(i), Workers: int32(p.Size()), Queued: int64(p.Queued())})
+	}
+	return out
+}
+
+// ReplayDeadLetters publishes dead letters again, each at most once. Fix
+// the cause of the failures first, e.g. provider credentials.
+func (a *AdminServer) ReplayDeadLetters(ctx context.Context, req *pb.ReplayDeadLettersRequest) (*pb.AdminResponse, error) {
+	if !isOperator(ctx) {
+		return &pb.AdminResponse{Success: false, Message: notOperator}, nil
+	}
+	if a.deadLetters == nil {
+		return &pb.AdminResponse{Success: false, Message: "Dead letters are not enabled"}, nil
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultReplayLimit
+	}
+
+	n, err := deadletter.Replay(ctx, a.deadLetters, a.deadLetterTopic, limit, func(l deadletter.Letter) error {
+		var task redis.QueuedTask
+		if err := json.Unmarshal(l.Value, &task); err != nil {
+			log.Printf("Skipping unreadable dead letter: %v", err)
+			return nil
+		}
+		if err := a.notifications.Publish(ctx, l.Key, l.Value); err != nil {
+			return err
+		}
+		a.notifications.recordStatus(tenant.WithTenant(ctx, task.TenantID), task.ID, task.UserID, task.Type, status.Queued)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Dead letter replay stopped after %d: %v", n, err)
+		return &pb.AdminResponse{Success: false, Message: "Replay stopped: " + err.Error(), Count: int64(n)}, nil
+	}
+	log.Printf("Replayed %d dead letters", n)
+	return &pb.AdminResponse{Success: true, Message: fmt.Sprintf("Replayed %d notifications", n), Count: int64(n)}, nil
+}
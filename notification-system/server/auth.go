@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lazypanda2004/notification-system/internal/auth"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes is the scope each RPC needs. Methods missing here need admin.
+var methodScopes = map[string]string{
+	pb.NotificationService_SendNotification_FullMethodName:       auth.ScopeSend,
+	pb.NotificationService_CancelNotification_FullMethodName:     auth.ScopeSend,
+	pb.NotificationService_RescheduleNotification_FullMethodName: auth.ScopeSend,
+	pb.NotificationService_CreateSchedule_FullMethodName:         auth.ScopeSend,
+	pb.NotificationService_PauseSchedule_FullMethodName:          auth.ScopeSend,
+	pb.NotificationService_ResumeSchedule_FullMethodName:         auth.ScopeSend,
+	pb.NotificationService_DeleteSchedule_FullMethodName:         auth.ScopeSend,
+
+	pb.NotificationService_GetNotificationStatus_FullMethodName: auth.ScopeReadStatus,
+	pb.NotificationService_WatchEvents_FullMethodName:           auth.ScopeReadStatus,
+	pb.NotificationService_ListSchedules_FullMethodName:         auth.ScopeReadStatus,
+	pb.NotificationService_GetTemplate_FullMethodName:           auth.ScopeReadStatus,
+	pb.NotificationService_ListTemplates_FullMethodName:         auth.ScopeReadStatus,
+	pb.NotificationService_ListWebhooks_FullMethodName:          auth.ScopeReadStatus,
+	pb.NotificationService_ListDevices_FullMethodName:           auth.ScopeReadStatus,
+	pb.NotificationService_GetPreferences_FullMethodName:        auth.ScopeReadStatus,
+	pb.NotificationService_ListContacts_FullMethodName:          auth.ScopeReadStatus,
+	pb.NotificationService_ListHistory_FullMethodName:           auth.ScopeReadStatus,
+}
+
+// AuthInterceptors authenticate every call with the API key or JWT sent as
+// "authorization: Bearer <token>", check that the caller holds the scope of
+// the method and scope the context to the caller's tenant. Admins of the
+// default tenant operate the whole deployment and may act for another
+// tenant by naming it in the x-tenant-id header.
+func AuthInterceptors(a *auth.Authenticator, tenants *tenant.Registry) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	authorize := func(ctx context.Context, method string) (context.Context, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		p, err := a.Authenticate(bearerToken(md))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		scope, ok := methodScopes[method]
+		if !ok {
+			scope = auth.ScopeAdmin
+		}
+		if !p.Allows(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "%s needs the %s scope", method, scope)
+		}
+
+		id := p.Tenant
+		if id == "" {
+			id = tenant.Default
+		}
+		if v := md.Get(TenantHeader); len(v) > 0 && v[0] != "" && v[0] != id {
+			if id != tenant.Default || !p.Allows(auth.ScopeAdmin) {
+				return nil, status.Error(codes.PermissionDenied, "credentials are not valid for another tenant")
+			}
+			id = v[0]
+		}
+		if err := tenant.Validate(id); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if !tenants.Known(id) {
+			return nil, status.Errorf(codes.PermissionDenied, "unknown tenant %q", id)
+		}
+
+		return auth.WithPrincipal(tenant.WithTenant(ctx, id), p), nil
+	}
+
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+	}
+	return unary, stream
+}
+
+func bearerToken(md metadata.MD) string {
+	v := md.Get("authorization")
+	if len(v) == 0 {
+		return ""
+	}
+	token, ok := strings.CutPrefix(v[0], "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// scopedStream replaces the context of a stream with the authorized one.
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/contacts"
+	"github.com/lazypanda2004/notification-system/internal/preferences"
+	"github.com/lazypanda2004/notification-system/internal/priority"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// Verification codes are sent as critical notifications that expire with
+// the code. Their category lets them through the user's opt-outs and quiet
+// hours.
+const verificationTTLSeconds = 600
+
+// SetContactStore enables the contact directory RPCs.
+func (s *NotificationServer) SetContactStore(store *contacts.Store) {
+	s.contacts = store
+}
+
+func (s *NotificationServer) AddContact(ctx context.Context, req *pb.AddContactRequest) (*pb.ContactResponse, error) {
+	if s.contacts == nil {
+		return &pb.ContactResponse{Success: false, Message: "Contact directory is not enabled"}, nil
+	}
+
+	c, code, err := s.contacts.Add(ctx, req.UserId, req.Channel, req.Address, req.Primary)
+	if err != nil {
+		log.Printf("Failed to add contact for user %s: %v", req.UserId, err)
+		return &pb.ContactResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	res, err := s.send(ctx, &pb.NotificationRequest{
+		UserId:     req.UserId,
+		Type:       c.Channel,
+		Recipient:  c.Address,
+		Subject:    "Your verification code",
+		Message:    fmt.Sprintf("Your verification code is %s. It expires in 10 minutes.", code),
+		Priority:   priority.Critical,
+		Category:   preferences.CategoryVerification,
+		TtlSeconds: verificationTTLSeconds,
+	})
+	if err != nil || !res.Success {
+		log.Printf("Failed to send verification code to %s contact of user %s", c.Channel, req.UserId)
+		return &pb.ContactResponse{Success: false, Message: "Failed to send verification code"}, nil
+	}
+
+	log.Printf("Added %s contact for user %s, verification pending", c.Channel, req.UserId)
+	return &pb.ContactResponse{
+		Success: true,
+		Message: "Verification code sent",
+		Contact: toPBContact(c),
+	}, nil
+}
+
+func (s *NotificationServer) VerifyContact(ctx context.Context, req *pb.VerifyContactRequest) (*pb.ContactResponse, error) {
+	if s.contacts == nil {
+		return &pb.ContactResponse{Success: false, Message: "Contact directory is not enabled"}, nil
+	}
+
+	c, err := s.contacts.Verify(ctx, req.UserId, req.Address, req.Code)
+	switch {
+	case errors.Is(err, contacts.ErrNotFound), errors.Is(err, contacts.ErrInvalidCode), errors.Is(err, contacts.ErrTooManyTries):
+		return &pb.ContactResponse{Success: false, Message: err.Error()}, nil
+	case err != nil:
+		log.Printf("Failed to verify contact for user %s: %v", req.UserId, err)
+		return &pb.ContactResponse{Success: false, Message: "Failed to verify contact"}, nil
+	}
+
+	log.Printf("Verified %s contact for user %s", c.Channel, req.UserId)
+	return &pb.ContactResponse{
+		Success: true,
+		Message: "Contact verified",
+		Contact: toPBContact(c),
+	}, nil
+}
+
+func (s *NotificationServer) DeleteContact(ctx context.Context, req *pb.ContactRequest) (*pb.ContactResponse, error) {
+	if s.contacts == nil {
+		return &pb.ContactResponse{Success: false, Message: "Contact directory is not enabled"}, nil
+	}
+
+	removed, err := s.contacts.Delete(ctx, req.UserId, req.Address)
+	if err != nil {
+		log.Printf("Failed to delete contact for user %s: %v", req.UserId, err)
+		return &pb.ContactResponse{Success: false, Message: "Failed to delete contact"}, nil
+	}
+	if !removed {
+		return &pb.ContactResponse{Success: false, Message: "Contact not found"}, nil
+	}
+
+	return &pb.ContactResponse{Success: true, Message: "Contact deleted"}, nil
+}
+
+func (s *NotificationServer) ListContacts(ctx context.Context, req *pb.ListContactsRequest) (*pb.ListContactsResponse, error) {
+	res := &pb.ListContactsResponse{}
+	if s.contacts == nil {
+		return res, nil
+	}
+
+	all, err := s.contacts.List(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to list contacts for user %s: %v", req.UserId, err)
+		return nil, err
+	}
+	for _, c := range all {
+		res.Contacts = append(res.Contacts, toPBContact(c))
+	}
+	return res, nil
+}
+
+func toPBContact(c *contacts.Contact) *pb.Contact {
+	return &pb.Contact{
+		Channel:    c.Channel,
+		Address:    c.Address,
+		Verified:   c.Verified,
+		Primary:    c.Primary,
+		CreatedAt:  c.CreatedAt,
+		VerifiedAt: c.VerifiedAt,
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/push"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// SetDeviceRegistry enables the push device RPCs.
+func (s *NotificationServer) SetDeviceRegistry(registry *push.Registry) {
+	s.devices = registry
+}
+
+func (s *NotificationServer) RegisterDevice(ctx context.Context, req *pb.RegisterDeviceRequest) (*pb.DeviceResponse, error) {
+	if s.devices == nil {
+		return &pb.DeviceResponse{Success: false, Message: "Push is not enabled"}, nil
+	}
+
+	d, err := s.devices.Register(ctx, req.UserId, req.Token, req.Platform)
+	if err != nil {
+		log.Printf("Failed to register device for user %s: %v", req.UserId, err)
+		return &pb.DeviceResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	log.Printf("Registered %s device for user %s", d.Platform, req.UserId)
+	return &pb.DeviceResponse{
+		Success: true,
+		Message: "Device registered",
+		Device:  toPBDevice(d),
+	}, nil
+}
+
+func (s *NotificationServer) UnregisterDevice(ctx context.Context, req *pb.UnregisterDeviceRequest) (*pb.DeviceResponse, error) {
+	if s.devices == nil {
+		return &pb.DeviceResponse{Success: false, Message: "Push is not enabled"}, nil
+	}
+
+	removed, err := s.devices.Unregister(ctx, req.UserId, req.Token)
+	if err != nil {
+		log.Printf("Failed to unregister device for user %s: %v", req.UserId, err)
+		return &pb.DeviceResponse{Success: false, Message: "Failed to unregister device"}, nil
+	}
+	if !removed {
+		return &pb.DeviceResponse{Success: false, Message: "Device not found"}, nil
+	}
+
+	return &pb.DeviceResponse{Success: true, Message: "Device unregistered"}, nil
+}
+
+func (s *NotificationServer) ListDevices(ctx context.Context, req *pb.ListDevicesRequest) (*pb.ListDevicesResponse, error) {
+	res := &pb.ListDevicesResponse{}
+	if s.devices == nil {
+		return res, nil
+	}
+
+	devices, err := s.devices.List(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to list devices for user %s: %v", req.UserId, err)
+		return nil, err
+	}
+	for _, d := range devices {
+		res.Devices = append(res.Devices, toPBDevice(d))
+	}
+	return res, nil
+}
+
+func toPBDevice(d *push.Device) *pb.Device {
+	return &pb.Device{
+		Token:     d.Token,
+		Platform:  d.Platform,
+		CreatedAt: d.CreatedAt,
+	}
+}
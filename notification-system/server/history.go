@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/history"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// SetHistoryStore records cancellations in the notification history and
+// enables the history RPC.
+func (s *NotificationServer) SetHistoryStore(store *history.Store) {
+	s.history = store
+}
+
+func (s *NotificationServer) ListHistory(ctx context.Context, req *pb.ListHistoryRequest) (*pb.ListHistoryResponse, error) {
+	res := &pb.ListHistoryResponse{}
+	if s.history == nil {
+		return res, nil
+	}
+
+	q := history.Query{
+		UserID:  req.UserId,
+		Channel: req.Channel,
+		Status:  req.Status,
+		Limit:   int(req.PageSize),
+		After:   req.PageToken,
+	}
+	if req.From > 0 {
+		q.From = time.Unix(req.From, 0)
+	}
+	if req.To > 0 {
+		q.To = time.Unix(req.To, 0)
+	}
+	entries, next, err := s.history.List(ctx, q)
+	if err != nil {
+		log.Printf("Failed to list history: %v", err)
+		return nil, err
+	}
+	for _, e := range entries {
+		res.Entries = append(res.Entries, toPBHistoryEntry(e))
+	}
+	res.NextPageToken = next
+	return res, nil
+}
+
+func toPBHistoryEntry(e history.Entry) *pb.HistoryEntry {
+	var started int64
+	if !e.StartedAt.IsZero() {
+		started = e.StartedAt.Unix()
+	}
+	return &pb.HistoryEntry{
+		EventId:          e.EventID,
+		NotificationId:   e.NotificationID,
+		UserId:           e.UserID,
+		Channel:          e.Channel,
+		Recipient:        e.Recipient,
+		Status:           e.Status,
+		Reason:           e.Reason,
+		TemplateId:       e.TemplateID,
+		ContentHash:      e.ContentHash,
+		ProviderResponse: e.ProviderResponse,
+		StartedAt:        started,
+		RecordedAt:       e.RecordedAt.Unix(),
+	}
+}
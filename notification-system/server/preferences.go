@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/preferences"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// SetPreferenceStore enables the preference RPCs.
+func (s *NotificationServer) SetPreferenceStore(store *preferences.Store) {
+	s.preferences = store
+}
+
+func (s *NotificationServer) GetPreferences(ctx context.Context, req *pb.PreferencesRequest) (*pb.PreferencesResponse, error) {
+	if s.preferences == nil {
+		return &pb.PreferencesResponse{Success: false, Message: "Preferences are not enabled"}, nil
+	}
+
+	p, err := s.preferences.Get(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to get preferences of user %s: %v", req.UserId, err)
+		return &pb.PreferencesResponse{Success: false, Message: "Failed to get preferences"}, nil
+	}
+
+	return &pb.PreferencesResponse{Success: true, Preferences: toPBPreferences(p)}, nil
+}
+
+func (s *NotificationServer) UpdatePreferences(ctx context.Context, req *pb.Preferences) (*pb.PreferencesResponse, error) {
+	if s.preferences == nil {
+		return &pb.PreferencesResponse{Success: false, Message: "Preferences are not enabled"}, nil
+	}
+
+	p := &preferences.Preferences{
+		UserID:                 req.UserId,
+		OptedOutChannels:       req.OptedOutChannels,
+		UnsubscribedCategories: req.UnsubscribedCategories,
+		ChannelOrder:           req.ChannelOrder,
+	}
+	if q := req.QuietHours; q != nil && (q.Start != "" || q.End != "") {
+		p.QuietHours = &preferences.QuietHours{Start: q.Start, End: q.End, Timezone: q.Timezone}
+	}
+	if err := s.preferences.Put(ctx, p); err != nil {
+		log.Printf("Failed to update preferences of user %s: %v", req.UserId, err)
+		return &pb.PreferencesResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	log.Printf("Updated preferences of user %s", req.UserId)
+	return &pb.PreferencesResponse{
+		Success:     true,
+		Message:     "Preferences updated",
+		Preferences: toPBPreferences(p),
+	}, nil
+}
+
+func toPBPreferences(p *preferences.Preferences) *pb.Preferences {
+	out := &pb.Preferences{
+		UserId:                 p.UserID,
+		OptedOutChannels:       p.OptedOutChannels,
+		UnsubscribedCategories: p.UnsubscribedCategories,
+		ChannelOrder:           p.ChannelOrder,
+	}
+	if q := p.QuietHours; q != nil {
+		out.QuietHours = &pb.QuietHours{Start: q.Start, End: q.End, Timezone: q.Timezone}
+	}
+	return out
+}
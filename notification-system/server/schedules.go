@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lazypanda2004/notification-system/internal/scheduler"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// SetCronScheduler enables the recurring schedule RPCs.
+func (s *NotificationServer) SetCronScheduler(cron *scheduler.CronScheduler) {
+	s.cron = cron
+}
+
+// Occurrence builds the notification published for one run of a recurring
+// schedule. The id is derived from the schedule and run time so a run that
+// is retried keeps the same notification id, and ttl_seconds counts from
+// the run time.
+func Occurrence(r *scheduler.Recurring, at time.Time) ([]byte, error) {
+	var req pb.NotificationRequest
+	if err := json.Unmarshal(r.Notification, &req); err != nil {
+		return nil, err
+	}
+	req.NotificationId = fmt.Sprintf("%s-%d", r.ID, at.Unix())
+	req.TenantId = r.TenantID
+	req.SendAt = 0
+	req.DelaySeconds = 0
+	req.ExpiresAt = 0
+	if req.TtlSeconds > 0 {
+		req.ExpiresAt = at.Add(time.Duration(req.TtlSeconds) * time.Second).Unix()
+	}
+	return json.Marshal(&req)
+}
+
+func (s *NotificationServer) CreateSchedule(ctx context.Context, req *pb.CreateScheduleRequest) (*pb.ScheduleResponse, error) {
+	if s.cron == nil {
+		return &pb.ScheduleResponse{Success: false, Message: "Recurring schedules are not enabled"}, nil
+	}
+	if req.Notification == nil {
+		return &pb.ScheduleResponse{Success: false, Message: "Schedule needs a notification"}, nil
+	}
+	if req.Notification.ExpiresAt > 0 {
+		return &pb.ScheduleResponse{Success: false, Message: "Scheduled notifications expire by ttl_seconds, not expires_at"}, nil
+	}
+
+	data, err := json.Marshal(req.Notification)
+	if err != nil {
+		log.Printf("Failed to marshal schedule notification: %v", err)
+		return &pb.ScheduleResponse{Success: false, Message: "Failed to process request"}, nil
+	}
+
+	r := &scheduler.Recurring{
+		ID:              newNotificationID(),
+		Cron:            req.Cron,
+		Timezone:        req.Timezone,
+		UserID:          req.Notification.UserId,
+		Notification:    data,
+		MissedRunPolicy: req.MissedRunPolicy,
+	}
+	if err := s.cron.Create(ctx, r); err != nil {
+		log.Printf("Failed to create schedule: %v", err)
+		return &pb.ScheduleResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	log.Printf("Created schedule %s for user %s: %q", r.ID, r.UserID, r.Cron)
+	return &pb.ScheduleResponse{
+		Success:  true,
+		Message:  "Schedule created",
+		Schedule: toPBSchedule(r),
+	}, nil
+}
+
+func (s *NotificationServer) ListSchedules(ctx context.Context, req *pb.ListSchedulesRequest) (*pb.ListSchedulesResponse, error) {
+	res := &pb.ListSchedulesResponse{}
+	if s.cron == nil {
+		return res, nil
+	}
+
+	schedules, err := s.cron.List(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to list schedules: %v", err)
+		return nil, err
+	}
+	for _, r := range schedules {
+		res.Schedules = append(res.Schedules, toPBSchedule(r))
+	}
+	return res, nil
+}
+
+func (s *NotificationServer) PauseSchedule(ctx context.Context, req *pb.ScheduleIdRequest) (*pb.ScheduleResponse, error) {
+	return s.updateSchedule(ctx, req.ScheduleId, "paused", s.cron.Pause)
+}
+
+func (s *NotificationServer) ResumeSchedule(ctx context.Context, req *pb.ScheduleIdRequest) (*pb.ScheduleResponse, error) {
+	return s.updateSchedule(ctx, req.ScheduleId, "resumed", s.cron.Resume)
+}
+
+func (s *NotificationServer) DeleteSchedule(ctx context.Context, req *pb.ScheduleIdRequest) (*pb.ScheduleResponse, error) {
+	return s.updateSchedule(ctx, req.ScheduleId, "deleted", func(ctx context.Context, id string) (*scheduler.Recurring, error) {
+		r, err := s.cron.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return r, s.cron.Delete(ctx, id)
+	})
+}
+
+func (s *NotificationServer) updateSchedule(ctx context.Context, id, action string, update func(context.Context, string) (*scheduler.Recurring, error)) (*pb.ScheduleResponse, error) {
+	if s.cron == nil {
+		return &pb.ScheduleResponse{Success: false, Message: "Recurring schedules are not enabled"}, nil
+	}
+
+	r, err := update(ctx, id)
+	if err == scheduler.ErrScheduleNotFound {
+		return &pb.ScheduleResponse{Success: false, Message: "Schedule not found"}, nil
+	} else if err != nil {
+		log.Printf("Failed to update schedule %s: %v", id, err)
+		return &pb.ScheduleResponse{Success: false, Message: "Failed to update schedule"}, nil
+	}
+
+	log.Printf("Schedule %s %s", id, action)
+	return &pb.ScheduleResponse{
+		Success:  true,
+		Message:  "Schedule " + action,
+		Schedule: toPBSchedule(r),
+	}, nil
+}
+
+func toPBSchedule(r *scheduler.Recurring) *pb.Schedule {
+	var n pb.NotificationRequest
+	if err := json.Unmarshal(r.Notification, &n); err != nil {
+		log.Printf("Schedule %s has a malformed notification: %v", r.ID, err)
+	}
+	return &pb.Schedule{
+		ScheduleId:      r.ID,
+		Cron:            r.Cron,
+		Timezone:        r.Timezone,
+		Notification:    &n,
+		Paused:          r.Paused,
+		MissedRunPolicy: r.MissedRunPolicy,
+		NextRun:         r.NextRun,
+		LastRun:         r.LastRun,
+	}
+}
@@ -2,36 +2,101 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
-	"github.com/segmentio/kafka-go"
+	"github.com/lazypanda2004/notification-system/internal/contacts"
+	"github.com/lazypanda2004/notification-system/internal/history"
+	"github.com/lazypanda2004/notification-system/internal/preferences"
+	"github.com/lazypanda2004/notification-system/internal/priority"
+	"github.com/lazypanda2004/notification-system/internal/push"
+	"github.com/lazypanda2004/notification-system/internal/queue"
+	"github.com/lazypanda2004/notification-system/internal/scheduler"
+	"github.com/lazypanda2004/notification-system/internal/status"
+	"github.com/lazypanda2004/notification-system/internal/templates"
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"github.com/lazypanda2004/notification-system/internal/webhooks"
 	pb "github.com/lazypanda2004/notification-system/proto"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 )
 
+// Longest notification id a client may choose.
+const maxNotificationID = 128
+
+// errExpiresFirst stops a reschedule past the notification's expiry.
+var errExpiresFirst = errors.New("notification would expire before it is sent")
+
 type NotificationServer struct {
 	pb.UnimplementedNotificationServiceServer
-	kafkaWriter *kafka.Writer
+	queue       queue.Queue
+	topic       string
+	scheduler   *scheduler.Scheduler
+	cron        *scheduler.CronScheduler
+	templates   *templates.Store
+	webhooks    *webhooks.Registry
+	devices     *push.Registry
+	preferences *preferences.Store
+	status      *status.Store
+	contacts    *contacts.Store
+	history     *history.Store
 }
 
-func NewNotificationServer(brokers []string, topic string) *NotificationServer {
-	writer := &kafka.Writer{
-		Addr:         kafka.TCP(brokers...),
-		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
-		RequiredAcks: kafka.RequireAll,
-		Async:        false,
-	}
-
+// NewNotificationServer publishes notifications to q. The topic is picked
+// per message from the notification priority, see priority.Topic.
+func NewNotificationServer(q queue.Queue, topic string) *NotificationServer {
 	return &NotificationServer{
-		kafkaWriter: writer,
+		queue: q,
+		topic: topic,
 	}
 }
 
+// SetScheduler enables send_at / delay_seconds handling. Without a scheduler
+// every notification is published immediately.
+func (s *NotificationServer) SetScheduler(sched *scheduler.Scheduler) {
+	s.scheduler = sched
+}
+
 func (s *NotificationServer) SendNotification(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
+	if req.Category == preferences.CategoryVerification {
+		return &pb.NotificationResponse{
+			Success: false,
+			Message: "Category " + preferences.CategoryVerification + " is reserved for contact verification",
+		}, nil
+	}
+	return s.send(ctx, req)
+}
+
+// send is SendNotification without the checks that only apply to clients.
+func (s *NotificationServer) send(ctx context.Context, req *pb.NotificationRequest) (*pb.NotificationResponse, error) {
 	log.Printf("Received notification request for user: %s, type: %s", req.UserId, req.Type)
 
+	req.TenantId = tenant.FromContext(ctx)
+	if req.NotificationId == "" {
+		req.NotificationId = newNotificationID()
+	} else if err := checkNotificationID(req.NotificationId); err != nil {
+		return &pb.NotificationResponse{Success: false, Message: err.Error()}, nil
+	}
+	if _, err := priority.Parse(req.Priority); err != nil {
+		return &pb.NotificationResponse{Success: false, Message: err.Error()}, nil
+	}
+	sendAt := sendTime(req.SendAt, req.DelaySeconds)
+	if req.ExpiresAt == 0 && req.TtlSeconds > 0 {
+		req.ExpiresAt = latest(sendAt, time.Now()).Add(time.Duration(req.TtlSeconds) * time.Second).Unix()
+	}
+	if req.ExpiresAt > 0 && !time.Unix(req.ExpiresAt, 0).After(latest(sendAt, time.Now())) {
+		return &pb.NotificationResponse{
+			Success: false,
+			Message: "Notification would expire before it is sent",
+		}, nil
+	}
+
 	// Serialize the request to JSON
 	data, err := json.Marshal(req)
 	if err != nil {
@@ -42,29 +107,185 @@ func (s *NotificationServer) SendNotification(ctx context.Context, req *pb.Notif
 		}, nil
 	}
 
-	// Create Kafka message
-	msg := kafka.Message{
-		Key:   []byte(req.UserId),
-		Value: data,
-		Time:  time.Now(),
+	if sendAt.After(time.Now()) {
+		if s.scheduler == nil {
+			return &pb.NotificationResponse{
+				Success: false,
+				Message: "Scheduled delivery is not enabled",
+			}, nil
+		}
+		err = s.scheduler.Schedule(ctx, tenant.Key(ctx, req.NotificationId), req.UserId, data, sendAt)
+		if errors.Is(err, scheduler.ErrAlreadyScheduled) {
+			return nil, grpcstatus.Errorf(codes.AlreadyExists, "notification %s is already scheduled", req.NotificationId)
+		} else if err != nil {
+			log.Printf("Failed to schedule notification %s: %v", req.NotificationId, err)
+			return &pb.NotificationResponse{
+				Success: false,
+				Message: "Failed to schedule notification",
+			}, nil
+		}
+		s.recordStatus(ctx, req.NotificationId, req.UserId, req.Type, status.Scheduled)
+		return &pb.NotificationResponse{
+			Success:        true,
+			Message:        "Notification scheduled for " + sendAt.UTC().Format(time.RFC3339),
+			NotificationId: req.NotificationId,
+		}, nil
 	}
 
-	// Publish to Kafka
-	err = s.kafkaWriter.WriteMessages(ctx, msg)
+	// Publish to the queue
+	err = s.Publish(ctx, req.UserId, data)
 	if err != nil {
-		log.Printf("Failed to write to Kafka: %v", err)
+		log.Printf("Failed to publish notification %s: %v", req.NotificationId, err)
 		return &pb.NotificationResponse{
 			Success: false,
 			Message: "Failed to publish notification",
 		}, nil
 	}
 
+	s.recordStatus(ctx, req.NotificationId, req.UserId, req.Type, status.Queued)
 	return &pb.NotificationResponse{
-		Success: true,
-		Message: "Notification queued successfully!",
+		Success:        true,
+		Message:        "Notification queued successfully!",
+		NotificationId: req.NotificationId,
 	}, nil
 }
 
-func (s *NotificationServer) Close() error {
-	return s.kafkaWriter.Close()
+func (s *NotificationServer) CancelNotification(ctx context.Context, req *pb.CancelNotificationRequest) (*pb.NotificationResponse, error) {
+	if s.scheduler == nil {
+		return &pb.NotificationResponse{Success: false, Message: "Scheduled delivery is not enabled"}, nil
+	}
+	if err := checkNotificationID(req.NotificationId); err != nil {
+		return &pb.NotificationResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	entry, err := s.scheduler.Cancel(ctx, tenant.Key(ctx, req.NotificationId))
+	if res := scheduleChangeFailed(req.NotificationId, err); res != nil {
+		return res, nil
+	} else if err != nil {
+		log.Printf("Failed to cancel notification %s: %v", req.NotificationId, err)
+		return &pb.NotificationResponse{Success: false, Message: "Failed to cancel notification"}, nil
+	}
+
+	// The entry is keyed by user; the channel is in the stored request.
+	var cancelled pb.NotificationRequest
+	if err := json.Unmarshal(entry.Payload, &cancelled); err != nil && len(entry.Payload) > 0 {
+		log.Printf("Cancelled notification %s has a malformed request: %v", req.NotificationId, err)
+	}
+	s.recordStatus(ctx, req.NotificationId, entry.Key, cancelled.Type, status.Cancelled)
+	return &pb.NotificationResponse{
+		Success:        true,
+		Message:        "Notification cancelled",
+		NotificationId: req.NotificationId,
+	}, nil
+}
+
+func (s *NotificationServer) RescheduleNotification(ctx context.Context, req *pb.RescheduleNotificationRequest) (*pb.NotificationResponse, error) {
+	if s.scheduler == nil {
+		return &pb.NotificationResponse{Success: false, Message: "Scheduled delivery is not enabled"}, nil
+	}
+	if err := checkNotificationID(req.NotificationId); err != nil {
+		return &pb.NotificationResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	sendAt := sendTime(req.SendAt, req.DelaySeconds)
+	if !sendAt.After(time.Now()) {
+		return &pb.NotificationResponse{Success: false, Message: "A send time in the future is required"}, nil
+	}
+
+	err := s.scheduler.Reschedule(ctx, tenant.Key(ctx, req.NotificationId), sendAt, func(e *scheduler.Entry) error {
+		var pending pb.NotificationRequest
+		if err := json.Unmarshal(e.Payload, &pending); err != nil {
+			return err
+		}
+		if pending.ExpiresAt > 0 && !time.Unix(pending.ExpiresAt, 0).After(sendAt) {
+			return errExpiresFirst
+		}
+		return nil
+	})
+	if errors.Is(err, errExpiresFirst) {
+		return &pb.NotificationResponse{Success: false, Message: "Notification would expire before it is sent", NotificationId: req.NotificationId}, nil
+	} else if res := scheduleChangeFailed(req.NotificationId, err); res != nil {
+		return res, nil
+	} else if err != nil {
+		log.Printf("Failed to reschedule notification %s: %v", req.NotificationId, err)
+		return &pb.NotificationResponse{Success: false, Message: "Failed to reschedule notification"}, nil
+	}
+
+	return &pb.NotificationResponse{
+		Success:        true,
+		Message:        "Notification rescheduled for " + sendAt.UTC().Format(time.RFC3339),
+		NotificationId: req.NotificationId,
+	}, nil
+}
+
+// scheduleChangeFailed answers a cancel or reschedule of a notification that
+// is no longer pending, or returns nil.
+func scheduleChangeFailed(id string, err error) *pb.NotificationResponse {
+	var message string
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		message = "Notification not found or already sent"
+	case errors.Is(err, scheduler.ErrClaimed):
+		message = "Notification is being sent and can no longer be changed"
+	default:
+		return nil
+	}
+	return &pb.NotificationResponse{Success: false, Message: message, NotificationId: id}
+}
+
+// Publish writes an already serialized notification to the queue topic of
+// its priority.
+func (s *NotificationServer) Publish(ctx context.Context, key string, value []byte) error {
+	var envelope struct {
+		Priority string `json:"priority"`
+	}
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return err
+	}
+
+	return s.queue.Publish(ctx, queue.Message{
+		Topic: priority.Topic(s.topic, envelope.Priority),
+		Key:   []byte(key),
+		Value: value,
+	})
+}
+
+// sendTime resolves send_at / delay_seconds into an absolute time. A zero
+// result means "now".
+func sendTime(sendAt, delaySeconds int64) time.Time {
+	if delaySeconds > 0 {
+		return time.Now().Add(time.Duration(delaySeconds) * time.Second)
+	}
+	if sendAt > 0 {
+		return time.Unix(sendAt, 0)
+	}
+	return time.Time{}
+}
+
+// checkNotificationID rejects ids that could reach into the keys of another
+// tenant: ids end up in Redis keys namespaced by tenant.Key, whose separator
+// is ':'.
+func checkNotificationID(id string) error {
+	switch {
+	case id == "":
+		return errors.New("notification id is required")
+	case len(id) > maxNotificationID:
+		return fmt.Errorf("notification id is longer than %d bytes", maxNotificationID)
+	case strings.Contains(id, ":"):
+		return errors.New("notification id may not contain ':'")
+	}
+	return nil
+}
+
+func newNotificationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
 }
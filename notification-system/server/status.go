@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/history"
+	"github.com/lazypanda2004/notification-system/internal/status"
+	pb "github.com/lazypanda2004/notification-system/proto"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// SetStatusStore enables status tracking and the status RPC.
+func (s *NotificationServer) SetStatusStore(store *status.Store) {
+	s.status = store
+}
+
+func (s *NotificationServer) GetNotificationStatus(ctx context.Context, req *pb.NotificationStatusRequest) (*pb.NotificationStatusResponse, error) {
+	if s.status == nil {
+		return &pb.NotificationStatusResponse{Success: false, Message: "Status tracking is not enabled"}, nil
+	}
+
+	st, err := s.status.Get(ctx, req.NotificationId)
+	if err != nil {
+		log.Printf("Failed to get status of %s: %v", req.NotificationId, err)
+		return &pb.NotificationStatusResponse{Success: false, Message: "Failed to get status"}, nil
+	}
+	if st == nil {
+		return &pb.NotificationStatusResponse{Success: false, Message: "Notification not found"}, nil
+	}
+
+	return &pb.NotificationStatusResponse{
+		Success: true,
+		Status: &pb.NotificationStatus{
+			NotificationId: st.NotificationID,
+			UserId:         st.UserID,
+			State:          st.State,
+			Channel:        st.Channel,
+			Reason:         st.Reason,
+			UpdatedAt:      st.UpdatedAt.Unix(),
+		},
+	}, nil
+}
+
+func (s *NotificationServer) WatchEvents(req *pb.WatchEventsRequest, stream pb.NotificationService_WatchEventsServer) error {
+	if s.status == nil {
+		return grpcstatus.Error(codes.Unimplemented, "Status tracking is not enabled")
+	}
+
+	ctx := stream.Context()
+	var sendErr error
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err := s.status.Watch(watchCtx, func(st status.Status) {
+		if req.UserId != "" && st.UserID != req.UserId {
+			return
+		}
+		if req.NotificationId != "" && st.NotificationID != req.NotificationId {
+			return
+		}
+		sendErr = stream.Send(&pb.NotificationStatus{
+			NotificationId: st.NotificationID,
+			UserId:         st.UserID,
+			State:          st.State,
+			Channel:        st.Channel,
+			Reason:         st.Reason,
+			UpdatedAt:      st.UpdatedAt.Unix(),
+		})
+		if sendErr != nil {
+			cancel() // the client is gone
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		log.Printf("Failed to watch status events: %v", err)
+	}
+	return err
+}
+
+// recordStatus is a no-op when status tracking is disabled. Final states
+// also go to the history.
+func (s *NotificationServer) recordStatus(ctx context.Context, id, userID, channel, state string) {
+	if s.history != nil && history.Final(state) {
+		err := s.history.Record(ctx, history.Entry{NotificationID: id, UserID: userID, Channel: channel, Status: state})
+		if err != nil {
+			log.Printf("Failed to record history of %s: %v", id, err)
+		}
+	}
+	if s.status == nil {
+		return
+	}
+	err := s.status.Record(ctx, status.Status{
+		NotificationID: id,
+		UserID:         userID,
+		State:          state,
+		Channel:        channel,
+	})
+	if err != nil {
+		log.Printf("Failed to record status of %s: %v", id, err)
+	}
+}
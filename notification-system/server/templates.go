@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/templates"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// SetTemplateStore enables the template management RPCs.
+func (s *NotificationServer) SetTemplateStore(store *templates.Store) {
+	s.templates = store
+}
+
+func (s *NotificationServer) CreateTemplate(ctx context.Context, req *pb.Template) (*pb.TemplateResponse, error) {
+	if s.templates == nil {
+		return &pb.TemplateResponse{Success: false, Message: "Templates are not enabled"}, nil
+	}
+
+	t := &templates.Template{
+		ID:           req.TemplateId,
+		EmailSubject: req.EmailSubject,
+		EmailHTML:    req.EmailHtml,
+		EmailText:    req.EmailText,
+		SMSText:      req.SmsText,
+	}
+	if _, err := s.templates.Create(ctx, t); err != nil {
+		log.Printf("Failed to create template %s: %v", req.TemplateId, err)
+		return &pb.TemplateResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	log.Printf("Created template %s version %d", t.ID, t.Version)
+	return &pb.TemplateResponse{
+		Success:  true,
+		Message:  "Template created",
+		Template: toPBTemplate(t),
+	}, nil
+}
+
+func (s *NotificationServer) GetTemplate(ctx context.Context, req *pb.TemplateIdRequest) (*pb.TemplateResponse, error) {
+	if s.templates == nil {
+		return &pb.TemplateResponse{Success: false, Message: "Templates are not enabled"}, nil
+	}
+
+	t, err := s.templates.Get(ctx, req.TemplateId, int(req.Version))
+	if err == templates.ErrNotFound {
+		return &pb.TemplateResponse{Success: false, Message: "Template not found"}, nil
+	} else if err != nil {
+		log.Printf("Failed to get template %s: %v", req.TemplateId, err)
+		return &pb.TemplateResponse{Success: false, Message: "Failed to get template"}, nil
+	}
+
+	return &pb.TemplateResponse{Success: true, Template: toPBTemplate(t)}, nil
+}
+
+func (s *NotificationServer) ListTemplates(ctx context.Context, req *pb.ListTemplatesRequest) (*pb.ListTemplatesResponse, error) {
+	res := &pb.ListTemplatesResponse{}
+	if s.templates == nil {
+		return res, nil
+	}
+
+	list, err := s.templates.List(ctx)
+	if err != nil {
+		log.Printf("Failed to list templates: %v", err)
+		return nil, err
+	}
+	for _, t := range list {
+		res.Templates = append(res.Templates, toPBTemplate(t))
+	}
+	return res, nil
+}
+
+func (s *NotificationServer) DeleteTemplate(ctx context.Context, req *pb.TemplateIdRequest) (*pb.TemplateResponse, error) {
+	if s.templates == nil {
+		return &pb.TemplateResponse{Success: false, Message: "Templates are not enabled"}, nil
+	}
+
+	err := s.templates.Delete(ctx, req.TemplateId, int(req.Version))
+	if err == templates.ErrNotFound {
+		return &pb.TemplateResponse{Success: false, Message: "Template not found"}, nil
+	} else if err != nil {
+		log.Printf("Failed to delete template %s: %v", req.TemplateId, err)
+		return &pb.TemplateResponse{Success: false, Message: "Failed to delete template"}, nil
+	}
+
+	log.Printf("Deleted template %s version %d", req.TemplateId, req.Version)
+	return &pb.TemplateResponse{Success: true, Message: "Template deleted"}, nil
+}
+
+func toPBTemplate(t *templates.Template) *pb.Template {
+	return &pb.Template{
+		TemplateId:   t.ID,
+		Version:      int32(t.Version),
+		EmailSubject: t.EmailSubject,
+		EmailHtml:    t.EmailHTML,
+		EmailText:    t.EmailText,
+		SmsText:      t.SMSText,
+		CreatedAt:    t.CreatedAt,
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+
+	"github.com/lazypanda2004/notification-system/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TenantHeader is the gRPC metadata key naming the caller's tenant.
+const TenantHeader = "x-tenant-id"
+
+// TenantInterceptors put the tenant named in the request metadata into the
+// context, defaulting to tenant.Default. Tenants missing from reg are
+// rejected. The header is trusted as is, so only use them instead of
+// AuthInterceptors when callers are authenticated in front of the server.
+func TenantInterceptors(reg *tenant.Registry) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	scope := func(ctx context.Context) (context.Context, error) {
+		id := tenant.Default
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(TenantHeader); len(v) > 0 && v[0] != "" {
+				id = v[0]
+			}
+		}
+		if err := tenant.Validate(id); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if !reg.Known(id) {
+			return nil, status.Errorf(codes.PermissionDenied, "unknown tenant %q", id)
+		}
+		return tenant.WithTenant(ctx, id), nil
+	}
+
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := scope(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := scope(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+	}
+	return unary, stream
+}
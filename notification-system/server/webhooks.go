@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/lazypanda2004/notification-system/internal/webhooks"
+	pb "github.com/lazypanda2004/notification-system/proto"
+)
+
+// SetWebhookRegistry enables the webhook endpoint RPCs.
+func (s *NotificationServer) SetWebhookRegistry(registry *webhooks.Registry) {
+	s.webhooks = registry
+}
+
+func (s *NotificationServer) RegisterWebhook(ctx context.Context, req *pb.RegisterWebhookRequest) (*pb.WebhookResponse, error) {
+	if s.webhooks == nil {
+		return &pb.WebhookResponse{Success: false, Message: "Webhooks are not enabled"}, nil
+	}
+
+	e, err := s.webhooks.Register(ctx, req.UserId, req.Url)
+	if err != nil {
+		log.Printf("Failed to register webhook for user %s: %v", req.UserId, err)
+		return &pb.WebhookResponse{Success: false, Message: err.Error()}, nil
+	}
+
+	log.Printf("Registered webhook %s for user %s", e.ID, e.UserID)
+	return &pb.WebhookResponse{
+		Success: true,
+		Message: "Webhook registered",
+		Webhook: toPBWebhook(e, true),
+	}, nil
+}
+
+func (s *NotificationServer) RotateWebhookSecret(ctx context.Context, req *pb.WebhookIdRequest) (*pb.WebhookResponse, error) {
+	if s.webhooks == nil {
+		return &pb.WebhookResponse{Success: false, Message: "Webhooks are not enabled"}, nil
+	}
+
+	e, err := s.webhooks.Rotate(ctx, req.EndpointId)
+	if err == webhooks.ErrNotFound {
+		return &pb.WebhookResponse{Success: false, Message: "Webhook not found"}, nil
+	} else if err != nil {
+		log.Printf("Failed to rotate webhook %s: %v", req.EndpointId, err)
+		return &pb.WebhookResponse{Success: false, Message: "Failed to rotate webhook secret"}, nil
+	}
+
+	log.Printf("Rotated secret of webhook %s", e.ID)
+	return &pb.WebhookResponse{
+		Success: true,
+		Message: "Webhook secret rotated, the previous secret stays valid for 24h",
+		Webhook: toPBWebhook(e, true),
+	}, nil
+}
+
+func (s *NotificationServer) DeleteWebhook(ctx context.Context, req *pb.WebhookIdRequest) (*pb.WebhookResponse, error) {
+	if s.webhooks == nil {
+		return &pb.WebhookResponse{Success: false, Message: "Webhooks are not enabled"}, nil
+	}
+
+	err := s.webhooks.Delete(ctx, req.EndpointId)
+	if err == webhooks.ErrNotFound {
+		return &pb.WebhookResponse{Success: false, Message: "Webhook not found"}, nil
+	} else if err != nil {
+		log.Printf("Failed to delete webhook %s: %v", req.EndpointId, err)
+		return &pb.WebhookResponse{Success: false, Message: "Failed to delete webhook"}, nil
+	}
+
+	log.Printf("Deleted webhook %s", req.EndpointId)
+	return &pb.WebhookResponse{Success: true, Message: "Webhook deleted"}, nil
+}
+
+func (s *NotificationServer) ListWebhooks(ctx context.Context, req *pb.ListWebhooksRequest) (*pb.ListWebhooksResponse, error) {
+	res := &pb.ListWebhooksResponse{}
+	if s.webhooks == nil {
+		return res, nil
+	}
+
+	list, err := s.webhooks.List(ctx, req.UserId)
+	if err != nil {
+		log.Printf("Failed to list webhooks for user %s: %v", req.UserId, err)
+		return nil, err
+	}
+	for _, e := range list {
+		res.Webhooks = append(res.Webhooks, toPBWebhook(e, false))
+	}
+	return res, nil
+}
+
+func toPBWebhook(e *webhooks.Endpoint, withSecret bool) *pb.Webhook {
+	w := &pb.Webhook{
+		EndpointId: e.ID,
+		UserId:     e.UserID,
+		Url:        e.URL,
+		CreatedAt:  e.CreatedAt,
+		RotatedAt:  e.RotatedAt,
+	}
+	if withSecret {
+		w.Secret = e.Secret
+	}
+	return w
+}